@@ -0,0 +1,101 @@
+// Package apierr defines the errors the API returns to clients. Each carries
+// a stable machine-readable code so clients don't need to match on messages.
+package apierr
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// Error is an API error with an HTTP status, a stable code and a human-readable message
+type Error struct {
+	Status  int
+	Code    string
+	Message string
+	Details interface{} // Optional structured data, e.g. per-field validation errors
+
+	cause error // The failure behind an unexpected error, logged but never sent
+}
+
+// New defines an error for the catalog
+func New(status int, code, message string) *Error {
+	return &Error{Status: status, Code: code, Message: message}
+}
+
+func (e *Error) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+// WithMessage returns a copy of the error with a more specific message
+func (e *Error) WithMessage(message string) *Error {
+	copied := *e
+	copied.Message = message
+	return &copied
+}
+
+// WithDetails returns a copy of the error carrying structured details
+func (e *Error) WithDetails(details interface{}) *Error {
+	copied := *e
+	copied.Details = details
+	return &copied
+}
+
+// Unwrap returns the failure behind an error made by Unexpected, if any
+func (e *Error) Unwrap() error {
+	return e.cause
+}
+
+// withCause returns a copy of the error caused by err
+func (e *Error) withCause(err error) *Error {
+	copied := *e
+	copied.cause = err
+	return &copied
+}
+
+// Unexpected converts an unexpected failure into the error sent to the client.
+// Failures caused by the request being cancelled or running out of time get
+// RequestCancelled or Timeout; anything else is Internal with the message.
+// The failure is kept as the error's cause so it can be logged.
+func Unexpected(err error, message string) *Error {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return RequestCancelled.withCause(err)
+	case errors.Is(err, context.DeadlineExceeded):
+		return Timeout.withCause(err)
+	default:
+		return Internal.WithMessage(message).withCause(err)
+	}
+}
+
+// Problem is the RFC 7807 application/problem+json representation of an Error
+type Problem struct {
+	Type      string      `json:"type"`
+	Title     string      `json:"title"`
+	Status    int         `json:"status"`
+	Detail    string      `json:"detail"`
+	Code      string      `json:"code"`
+	RequestID string      `json:"request_id,omitempty"`
+	Details   interface{} `json:"details,omitempty"`
+}
+
+// Problem converts the error to its response body
+func (e *Error) Problem(requestID string) Problem {
+	return Problem{
+		Type:      "about:blank",
+		Title:     statusText(e.Status),
+		Status:    e.Status,
+		Detail:    e.Message,
+		Code:      e.Code,
+		RequestID: requestID,
+		Details:   e.Details,
+	}
+}
+
+// statusText returns the reason phrase for a status, including nonstandard ones
+func statusText(status int) string {
+	if status == StatusClientClosedRequest {
+		return "Client Closed Request"
+	}
+	return http.StatusText(status)
+}
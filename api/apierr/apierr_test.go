@@ -0,0 +1,63 @@
+package apierr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestUnexpected(t *testing.T) {
+	failure := errors.New("connection refused")
+
+	tests := []struct {
+		name    string
+		err     error
+		status  int
+		code    string
+		message string
+	}{
+		{name: "other failure", err: failure, status: http.StatusInternalServerError, code: "INTERNAL_ERROR", message: "Failed to find list"},
+		{name: "cancelled", err: context.Canceled, status: StatusClientClosedRequest, code: "REQUEST_CANCELLED", message: RequestCancelled.Message},
+		{name: "wrapped cancellation", err: fmt.Errorf("find list: %w", context.Canceled),
+			status: StatusClientClosedRequest, code: "REQUEST_CANCELLED", message: RequestCancelled.Message},
+		{name: "deadline exceeded", err: context.DeadlineExceeded, status: http.StatusGatewayTimeout, code: "TIMEOUT", message: Timeout.Message},
+		{name: "wrapped deadline", err: fmt.Errorf("find list: %w", context.DeadlineExceeded),
+			status: http.StatusGatewayTimeout, code: "TIMEOUT", message: Timeout.Message},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Unexpected(tt.err, "Failed to find list")
+			if got.Status != tt.status || got.Code != tt.code || got.Message != tt.message {
+				t.Fatalf("Unexpected() = %d %s %q, want %d %s %q", got.Status, got.Code, got.Message, tt.status, tt.code, tt.message)
+			}
+
+			// The failure is kept for logging without changing the catalog entry
+			if !errors.Is(got, tt.err) {
+				t.Fatalf("Unexpected() lost its cause %v", tt.err)
+			}
+			if Internal.cause != nil || RequestCancelled.cause != nil || Timeout.cause != nil {
+				t.Fatalf("Unexpected() modified the catalog")
+			}
+		})
+	}
+}
+
+func TestProblemTitle(t *testing.T) {
+	tests := []struct {
+		err   *Error
+		title string
+	}{
+		{err: RequestCancelled, title: "Client Closed Request"},
+		{err: Timeout, title: "Gateway Timeout"},
+		{err: Internal, title: "Internal Server Error"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.err.Problem("").Title; got != tt.title {
+			t.Fatalf("%s problem title = %q, want %q", tt.err.Code, got, tt.title)
+		}
+	}
+}
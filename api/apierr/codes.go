@@ -0,0 +1,65 @@
+package apierr
+
+import "net/http"
+
+// Request errors
+var (
+	InvalidJSON      = New(http.StatusBadRequest, "INVALID_JSON", "Invalid JSON request body")
+	ValidationFailed = New(http.StatusUnprocessableEntity, "VALIDATION_FAILED", "Request validation failed")
+	MissingParameter = New(http.StatusBadRequest, "MISSING_PARAMETER", "A required parameter is missing")
+	InvalidID        = New(http.StatusBadRequest, "INVALID_ID", "Invalid ID format")
+	InvalidParameter = New(http.StatusBadRequest, "INVALID_PARAMETER", "Invalid parameter")
+	RouteNotFound    = New(http.StatusNotFound, "ROUTE_NOT_FOUND", "No route matches the request")
+	MethodNotAllowed = New(http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed for this route")
+	RateLimited      = New(http.StatusTooManyRequests, "RATE_LIMITED", "Too many requests. Please try again later.")
+)
+
+// Authentication errors
+var (
+	AuthRequired         = New(http.StatusUnauthorized, "AUTH_REQUIRED", "Authorization required. Please sign in.")
+	InvalidCredentials   = New(http.StatusUnauthorized, "INVALID_CREDENTIALS", "Invalid email or password")
+	TokenInvalid         = New(http.StatusUnauthorized, "TOKEN_INVALID", "Invalid token")
+	TokenExpired         = New(http.StatusUnauthorized, "TOKEN_EXPIRED", "Token has expired")
+	SessionEnded         = New(http.StatusUnauthorized, "SESSION_ENDED", "Session has ended. Please sign in again.")
+	RefreshTokenInvalid  = New(http.StatusUnauthorized, "REFRESH_TOKEN_INVALID", "Invalid refresh token")
+	RefreshTokenReused   = New(http.StatusUnauthorized, "REFRESH_TOKEN_REUSED", "Refresh token has already been used")
+	ResetTokenInvalid    = New(http.StatusBadRequest, "RESET_TOKEN_INVALID", "Invalid or expired reset token")
+	EmailAlreadyExists   = New(http.StatusConflict, "EMAIL_ALREADY_EXISTS", "Email already exists")
+	EmailNotVerified     = New(http.StatusForbidden, "EMAIL_NOT_VERIFIED", "Please verify your email address to use this feature")
+	EmailAlreadyVerified = New(http.StatusBadRequest, "EMAIL_ALREADY_VERIFIED", "Email is already verified")
+	VerificationInvalid  = New(http.StatusBadRequest, "VERIFICATION_TOKEN_INVALID", "Invalid or expired verification link")
+	UserNotFound         = New(http.StatusNotFound, "USER_NOT_FOUND", "User not found")
+	CSRFTokenInvalid     = New(http.StatusForbidden, "CSRF_TOKEN_INVALID", "Missing or invalid CSRF token. Fetch a new one from /csrf-token.")
+	OriginNotAllowed     = New(http.StatusForbidden, "ORIGIN_NOT_ALLOWED", "Requests from this origin are not allowed")
+	AccountLocked        = New(http.StatusTooManyRequests, "ACCOUNT_LOCKED", "Too many failed sign-in attempts. Please try again later.")
+)
+
+// List errors
+var (
+	ListNotFound          = New(http.StatusNotFound, "LIST_NOT_FOUND", "List not found")
+	ItemNotFound          = New(http.StatusNotFound, "ITEM_NOT_FOUND", "Item not found")
+	ListAccessDenied      = New(http.StatusForbidden, "LIST_ACCESS_DENIED", "You do not have access to this list")
+	PermissionDenied      = New(http.StatusForbidden, "PERMISSION_DENIED", "You do not have permission to perform this action")
+	ListVersionConflict   = New(http.StatusPreconditionFailed, "LIST_VERSION_CONFLICT", "List has been modified. Please refresh and try again.")
+	ListBusy              = New(http.StatusConflict, "LIST_BUSY", "List is being changed by others. Please try again.")
+	CollaboratorNotFound  = New(http.StatusNotFound, "COLLABORATOR_NOT_FOUND", "Collaborator not found")
+	AlreadyListOwner      = New(http.StatusBadRequest, "ALREADY_LIST_OWNER", "You are already the owner of this list")
+	OwnerCannotLeave      = New(http.StatusBadRequest, "OWNER_CANNOT_LEAVE", "Transfer ownership before leaving the list")
+	InviteNotFound        = New(http.StatusNotFound, "INVITE_NOT_FOUND", "Invite not found")
+	InviteExpired         = New(http.StatusGone, "INVITE_EXPIRED", "This invite has expired or is no longer valid")
+	StreamingNotSupported = New(http.StatusInternalServerError, "STREAMING_NOT_SUPPORTED", "Streaming is not supported")
+)
+
+// StatusClientClosedRequest is the nonstandard status, borrowed from nginx,
+// recorded when the client goes away before it gets a response
+const StatusClientClosedRequest = 499
+
+// Errors for requests whose context ended before the work was done
+var (
+	RequestCancelled = New(StatusClientClosedRequest, "REQUEST_CANCELLED", "The request was cancelled")
+	Timeout          = New(http.StatusGatewayTimeout, "TIMEOUT", "The request took too long to complete")
+)
+
+// Internal is the catch-all for unexpected failures; handlers give it a
+// message describing what failed
+var Internal = New(http.StatusInternalServerError, "INTERNAL_ERROR", "Internal server error")
@@ -0,0 +1,69 @@
+// Package app holds the dependencies shared by the API's handlers and
+// middleware, so nothing reads them from package globals and several APIs can
+// run side by side, e.g. in parallel tests.
+package app
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"bryce-stabenow/grocer-me/config"
+	"bryce-stabenow/grocer-me/events"
+	"bryce-stabenow/grocer-me/mailer"
+	"bryce-stabenow/grocer-me/store"
+	"bryce-stabenow/grocer-me/worker"
+)
+
+// App owns the configuration and everything handlers depend on
+type App struct {
+	Config *config.Config
+	Stores store.Stores
+
+	// Mailer delivers outgoing email
+	Mailer mailer.Mailer
+	// Events fans out real-time list changes to subscribers
+	Events *events.Hub
+	// Workers runs background tasks that shutdown waits for
+	Workers *worker.Group
+	// Logger is used outside of requests; requests log through utils.GetLogger
+	Logger *slog.Logger
+	// ErrorReporters are told about unexpected failures, such as recovered panics
+	ErrorReporters []ErrorReporter
+	// Now tells the time, so tests can control it
+	Now func() time.Time
+}
+
+// ErrorReporter forwards unexpected failures to an error tracking backend
+type ErrorReporter interface {
+	Report(r *http.Request, err error, stack []byte)
+}
+
+// New creates an App serving the given stores. It writes email to stdout,
+// logs through the default logger, reports errors nowhere else and uses the
+// system clock; replace those fields before serving to change them.
+func New(cfg *config.Config, stores store.Stores) *App {
+	return &App{
+		Config:  cfg,
+		Stores:  stores,
+		Mailer:  mailer.NewLogMailer(os.Stdout),
+		Events:  events.NewHub(events.DefaultHistorySize),
+		Workers: worker.NewGroup(),
+		Logger:  slog.Default(),
+		Now:     time.Now,
+	}
+}
+
+// StoreContext bounds a store operation by the configured store timeout
+func (a *App) StoreContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, a.Config.Database.Timeout)
+}
+
+// OperationContext returns the context for a store operation made while
+// handling a request. It ends when the client disconnects, the server shuts
+// down or the store timeout passes, whichever comes first.
+func (a *App) OperationContext(r *http.Request) (context.Context, context.CancelFunc) {
+	return a.StoreContext(r.Context())
+}
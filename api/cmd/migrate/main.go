@@ -2,12 +2,17 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"log"
 	"os"
 	"time"
 
+	"bryce-stabenow/grocer-me/config"
+	"bryce-stabenow/grocer-me/models"
+
 	"github.com/joho/godotenv"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/v2/bson"
 	"go.mongodb.org/mongo-driver/v2/mongo"
 	"go.mongodb.org/mongo-driver/v2/mongo/options"
@@ -16,10 +21,14 @@ import (
 
 func main() {
 	// Try to load .env file (ignore error if it doesn't exist)
-	_ = godotenv.Load("../../../.env");
+	_ = godotenv.Load("../../../.env")
 
-	// Get MongoDB URI from environment variable
-	mongoURI := os.Getenv("MONGODB_URI")
+	// Load the database settings the API uses
+	cfg, err := config.Load(flag.NewFlagSet("migrate", flag.ExitOnError), os.Args[1:], os.Getenv)
+	if err != nil {
+		log.Fatalf("Invalid configuration:\n%v", err)
+	}
+	mongoURI := cfg.Database.URI
 	if mongoURI == "" {
 		log.Fatal("MONGODB_URI environment variable is not set. Please create a .env file or set the environment variable.")
 	}
@@ -46,8 +55,8 @@ func main() {
 	}
 	fmt.Println("Connected to MongoDB!")
 
-	// Get the database (you can change "grocer-me" to your preferred database name)
-	db := client.Database("grocer-me")
+	// Get the database named by MONGODB_DATABASE (default "grocer-me")
+	db := client.Database(cfg.Database.Name)
 
 	// Create User collection with indexes
 	if err := createUserCollection(db); err != nil {
@@ -59,6 +68,52 @@ func main() {
 		log.Fatal("Error creating List collection:", err)
 	}
 
+	// Create Invite collection with indexes
+	if err := createInviteCollection(db); err != nil {
+		log.Fatal("Error creating Invite collection:", err)
+	}
+
+	// Create Session collection with indexes
+	if err := createSessionCollection(db); err != nil {
+		log.Fatal("Error creating Session collection:", err)
+	}
+
+	// Create PasswordReset collection with indexes
+	if err := createPasswordResetCollection(db); err != nil {
+		log.Fatal("Error creating PasswordReset collection:", err)
+	}
+
+	// Create EmailVerification collection with indexes
+	if err := createEmailVerificationCollection(db); err != nil {
+		log.Fatal("Error creating EmailVerification collection:", err)
+	}
+
+	// Create the rate limiting collections with TTL indexes
+	if err := createRateLimitCollections(db); err != nil {
+		log.Fatal("Error creating rate limit collections:", err)
+	}
+
+	// Treat accounts created before email verification existed as verified
+	if err := backfillEmailVerified(db); err != nil {
+		log.Fatal("Error backfilling email verification:", err)
+	}
+
+	// Convert shared_with from bare user IDs to collaborators with roles; this
+	// must run before anything else decodes lists into models.List
+	if err := migrateSharedWithRoles(db); err != nil {
+		log.Fatal("Error migrating shared_with roles:", err)
+	}
+
+	// Backfill stable IDs on list items created before items carried their own ID
+	if err := backfillListItemIDs(db); err != nil {
+		log.Fatal("Error backfilling list item IDs:", err)
+	}
+
+	// Initialize the version counter used for optimistic concurrency control
+	if err := backfillListVersions(db); err != nil {
+		log.Fatal("Error backfilling list versions:", err)
+	}
+
 	fmt.Println("Successfully created User and List collections with indexes!")
 }
 
@@ -71,15 +126,15 @@ func createUserCollection(db *mongo.Database) error {
 	// Create indexes for User collection
 	indexes := []mongo.IndexModel{
 		{
-			Keys:    bson.D{{"email", 1}},
+			Keys:    bson.D{{Key: "email", Value: 1}},
 			Options: options.Index().SetUnique(true).SetName("email_unique"),
 		},
 		{
-			Keys:    bson.D{{"username", 1}},
+			Keys:    bson.D{{Key: "username", Value: 1}},
 			Options: options.Index().SetUnique(true).SetName("username_unique"),
 		},
 		{
-			Keys:    bson.D{{"created_at", 1}},
+			Keys:    bson.D{{Key: "created_at", Value: 1}},
 			Options: options.Index().SetName("created_at_idx"),
 		},
 	}
@@ -103,6 +158,8 @@ func createUserCollection(db *mongo.Database) error {
 	//     "last_name": "Doe",
 	//     "avatar_url": "https://..."
 	//   },
+	//   "email_verified": false,
+	//   "email_verified_at": ISODate, // Only set once verified
 	//   "created_at": ISODate,
 	//   "updated_at": ISODate
 	// }
@@ -119,29 +176,34 @@ func createListCollection(db *mongo.Database) error {
 	// Create indexes for List collection
 	indexes := []mongo.IndexModel{
 		{
-			Keys:    bson.D{{"user_id", 1}},
+			Keys:    bson.D{{Key: "user_id", Value: 1}},
 			Options: options.Index().SetName("user_id_idx"),
 		},
 		{
-			Keys:    bson.D{{"created_at", 1}},
+			Keys:    bson.D{{Key: "created_at", Value: 1}},
 			Options: options.Index().SetName("created_at_idx"),
 		},
 		{
-			Keys:    bson.D{{"shared_with", 1}},
-			Options: options.Index().SetName("shared_with_idx"),
+			Keys:    bson.D{{Key: "shared_with.user_id", Value: 1}},
+			Options: options.Index().SetName("shared_with_user_id_idx"),
 		},
 		{
-			Keys:    bson.D{{"user_id", 1}, {"created_at", -1}},
+			Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}},
 			Options: options.Index().SetName("user_id_created_at_idx"),
 		},
 	}
 
+	// The shared_with index now covers collaborator user IDs instead
+	if err := dropIndexIfExists(ctx, collection, "shared_with_idx"); err != nil {
+		return err
+	}
+
 	_, err := collection.Indexes().CreateMany(ctx, indexes)
 	if err != nil {
 		return fmt.Errorf("failed to create indexes: %w", err)
 	}
 
-	fmt.Println("✓ List collection created with indexes (user_id, created_at, shared_with, user_id+created_at)")
+	fmt.Println("✓ List collection created with indexes (user_id, created_at, shared_with.user_id, user_id+created_at)")
 
 	// Create a sample document structure comment (optional - for documentation)
 	// List document structure:
@@ -152,6 +214,7 @@ func createListCollection(db *mongo.Database) error {
 	//   "description": "Weekly shopping list",
 	//   "items": [
 	//     {
+	//       "_id": ObjectId,
 	//       "name": "Milk",
 	//       "quantity": 1,
 	//       "unit": "gallon",
@@ -160,7 +223,13 @@ func createListCollection(db *mongo.Database) error {
 	//       "added_at": ISODate
 	//     }
 	//   ],
-	//   "shared_with": [ObjectId], // Array of user IDs who have access
+	//   "shared_with": [
+	//     {
+	//       "user_id": ObjectId,
+	//       "role": "editor" // "editor" or "viewer"; the owner is user_id above
+	//     }
+	//   ],
+	//   "version": 1, // Incremented on every write, exposed as the ETag
 	//   "created_at": ISODate,
 	//   "updated_at": ISODate
 	// }
@@ -168,3 +237,396 @@ func createListCollection(db *mongo.Database) error {
 	return nil
 }
 
+func createInviteCollection(db *mongo.Database) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	collection := db.Collection("invites")
+
+	// Create indexes for Invite collection
+	indexes := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "token_hash", Value: 1}},
+			Options: options.Index().SetUnique(true).SetName("token_hash_unique"),
+		},
+		{
+			Keys:    bson.D{{Key: "list_id", Value: 1}, {Key: "created_at", Value: -1}},
+			Options: options.Index().SetName("list_id_created_at_idx"),
+		},
+		{
+			// Clean up invites a week after they expire
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(7 * 24 * 60 * 60).SetName("expires_at_ttl"),
+		},
+	}
+
+	_, err := collection.Indexes().CreateMany(ctx, indexes)
+	if err != nil {
+		return fmt.Errorf("failed to create indexes: %w", err)
+	}
+
+	fmt.Println("✓ Invite collection created with indexes (token_hash, list_id+created_at, expires_at TTL)")
+
+	// Invite document structure:
+	// {
+	//   "_id": ObjectId,
+	//   "list_id": ObjectId,
+	//   "token_hash": "sha256 hex of the invite token",
+	//   "created_by": ObjectId,
+	//   "role": "editor", // Role granted to users who redeem the invite
+	//   "max_uses": 1, // 0 means unlimited
+	//   "uses": 0,
+	//   "expires_at": ISODate,
+	//   "revoked_at": ISODate, // Only set once revoked
+	//   "created_at": ISODate
+	// }
+
+	return nil
+}
+
+func createSessionCollection(db *mongo.Database) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	collection := db.Collection("sessions")
+
+	// Create indexes for Session collection
+	indexes := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "refresh_token_hash", Value: 1}},
+			Options: options.Index().SetUnique(true).SetName("refresh_token_hash_unique"),
+		},
+		{
+			// Used to detect replay of any rotated refresh token
+			Keys:    bson.D{{Key: "previous_token_hashes", Value: 1}},
+			Options: options.Index().SetSparse(true).SetName("previous_token_hashes_idx"),
+		},
+		{
+			Keys:    bson.D{{Key: "user_id", Value: 1}},
+			Options: options.Index().SetName("user_id_idx"),
+		},
+		{
+			// Clean up sessions a week after they expire
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(7 * 24 * 60 * 60).SetName("expires_at_ttl"),
+		},
+	}
+
+	_, err := collection.Indexes().CreateMany(ctx, indexes)
+	if err != nil {
+		return fmt.Errorf("failed to create indexes: %w", err)
+	}
+
+	fmt.Println("✓ Session collection created with indexes (refresh_token_hash, previous_token_hashes, user_id, expires_at TTL)")
+
+	// Session document structure:
+	// {
+	//   "_id": ObjectId, // Carried in access tokens as the "sid" claim
+	//   "user_id": ObjectId,
+	//   "refresh_token_hash": "sha256 hex of the current refresh token",
+	//   "previous_token_hashes": ["sha256 hex of each rotated refresh token, oldest first"],
+	//   "user_agent": "Mozilla/5.0 ...",
+	//   "created_at": ISODate,
+	//   "last_used_at": ISODate,
+	//   "expires_at": ISODate, // Extended on every refresh
+	//   "revoked_at": ISODate // Only set once logged out
+	// }
+
+	return nil
+}
+
+func createPasswordResetCollection(db *mongo.Database) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	collection := db.Collection("password_resets")
+
+	// Create indexes for PasswordReset collection
+	indexes := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "token_hash", Value: 1}},
+			Options: options.Index().SetUnique(true).SetName("token_hash_unique"),
+		},
+		{
+			Keys:    bson.D{{Key: "user_id", Value: 1}},
+			Options: options.Index().SetName("user_id_idx"),
+		},
+		{
+			// Reset tokens are short-lived; clean them up a day after they expire
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(24 * 60 * 60).SetName("expires_at_ttl"),
+		},
+	}
+
+	_, err := collection.Indexes().CreateMany(ctx, indexes)
+	if err != nil {
+		return fmt.Errorf("failed to create indexes: %w", err)
+	}
+
+	fmt.Println("✓ PasswordReset collection created with indexes (token_hash, user_id, expires_at TTL)")
+
+	// PasswordReset document structure:
+	// {
+	//   "_id": ObjectId,
+	//   "user_id": ObjectId,
+	//   "token_hash": "sha256 hex of the emailed token",
+	//   "expires_at": ISODate,
+	//   "used_at": ISODate, // Only set once redeemed or superseded
+	//   "created_at": ISODate
+	// }
+
+	return nil
+}
+
+func createEmailVerificationCollection(db *mongo.Database) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	collection := db.Collection("email_verifications")
+
+	// Create indexes for EmailVerification collection
+	indexes := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "token_hash", Value: 1}},
+			Options: options.Index().SetUnique(true).SetName("token_hash_unique"),
+		},
+		{
+			Keys:    bson.D{{Key: "user_id", Value: 1}},
+			Options: options.Index().SetName("user_id_idx"),
+		},
+		{
+			// Clean up verification tokens a day after they expire
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(24 * 60 * 60).SetName("expires_at_ttl"),
+		},
+	}
+
+	_, err := collection.Indexes().CreateMany(ctx, indexes)
+	if err != nil {
+		return fmt.Errorf("failed to create indexes: %w", err)
+	}
+
+	fmt.Println("✓ EmailVerification collection created with indexes (token_hash, user_id, expires_at TTL)")
+
+	// EmailVerification document structure:
+	// {
+	//   "_id": ObjectId,
+	//   "user_id": ObjectId,
+	//   "email": "user@example.com", // The address the link was sent to
+	//   "token_hash": "sha256 hex of the emailed token",
+	//   "expires_at": ISODate,
+	//   "used_at": ISODate, // Only set once redeemed or superseded
+	//   "created_at": ISODate
+	// }
+
+	return nil
+}
+
+func createRateLimitCollections(db *mongo.Database) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Both collections are keyed by _id and only need their expired documents removed
+	ttl := mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0).SetName("expires_at_ttl"),
+	}
+
+	if _, err := db.Collection("rate_limit_buckets").Indexes().CreateOne(ctx, ttl); err != nil {
+		return fmt.Errorf("failed to create rate_limit_buckets indexes: %w", err)
+	}
+	if _, err := db.Collection("lockouts").Indexes().CreateOne(ctx, ttl); err != nil {
+		return fmt.Errorf("failed to create lockouts indexes: %w", err)
+	}
+
+	fmt.Println("✓ RateLimitBucket and Lockout collections created with indexes (expires_at TTL)")
+
+	// RateLimitBucket document structure:
+	// {
+	//   "_id": "signin:ip:203.0.113.7", // Limit name and key
+	//   "tokens": 4.5, // Tokens left as of updated_at
+	//   "allowed": true, // Whether the last request took a token
+	//   "updated_at": ISODate,
+	//   "expires_at": ISODate // When the bucket is full again
+	// }
+
+	// Lockout document structure:
+	// {
+	//   "_id": "signin:user@example.com",
+	//   "failures": 6, // Consecutive failed attempts
+	//   "locked_until": ISODate, // Only set once the threshold is reached
+	//   "expires_at": ISODate // When the failures are forgotten
+	// }
+
+	return nil
+}
+
+func backfillEmailVerified(db *mongo.Database) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	collection := db.Collection("users")
+
+	result, err := collection.UpdateMany(
+		ctx,
+		bson.M{"email_verified": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"email_verified": true}},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to set email_verified: %w", err)
+	}
+
+	fmt.Printf("✓ Marked %d existing user(s) as verified\n", result.ModifiedCount)
+
+	return nil
+}
+
+func backfillListItemIDs(db *mongo.Database) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	collection := db.Collection("lists")
+
+	// Only lists containing at least one item without an _id need updating
+	filter := bson.M{"items": bson.M{"$elemMatch": bson.M{"_id": bson.M{"$exists": false}}}}
+
+	cursor, err := collection.Find(ctx, filter)
+	if err != nil {
+		return fmt.Errorf("failed to find lists: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	updated := 0
+	for cursor.Next(ctx) {
+		var list models.List
+		if err := cursor.Decode(&list); err != nil {
+			return fmt.Errorf("failed to decode list: %w", err)
+		}
+
+		for i := range list.Items {
+			if list.Items[i].ID.IsZero() {
+				list.Items[i].ID = primitive.NewObjectID()
+			}
+		}
+
+		_, err := collection.UpdateOne(
+			ctx,
+			bson.M{"_id": list.ID},
+			bson.M{"$set": bson.M{"items": list.Items}},
+		)
+		if err != nil {
+			return fmt.Errorf("failed to update list %s: %w", list.ID.Hex(), err)
+		}
+		updated++
+	}
+	if err := cursor.Err(); err != nil {
+		return fmt.Errorf("failed to iterate lists: %w", err)
+	}
+
+	fmt.Printf("✓ Backfilled item IDs on %d list(s)\n", updated)
+
+	return nil
+}
+
+func backfillListVersions(db *mongo.Database) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	collection := db.Collection("lists")
+
+	result, err := collection.UpdateMany(
+		ctx,
+		bson.M{"version": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"version": 1}},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to set list versions: %w", err)
+	}
+
+	fmt.Printf("✓ Initialized version on %d list(s)\n", result.ModifiedCount)
+
+	return nil
+}
+
+func dropIndexIfExists(ctx context.Context, collection *mongo.Collection, name string) error {
+	specs, err := collection.Indexes().ListSpecifications(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list indexes: %w", err)
+	}
+
+	for _, spec := range specs {
+		if spec.Name == name {
+			if err := collection.Indexes().DropOne(ctx, name); err != nil {
+				return fmt.Errorf("failed to drop index %s: %w", name, err)
+			}
+			fmt.Printf("✓ Dropped index %s\n", name)
+		}
+	}
+
+	return nil
+}
+
+func migrateSharedWithRoles(db *mongo.Database) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	lists := db.Collection("lists")
+
+	// Legacy lists store shared_with as a plain array of user IDs
+	filter := bson.M{
+		"shared_with.0":       bson.M{"$exists": true},
+		"shared_with.user_id": bson.M{"$exists": false},
+	}
+
+	cursor, err := lists.Find(ctx, filter)
+	if err != nil {
+		return fmt.Errorf("failed to find lists: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	updated := 0
+	for cursor.Next(ctx) {
+		var legacy struct {
+			ID         primitive.ObjectID   `bson:"_id"`
+			SharedWith []primitive.ObjectID `bson:"shared_with"`
+		}
+		if err := cursor.Decode(&legacy); err != nil {
+			return fmt.Errorf("failed to decode list: %w", err)
+		}
+
+		// Everyone a list was shared with could previously edit it
+		collaborators := make([]models.Collaborator, len(legacy.SharedWith))
+		for i, userID := range legacy.SharedWith {
+			collaborators[i] = models.Collaborator{UserID: userID, Role: models.RoleEditor}
+		}
+
+		_, err := lists.UpdateOne(
+			ctx,
+			bson.M{"_id": legacy.ID},
+			bson.M{"$set": bson.M{"shared_with": collaborators}},
+		)
+		if err != nil {
+			return fmt.Errorf("failed to update list %s: %w", legacy.ID.Hex(), err)
+		}
+		updated++
+	}
+	if err := cursor.Err(); err != nil {
+		return fmt.Errorf("failed to iterate lists: %w", err)
+	}
+
+	fmt.Printf("✓ Converted shared_with to collaborator roles on %d list(s)\n", updated)
+
+	// Invites minted before roles existed grant editor access
+	result, err := db.Collection("invites").UpdateMany(
+		ctx,
+		bson.M{"role": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"role": models.RoleEditor}},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to set invite roles: %w", err)
+	}
+
+	fmt.Printf("✓ Set role on %d invite(s)\n", result.ModifiedCount)
+
+	return nil
+}
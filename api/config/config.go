@@ -1,45 +1,237 @@
 package config
 
 import (
-	"log"
-	"os"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
 
-	"github.com/joho/godotenv"
-	"go.mongodb.org/mongo-driver/v2/mongo"
+	"bryce-stabenow/grocer-me/store"
 )
 
-var (
-	JWTSecret   string
-	MongoClient *mongo.Client
-	DB          *mongo.Database
+// Features that can be withheld from users until they verify their email
+const (
+	// FeatureSharing covers inviting others to a list and joining shared lists
+	FeatureSharing = "sharing"
+	// FeatureCreateLists covers creating new lists
+	FeatureCreateLists = "create-lists"
 )
 
-func Init() {
-	// Load .env file from project root (ignore error if it doesn't exist)
-	_ = godotenv.Load("../.env")
+// Config holds every setting the API reads at startup. Each setting has a
+// default, and can be overridden in turn by a YAML or TOML config file (keys
+// as in the yaml tags), the environment variable in its env tag and a
+// command-line flag named after its key, e.g. --server.port.
+type Config struct {
+	// AppURL is the base URL of the web app, used in links sent by email
+	AppURL string `yaml:"app_url" env:"APP_URL"`
 
-	// Load JWT secret
-	JWTSecret = os.Getenv("JWT_SECRET")
-	if JWTSecret == "" {
-		log.Fatal("JWT_SECRET environment variable is not set. Please create a .env file or set the environment variable.")
-	}
+	Server   ServerConfig   `yaml:"server"`
+	Database DatabaseConfig `yaml:"database"`
+	Auth     AuthConfig     `yaml:"auth"`
+	CORS     CORSConfig     `yaml:"cors"`
+	Mail     MailConfig     `yaml:"mail"`
+	Log      LogConfig      `yaml:"log"`
+	Features FeatureConfig  `yaml:"features"`
+}
+
+// ServerConfig configures the HTTP server
+type ServerConfig struct {
+	Port              int           `yaml:"port" env:"PORT"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" env:"READ_HEADER_TIMEOUT"`
+	ReadTimeout       time.Duration `yaml:"read_timeout" env:"READ_TIMEOUT"`
+	WriteTimeout      time.Duration `yaml:"write_timeout" env:"WRITE_TIMEOUT"` // Event streams are exempt
+	IdleTimeout       time.Duration `yaml:"idle_timeout" env:"IDLE_TIMEOUT"`
+	// EventHeartbeat is how often idle event streams send a keep-alive and
+	// recheck that the subscriber may still see the list
+	EventHeartbeat time.Duration `yaml:"event_heartbeat" env:"EVENT_HEARTBEAT"`
+	// ShutdownTimeout bounds how long shutdown waits for requests and
+	// background work to finish
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT"`
+	// ClientIPHeader names the header a trusted proxy puts the client IP in;
+	// if empty, the connection's remote address is used
+	ClientIPHeader string `yaml:"client_ip_header" env:"CLIENT_IP_HEADER"`
+	// DebugRoutes prints every route and its middleware chain at startup
+	DebugRoutes bool `yaml:"debug_routes" env:"DEBUG_ROUTES"`
+}
+
+// DatabaseConfig selects and configures storage
+type DatabaseConfig struct {
+	// Backend selects the storage implementation ("mongo" or "memory")
+	Backend string `yaml:"backend" env:"STORE_BACKEND"`
+	URI     string `yaml:"uri" env:"MONGODB_URI" secret:"password"`
+	Name    string `yaml:"name" env:"MONGODB_DATABASE"`
+	// Timeout bounds each store operation made while handling a request
+	Timeout time.Duration `yaml:"timeout" env:"STORE_TIMEOUT"`
+}
+
+// AuthConfig configures tokens, auth cookies and protection against
+// credential guessing
+type AuthConfig struct {
+	JWTSecret string `yaml:"jwt_secret" env:"JWT_SECRET" secret:"true"`
+	// AccessTokenTTL is how long an access token is valid; clients refresh it
+	AccessTokenTTL time.Duration `yaml:"access_token_ttl" env:"ACCESS_TOKEN_TTL"`
+	// RefreshTokenTTL is how long a session survives without being refreshed
+	RefreshTokenTTL time.Duration `yaml:"refresh_token_ttl" env:"REFRESH_TOKEN_TTL"`
+	// RefreshReuseGrace tolerates concurrent refreshes (e.g. two open tabs)
+	// presenting the token that was rotated moments ago; 0 revokes on any reuse
+	RefreshReuseGrace time.Duration `yaml:"refresh_reuse_grace" env:"REFRESH_REUSE_GRACE" allow_zero:"true"`
+	// Attributes of the auth cookies; SameSite=None is needed when the web app
+	// and API are on different sites, and requires Secure. Secure defaults to
+	// whether AppURL is HTTPS.
+	CookieSecure   *bool  `yaml:"cookie_secure" env:"COOKIE_SECURE"`
+	CookieSameSite string `yaml:"cookie_same_site" env:"COOKIE_SAME_SITE"`
+	// Rate limits on signing in, signing up and password resets, per client
+	// IP and per email
+	RateLimitIP    store.RateLimit `yaml:"rate_limit_ip" env:"RATE_LIMIT_AUTH_IP"`
+	RateLimitEmail store.RateLimit `yaml:"rate_limit_email" env:"RATE_LIMIT_AUTH_EMAIL"`
+	// RateLimitResend limits how often each user can have their verification
+	// email resent
+	RateLimitResend store.RateLimit `yaml:"rate_limit_resend" env:"RATE_LIMIT_RESEND"`
+	Lockout         LockoutConfig   `yaml:"lockout"`
+}
+
+// LockoutConfig locks an account out of signing in after repeated failures
+type LockoutConfig struct {
+	Threshold int           `yaml:"threshold" env:"LOCKOUT_THRESHOLD"`
+	Base      time.Duration `yaml:"base" env:"LOCKOUT_BASE"`
+	Max       time.Duration `yaml:"max" env:"LOCKOUT_MAX"`
+	Window    time.Duration `yaml:"window" env:"LOCKOUT_WINDOW"`
+}
+
+// CORSConfig lists the origins that may make credentialed cross-origin
+// requests and what they may send. AllowedOrigins defaults to AppURL.
+type CORSConfig struct {
+	AllowedOrigins []string      `yaml:"allowed_origins" env:"CORS_ALLOWED_ORIGINS"` // Exact origins, or "https://*.example.com" for any subdomain
+	AllowedMethods []string      `yaml:"allowed_methods" env:"CORS_ALLOWED_METHODS"`
+	AllowedHeaders []string      `yaml:"allowed_headers" env:"CORS_ALLOWED_HEADERS"`
+	ExposedHeaders []string      `yaml:"exposed_headers" env:"CORS_EXPOSED_HEADERS"`
+	MaxAge         time.Duration `yaml:"max_age" env:"CORS_MAX_AGE"`
+}
+
+// MailConfig configures outgoing email
+type MailConfig struct {
+	// Backend selects how email is delivered ("log" or "smtp")
+	Backend string `yaml:"backend" env:"MAIL_BACKEND"`
+	From    string `yaml:"from" env:"MAIL_FROM"`
+	// LogFile is where the log mailer writes messages (stdout if empty)
+	LogFile string `yaml:"log_file" env:"MAIL_LOG_FILE"`
+	// SMTP server settings, used when Backend is "smtp"
+	SMTPHost     string `yaml:"smtp_host" env:"SMTP_HOST"`
+	SMTPPort     string `yaml:"smtp_port" env:"SMTP_PORT"`
+	SMTPUsername string `yaml:"smtp_username" env:"SMTP_USERNAME"`
+	SMTPPassword string `yaml:"smtp_password" env:"SMTP_PASSWORD" secret:"true"`
+}
 
-	// MongoDB client should be set by main.go after connection
+// LogConfig configures logging and tracing
+type LogConfig struct {
+	// Format selects the log output format ("text" or "json")
+	Format string     `yaml:"format" env:"LOG_FORMAT"`
+	Level  slog.Level `yaml:"level" env:"LOG_LEVEL"`
+	// TraceExporter selects where spans are sent ("none", "stdout" or "otlp")
+	TraceExporter string `yaml:"trace_exporter" env:"TRACE_EXPORTER"`
 }
 
-func SetMongoClient(client *mongo.Client) {
-	MongoClient = client
-	DB = client.Database("grocer-me")
+// FeatureConfig toggles features
+type FeatureConfig struct {
+	// UnverifiedRestrictions lists the features unverified users can't use,
+	// or is just "none"
+	UnverifiedRestrictions []string `yaml:"unverified_restrictions" env:"UNVERIFIED_RESTRICTIONS"`
 }
 
-func GetMongoURI() string {
-	// Try to load .env file from project root (ignore error if it doesn't exist)
-	_ = godotenv.Load("../.env")
+// Default returns the configuration used when nothing overrides it
+func Default() *Config {
+	return &Config{
+		AppURL: "http://localhost:3000",
+		Server: ServerConfig{
+			Port:              8080,
+			ReadHeaderTimeout: 5 * time.Second,
+			ReadTimeout:       15 * time.Second,
+			WriteTimeout:      30 * time.Second,
+			IdleTimeout:       2 * time.Minute,
+			EventHeartbeat:    25 * time.Second,
+			ShutdownTimeout:   20 * time.Second,
+		},
+		Database: DatabaseConfig{
+			Backend: "mongo",
+			Name:    "grocer-me",
+			Timeout: 10 * time.Second,
+		},
+		Auth: AuthConfig{
+			AccessTokenTTL:    15 * time.Minute,
+			RefreshTokenTTL:   30 * 24 * time.Hour,
+			RefreshReuseGrace: 30 * time.Second,
+			CookieSameSite:    "lax",
+			RateLimitIP:       store.RateLimit{Requests: 20, Per: time.Minute},
+			RateLimitEmail:    store.RateLimit{Requests: 5, Per: time.Minute},
+			RateLimitResend:   store.RateLimit{Requests: 3, Per: time.Hour},
+			Lockout: LockoutConfig{
+				Threshold: 5,
+				Base:      time.Minute,
+				Max:       time.Hour,
+				Window:    24 * time.Hour,
+			},
+		},
+		CORS: CORSConfig{
+			AllowedMethods: []string{"GET", "POST", "PUT", "PATCH", "DELETE"},
+			AllowedHeaders: []string{"Content-Type", "Authorization", "X-Requested-With", "If-Match", "X-Request-ID", "X-CSRF-Token"},
+			ExposedHeaders: []string{"ETag", "X-Request-ID", "Retry-After", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "RateLimit-Policy"},
+			MaxAge:         time.Hour,
+		},
+		Mail: MailConfig{
+			Backend:  "log",
+			From:     "no-reply@grocer.me",
+			SMTPPort: "587",
+		},
+		Log: LogConfig{
+			Format:        "text",
+			Level:         slog.LevelInfo,
+			TraceExporter: "none",
+		},
+		Features: FeatureConfig{
+			UnverifiedRestrictions: []string{FeatureSharing},
+		},
+	}
+}
 
-	uri := os.Getenv("MONGODB_URI")
-	if uri == "" {
-		log.Fatal("MONGODB_URI environment variable is not set. Please create a .env file or set the environment variable.")
+// resolve fills in defaults that depend on other settings
+func (c *Config) resolve() {
+	if len(c.CORS.AllowedOrigins) == 0 {
+		c.CORS.AllowedOrigins = []string{c.AppURL}
+	}
+	if c.Auth.CookieSecure == nil {
+		secure := strings.HasPrefix(c.AppURL, "https://")
+		c.Auth.CookieSecure = &secure
 	}
-	return uri
 }
 
+// Secure reports whether auth cookies are sent only over HTTPS
+func (a AuthConfig) Secure() bool {
+	return a.CookieSecure != nil && *a.CookieSecure
+}
+
+// SameSite returns the SameSite attribute for auth cookies
+func (a AuthConfig) SameSite() http.SameSite {
+	switch a.CookieSameSite {
+	case "strict":
+		return http.SameSiteStrictMode
+	case "none":
+		return http.SameSiteNoneMode
+	default:
+		return http.SameSiteLaxMode
+	}
+}
+
+// Policy returns the lockout policy for failed sign-ins
+func (l LockoutConfig) Policy() store.LockoutPolicy {
+	return store.LockoutPolicy{Threshold: l.Threshold, Base: l.Base, Max: l.Max, Window: l.Window}
+}
+
+// Restricted reports whether users must verify their email to use a feature
+func (f FeatureConfig) Restricted(feature string) bool {
+	for _, restricted := range f.UnverifiedRestrictions {
+		if restricted == feature {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,274 @@
+package config
+
+import (
+	"encoding"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"go.yaml.in/yaml/v3"
+)
+
+// setting is one leaf of a Config: a field with an env tag
+type setting struct {
+	key       string // Dotted path of yaml keys, e.g. "server.port"
+	env       string
+	secret    string // "true" to hide the value when printing, "password" to hide a URL's password
+	allowZero bool   // Durations must be positive unless zero turns the feature off
+	value     reflect.Value
+}
+
+// Load reads the configuration from, in increasing precedence, the defaults,
+// the YAML or TOML file named by --config or CONFIG_FILE, the environment
+// and the flags in args. It registers a flag for every setting on flags,
+// alongside any the caller defined, and parses args with it.
+//
+// Load only reports values that can't be parsed; call Validate to check the
+// result makes sense.
+func Load(flags *flag.FlagSet, args []string, getenv func(string) string) (*Config, error) {
+	cfg := Default()
+	settings := cfg.settings()
+
+	// Flags are parsed first to find the config file, but applied last
+	configFile := flags.String("config", getenv("CONFIG_FILE"), "path to a YAML or TOML config file (or $CONFIG_FILE)")
+	var overrides []func() error
+	for _, s := range settings {
+		apply := func(text string) error {
+			overrides = append(overrides, func() error { return s.set("--"+s.key, text) })
+			return nil
+		}
+		usage := "overrides $" + s.env
+		if s.isBool() {
+			flags.BoolFunc(s.key, usage, apply)
+		} else {
+			flags.Func(s.key, usage, apply)
+		}
+	}
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+
+	var errs []error
+	if *configFile != "" {
+		errs = append(errs, loadFile(*configFile, settings)...)
+	}
+	for _, s := range settings {
+		if text := getenv(s.env); text != "" {
+			errs = append(errs, s.set("$"+s.env, text))
+		}
+	}
+	for _, override := range overrides {
+		errs = append(errs, override())
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	cfg.resolve()
+	return cfg, nil
+}
+
+// loadFile applies the settings in a YAML or TOML file, chosen by extension
+func loadFile(path string, settings []setting) []error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return []error{fmt.Errorf("failed to read config file: %w", err)}
+	}
+
+	raw := make(map[string]interface{})
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &raw)
+	case ".toml":
+		_, err = toml.Decode(string(data), &raw)
+	default:
+		return []error{fmt.Errorf("config file %s must end in .yaml, .yml or .toml", path)}
+	}
+	if err != nil {
+		return []error{fmt.Errorf("failed to parse config file %s: %w", path, err)}
+	}
+
+	values := make(map[string]string)
+	flatten("", raw, values)
+
+	var errs []error
+	for _, s := range settings {
+		if text, ok := values[s.key]; ok {
+			errs = append(errs, s.set(path, text))
+			delete(values, s.key)
+		}
+	}
+
+	// Anything left over is a typo or a setting that no longer exists
+	unknown := make([]string, 0, len(values))
+	for key := range values {
+		unknown = append(unknown, key)
+	}
+	sort.Strings(unknown)
+	for _, key := range unknown {
+		errs = append(errs, fmt.Errorf("%s (from %s): unknown setting", key, path))
+	}
+	return errs
+}
+
+// flatten collects the scalar values in a decoded file by dotted key, joining
+// lists with commas as they would be written in the environment
+func flatten(prefix string, raw map[string]interface{}, values map[string]string) {
+	for key, value := range raw {
+		key = prefix + key
+		switch value := value.(type) {
+		case map[string]interface{}:
+			flatten(key+".", value, values)
+		case []interface{}:
+			items := make([]string, len(value))
+			for i, item := range value {
+				items[i] = fmt.Sprint(item)
+			}
+			values[key] = strings.Join(items, ",")
+		case nil:
+			// An empty key leaves the setting alone
+		default:
+			values[key] = fmt.Sprint(value)
+		}
+	}
+}
+
+// settings lists the configuration's leaf settings, with values that can be set
+func (c *Config) settings() []setting {
+	return collectSettings(reflect.ValueOf(c).Elem(), "")
+}
+
+func collectSettings(v reflect.Value, prefix string) []setting {
+	var settings []setting
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		key, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		if key == "" || key == "-" {
+			continue
+		}
+
+		env, ok := field.Tag.Lookup("env")
+		if !ok {
+			settings = append(settings, collectSettings(v.Field(i), prefix+key+".")...)
+			continue
+		}
+		settings = append(settings, setting{
+			key:       prefix + key,
+			env:       env,
+			secret:    field.Tag.Get("secret"),
+			allowZero: field.Tag.Get("allow_zero") == "true",
+			value:     v.Field(i),
+		})
+	}
+	return settings
+}
+
+// set parses text into the setting, naming source in any error
+func (s setting) set(source, text string) error {
+	if err := parseValue(s.value, text); err != nil {
+		return fmt.Errorf("%s (from %s): %w", s.key, source, err)
+	}
+	return nil
+}
+
+// isBool reports whether the setting is a flag that needs no value
+func (s setting) isBool() bool {
+	t := s.value.Type()
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Bool
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// parseValue parses text into v according to v's type
+func parseValue(v reflect.Value, text string) error {
+	if u, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(text))
+	}
+
+	switch {
+	case v.Type() == durationType:
+		d, err := time.ParseDuration(text)
+		if err != nil {
+			return fmt.Errorf("must be a duration such as \"15s\", got %q", text)
+		}
+		v.SetInt(int64(d))
+	case v.Kind() == reflect.Pointer:
+		elem := reflect.New(v.Type().Elem())
+		if err := parseValue(elem.Elem(), text); err != nil {
+			return err
+		}
+		v.Set(elem)
+	case v.Kind() == reflect.String:
+		v.SetString(text)
+	case v.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(text)
+		if err != nil {
+			return fmt.Errorf("must be true or false, got %q", text)
+		}
+		v.SetBool(b)
+	case v.Kind() == reflect.Int:
+		n, err := strconv.Atoi(text)
+		if err != nil {
+			return fmt.Errorf("must be a whole number, got %q", text)
+		}
+		v.SetInt(int64(n))
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.String:
+		v.Set(reflect.ValueOf(splitList(text)))
+	default:
+		panic("config: unsupported setting type " + v.Type().String())
+	}
+	return nil
+}
+
+// splitList splits a comma-separated list, dropping empty items
+func splitList(text string) []string {
+	list := []string{}
+	for _, item := range strings.Split(text, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// Print writes the configuration as YAML, usable as a config file, with
+// secrets redacted
+func (c *Config) Print(w io.Writer) error {
+	redacted := *c
+	for _, s := range redacted.settings() {
+		if s.secret == "" || s.value.String() == "" {
+			continue
+		}
+		switch value := s.value.String(); s.secret {
+		case "true":
+			s.value.SetString("REDACTED")
+		case "password":
+			u, err := url.Parse(value)
+			if err != nil {
+				s.value.SetString("REDACTED")
+			} else {
+				s.value.SetString(u.Redacted())
+			}
+		}
+	}
+
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&redacted); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
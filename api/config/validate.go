@@ -0,0 +1,141 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Validate checks that the settings make sense together, reporting every
+// problem found. Each is named by its config key and environment variable.
+func (c *Config) Validate() error {
+	v := &validator{names: make(map[string]string)}
+	for _, s := range c.settings() {
+		v.names[s.key] = fmt.Sprintf("%s ($%s)", s.key, s.env)
+
+		if s.value.Type() == durationType {
+			switch {
+			case s.allowZero && s.value.Int() < 0:
+				v.problem(s.key, "must be zero or a positive duration such as \"15s\", got %q", s.value.Interface())
+			case !s.allowZero && s.value.Int() <= 0:
+				v.problem(s.key, "must be a positive duration such as \"15s\", got %q", s.value.Interface())
+			}
+		}
+	}
+
+	if u, err := url.Parse(c.AppURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		v.problem("app_url", "must be an http or https URL, got %q", c.AppURL)
+	}
+
+	if c.Server.Port < 1 || c.Server.Port > 65535 {
+		v.problem("server.port", "must be between 1 and 65535, got %d", c.Server.Port)
+	}
+
+	v.oneOf("database.backend", c.Database.Backend, "mongo", "memory")
+	if c.Database.Backend == "mongo" {
+		if c.Database.URI == "" {
+			v.problem("database.uri", "must be set when database.backend is \"mongo\"")
+		}
+		if c.Database.Name == "" {
+			v.problem("database.name", "must be set when database.backend is \"mongo\"")
+		}
+	}
+
+	if c.Auth.JWTSecret == "" {
+		v.problem("auth.jwt_secret", "must be set; put JWT_SECRET in the environment or a .env file")
+	}
+	if c.Auth.RefreshTokenTTL <= c.Auth.AccessTokenTTL {
+		v.problem("auth.refresh_token_ttl", "must be longer than auth.access_token_ttl (%s), got %s", c.Auth.AccessTokenTTL, c.Auth.RefreshTokenTTL)
+	}
+	v.oneOf("auth.cookie_same_site", c.Auth.CookieSameSite, "lax", "strict", "none")
+	if c.Auth.CookieSameSite == "none" && !c.Auth.Secure() {
+		v.problem("auth.cookie_same_site", "can only be \"none\" when auth.cookie_secure is true")
+	}
+	if c.Auth.Lockout.Threshold < 1 {
+		v.problem("auth.lockout.threshold", "must be at least 1, got %d", c.Auth.Lockout.Threshold)
+	}
+	if c.Auth.Lockout.Base > c.Auth.Lockout.Max {
+		v.problem("auth.lockout.base", "must not be longer than auth.lockout.max (%s), got %s", c.Auth.Lockout.Max, c.Auth.Lockout.Base)
+	}
+
+	for _, origin := range c.CORS.AllowedOrigins {
+		if err := validateOrigin(origin); err != nil {
+			v.problem("cors.allowed_origins", "%v", err)
+		}
+	}
+
+	v.oneOf("mail.backend", c.Mail.Backend, "log", "smtp")
+	if c.Mail.Backend == "smtp" && c.Mail.SMTPHost == "" {
+		v.problem("mail.smtp_host", "must be set when mail.backend is \"smtp\"")
+	}
+
+	v.oneOf("log.format", c.Log.Format, "text", "json")
+	v.oneOf("log.trace_exporter", c.Log.TraceExporter, "none", "stdout", "otlp")
+
+	restrictions := c.Features.UnverifiedRestrictions
+	if len(restrictions) != 1 || restrictions[0] != "none" {
+		for _, feature := range restrictions {
+			if feature != FeatureSharing && feature != FeatureCreateLists {
+				v.problem("features.unverified_restrictions", "must be \"none\" or a list of %q and %q, got %q", FeatureSharing, FeatureCreateLists, feature)
+			}
+		}
+	}
+
+	return errors.Join(v.problems...)
+}
+
+// validator collects configuration problems
+type validator struct {
+	names    map[string]string
+	problems []error
+}
+
+// problem records that the setting with the given key is invalid
+func (v *validator) problem(key, format string, args ...interface{}) {
+	v.problems = append(v.problems, fmt.Errorf("%s %s", v.names[key], fmt.Sprintf(format, args...)))
+}
+
+// oneOf checks that a setting has one of the allowed values
+func (v *validator) oneOf(key, value string, allowed ...string) {
+	for _, a := range allowed {
+		if value == a {
+			return
+		}
+	}
+	v.problem(key, "must be %s, got %q", quoteList(allowed), value)
+}
+
+// quoteList formats values as `"a", "b" or "c"`
+func quoteList(values []string) string {
+	quoted := make([]string, len(values))
+	for i, value := range values {
+		quoted[i] = fmt.Sprintf("%q", value)
+	}
+	if len(quoted) == 1 {
+		return quoted[0]
+	}
+	return strings.Join(quoted[:len(quoted)-1], ", ") + " or " + quoted[len(quoted)-1]
+}
+
+// validateOrigin checks that an allowed origin is a bare scheme and host, such
+// as "https://grocer.me", optionally with a leading "*." wildcard label
+func validateOrigin(origin string) error {
+	invalid := fmt.Errorf("must be origins such as \"https://grocer.me\" or \"https://*.grocer.me\", got %q", origin)
+
+	// A wildcard may only stand for the leftmost labels of the host
+	candidate := origin
+	if strings.Count(origin, "*") > 0 {
+		if strings.Count(origin, "*") > 1 || !strings.Contains(origin, "://*.") {
+			return invalid
+		}
+		candidate = strings.Replace(origin, "://*.", "://wildcard.", 1)
+	}
+
+	u, err := url.Parse(candidate)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" ||
+		u.Path != "" || u.RawQuery != "" || u.Fragment != "" || u.User != nil {
+		return invalid
+	}
+	return nil
+}
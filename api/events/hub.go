@@ -0,0 +1,235 @@
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+// Event types published for list changes
+const (
+	ItemAdded   = "item-added"
+	ItemUpdated = "item-updated"
+	ItemChecked = "item-checked"
+	ItemDeleted = "item-deleted"
+	ListRenamed = "list-renamed"
+	// MembersChanged is published when collaborators or the owner change
+	MembersChanged = "members-changed"
+)
+
+// DefaultHistorySize is the number of recent events kept per list for resume
+const DefaultHistorySize = 100
+
+// IdleTTL is how long a list's history is kept once it has no subscribers
+// and no new events, so lists that are no longer watched don't hold memory
+const IdleTTL = 15 * time.Minute
+
+// subscriberBuffer is how many undelivered events a subscriber may queue
+// before it is dropped (it can then reconnect and resume with Last-Event-ID)
+const subscriberBuffer = 32
+
+// Event is a single change published to a list's subscribers
+type Event struct {
+	ID     uint64
+	Type   string
+	ListID string
+	Data   interface{}
+}
+
+// Subscription receives events for a single list until closed
+type Subscription struct {
+	C      <-chan Event
+	ch     chan Event
+	listID string
+	hub    *Hub
+	once   sync.Once
+}
+
+// Close unsubscribes and releases the subscription's channel
+func (s *Subscription) Close() {
+	s.once.Do(func() {
+		s.hub.mu.Lock()
+		defer s.hub.mu.Unlock()
+		s.hub.remove(s)
+	})
+}
+
+// Hub is an in-process pub/sub hub fanning out list events to subscribers
+type Hub struct {
+	mu          sync.Mutex
+	firstID     uint64
+	nextID      uint64
+	historySize int
+	history     map[string][]Event
+	evicted     map[string]uint64 // newest event ID not in each list's history
+	subscribers map[string]map[*Subscription]struct{}
+	closed      bool // Set by Close; new subscriptions end immediately
+
+	idleTTL   time.Duration
+	lastUsed  map[string]time.Time // when each list last had an event or lost its last subscriber
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// NewHub creates a hub that remembers historySize events per list
+func NewHub(historySize int) *Hub {
+	// Seed IDs from the clock so they keep increasing across restarts
+	seed := uint64(time.Now().UnixNano())
+	return &Hub{
+		firstID:     seed + 1,
+		nextID:      seed,
+		historySize: historySize,
+		history:     make(map[string][]Event),
+		evicted:     make(map[string]uint64),
+		subscribers: make(map[string]map[*Subscription]struct{}),
+		idleTTL:     IdleTTL,
+		lastUsed:    make(map[string]time.Time),
+		lastSweep:   time.Now(),
+		now:         time.Now,
+	}
+}
+
+// Publish records an event for a list and delivers it to current subscribers
+func (h *Hub) Publish(listID, eventType string, data interface{}) Event {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := h.now()
+	h.sweep(now)
+
+	// A list without history may have had it swept, so resuming from before
+	// its first event can't be complete
+	if _, ok := h.history[listID]; !ok {
+		h.evicted[listID] = h.nextID
+	}
+
+	h.nextID++
+	event := Event{
+		ID:     h.nextID,
+		Type:   eventType,
+		ListID: listID,
+		Data:   data,
+	}
+
+	history := append(h.history[listID], event)
+	if len(history) > h.historySize {
+		drop := len(history) - h.historySize
+		h.evicted[listID] = history[drop-1].ID
+		history = history[drop:]
+	}
+	h.history[listID] = history
+	h.lastUsed[listID] = now
+
+	for sub := range h.subscribers[listID] {
+		select {
+		case sub.ch <- event:
+		default:
+			// Slow consumer: drop it rather than block publishers
+			h.remove(sub)
+		}
+	}
+
+	return event
+}
+
+// Subscribe registers for a list's events. If lastEventID is non-zero, events
+// published after it are returned for replay; complete is false when some of
+// those events are no longer in the history and the client should refetch.
+func (h *Hub) Subscribe(listID string, lastEventID uint64) (sub *Subscription, missed []Event, complete bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ch := make(chan Event, subscriberBuffer)
+	sub = &Subscription{C: ch, ch: ch, listID: listID, hub: h}
+	if h.closed {
+		// Subscribers see a closed channel and reconnect to another instance
+		close(ch)
+		return sub, nil, true
+	}
+	if h.subscribers[listID] == nil {
+		h.subscribers[listID] = make(map[*Subscription]struct{})
+	}
+	h.subscribers[listID][sub] = struct{}{}
+
+	complete = true
+	if lastEventID == 0 {
+		return sub, nil, complete
+	}
+
+	// Events from before this hub started, or evicted from the history, are
+	// lost, as is all of a list's history once it is swept or forgotten
+	history, ok := h.history[listID]
+	if !ok || lastEventID < h.firstID || lastEventID > h.nextID || lastEventID < h.evicted[listID] {
+		return sub, nil, false
+	}
+
+	for _, event := range history {
+		if event.ID > lastEventID {
+			missed = append(missed, event)
+		}
+	}
+	return sub, missed, complete
+}
+
+// Forget drops a list's history and disconnects its subscribers
+func (h *Hub) Forget(listID string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for sub := range h.subscribers[listID] {
+		h.remove(sub)
+	}
+	delete(h.history, listID)
+	delete(h.evicted, listID)
+	delete(h.lastUsed, listID)
+}
+
+// Close disconnects every subscriber so long-lived event streams end during
+// shutdown; clients reconnect and resume with Last-Event-ID
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closed = true
+	for _, subs := range h.subscribers {
+		for sub := range subs {
+			h.remove(sub)
+		}
+	}
+}
+
+// remove unregisters a subscriber and closes its channel; h.mu must be held
+func (h *Hub) remove(sub *Subscription) {
+	subs, ok := h.subscribers[sub.listID]
+	if !ok {
+		return
+	}
+	if _, ok := subs[sub]; !ok {
+		return
+	}
+	delete(subs, sub)
+	close(sub.ch)
+	if len(subs) == 0 {
+		delete(h.subscribers, sub.listID)
+		if _, ok := h.history[sub.listID]; ok {
+			h.lastUsed[sub.listID] = h.now()
+		}
+	}
+}
+
+// sweep drops the history of lists that have had no subscribers or events for
+// the idle TTL. It runs at most once per TTL; h.mu must be held.
+func (h *Hub) sweep(now time.Time) {
+	if now.Sub(h.lastSweep) < h.idleTTL {
+		return
+	}
+	h.lastSweep = now
+
+	for listID, lastUsed := range h.lastUsed {
+		if _, watched := h.subscribers[listID]; watched || now.Sub(lastUsed) < h.idleTTL {
+			continue
+		}
+		delete(h.history, listID)
+		delete(h.evicted, listID)
+		delete(h.lastUsed, listID)
+	}
+}
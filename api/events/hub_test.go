@@ -0,0 +1,256 @@
+package events
+
+import (
+	"testing"
+	"time"
+)
+
+// receive returns the next event on a subscription, failing if none arrives
+func receive(t *testing.T, sub *Subscription) Event {
+	t.Helper()
+	select {
+	case event, open := <-sub.C:
+		if !open {
+			t.Fatalf("subscription closed, want an event")
+		}
+		return event
+	case <-time.After(time.Second):
+		t.Fatalf("no event received")
+		return Event{}
+	}
+}
+
+// expectClosed fails the test unless the subscription's channel is closed
+func expectClosed(t *testing.T, sub *Subscription) {
+	t.Helper()
+	select {
+	case event, open := <-sub.C:
+		if open {
+			t.Fatalf("received %s, want the subscription closed", event.Type)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("subscription still open")
+	}
+}
+
+// eventTypes lists the types of events, in order
+func eventTypes(events []Event) []string {
+	types := make([]string, len(events))
+	for i, event := range events {
+		types[i] = event.Type
+	}
+	return types
+}
+
+func TestHubPublish(t *testing.T) {
+	hub := NewHub(DefaultHistorySize)
+	defer hub.Close()
+
+	sub, missed, complete := hub.Subscribe("list", 0)
+	defer sub.Close()
+	if len(missed) != 0 || !complete {
+		t.Fatalf("new subscription missed %d events, complete %v, want none and true", len(missed), complete)
+	}
+	other, _, _ := hub.Subscribe("other", 0)
+	defer other.Close()
+
+	first := hub.Publish("list", ItemAdded, "milk")
+	second := hub.Publish("list", ItemChecked, "milk")
+	if second.ID <= first.ID {
+		t.Fatalf("event IDs %d then %d, want increasing", first.ID, second.ID)
+	}
+
+	for _, want := range []Event{first, second} {
+		if got := receive(t, sub); got != want {
+			t.Fatalf("received %+v, want %+v", got, want)
+		}
+	}
+
+	// Subscribers to other lists see nothing
+	select {
+	case event := <-other.C:
+		t.Fatalf("other list received %+v", event)
+	default:
+	}
+
+	// Closing twice is fine, and later events aren't delivered
+	sub.Close()
+	sub.Close()
+	expectClosed(t, sub)
+	hub.Publish("list", ItemDeleted, "milk")
+}
+
+func TestHubResume(t *testing.T) {
+	hub := NewHub(3)
+	defer hub.Close()
+
+	first := hub.Publish("list", ItemAdded, nil)
+	hub.Publish("other", ItemAdded, nil)
+	hub.Publish("list", ItemUpdated, nil)
+	hub.Publish("list", ItemChecked, nil)
+
+	tests := []struct {
+		name        string
+		lastEventID uint64
+		missed      []string
+		complete    bool
+	}{
+		{name: "resumes after the last event seen", lastEventID: first.ID, missed: []string{ItemUpdated, ItemChecked}, complete: true},
+		{name: "nothing missed", lastEventID: first.ID + 3, complete: true},
+		{name: "from before the hub started", lastEventID: first.ID - 1, complete: false},
+		{name: "from the future", lastEventID: first.ID + 100, complete: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sub, missed, complete := hub.Subscribe("list", tt.lastEventID)
+			defer sub.Close()
+
+			if got := eventTypes(missed); len(got) != len(tt.missed) || complete != tt.complete {
+				t.Fatalf("missed %v, complete %v, want %v and %v", got, complete, tt.missed, tt.complete)
+			}
+			for i, event := range missed {
+				if event.Type != tt.missed[i] || event.ListID != "list" {
+					t.Fatalf("missed %v, want %v", eventTypes(missed), tt.missed)
+				}
+			}
+		})
+	}
+}
+
+func TestHubHistoryOverrun(t *testing.T) {
+	hub := NewHub(2)
+	defer hub.Close()
+
+	first := hub.Publish("list", ItemAdded, nil)
+	second := hub.Publish("list", ItemUpdated, nil)
+	hub.Publish("list", ItemChecked, nil)
+	hub.Publish("list", ItemDeleted, nil)
+
+	// The event after the one seen was evicted, so the client must refetch
+	sub, missed, complete := hub.Subscribe("list", first.ID)
+	sub.Close()
+	if complete || len(missed) != 0 {
+		t.Fatalf("resuming past evicted events missed %v, complete %v, want a resync", eventTypes(missed), complete)
+	}
+
+	// Resuming from the newest evicted event still has everything after it
+	sub, missed, complete = hub.Subscribe("list", second.ID)
+	sub.Close()
+	if got := eventTypes(missed); !complete || len(got) != 2 || got[0] != ItemChecked || got[1] != ItemDeleted {
+		t.Fatalf("resuming at the history's start missed %v, complete %v, want the 2 kept events", got, complete)
+	}
+}
+
+func TestHubDropsSlowSubscribers(t *testing.T) {
+	hub := NewHub(DefaultHistorySize)
+	defer hub.Close()
+
+	slow, _, _ := hub.Subscribe("list", 0)
+	defer slow.Close()
+
+	var last Event
+	for i := 0; i <= subscriberBuffer; i++ {
+		last = hub.Publish("list", ItemAdded, i)
+	}
+
+	// The slow subscriber gets what was buffered, then its channel closes
+	for i := 0; i < subscriberBuffer; i++ {
+		receive(t, slow)
+	}
+	expectClosed(t, slow)
+
+	// It can resume from the last event it received
+	sub, missed, complete := hub.Subscribe("list", last.ID-1)
+	defer sub.Close()
+	if !complete || len(missed) != 1 || missed[0].ID != last.ID {
+		t.Fatalf("resuming missed %d events, complete %v, want the one dropped", len(missed), complete)
+	}
+}
+
+func TestHubForget(t *testing.T) {
+	hub := NewHub(DefaultHistorySize)
+	defer hub.Close()
+
+	first := hub.Publish("list", ItemAdded, nil)
+	hub.Publish("list", ItemUpdated, nil)
+	sub, _, _ := hub.Subscribe("list", 0)
+	defer sub.Close()
+	other, _, _ := hub.Subscribe("other", 0)
+	defer other.Close()
+
+	hub.Forget("list")
+	expectClosed(t, sub)
+	hub.Publish("other", ItemAdded, nil)
+	receive(t, other)
+
+	// The forgotten list's history is gone
+	resumed, missed, _ := hub.Subscribe("list", first.ID)
+	defer resumed.Close()
+	if len(missed) != 0 {
+		t.Fatalf("forgotten list replayed %v", eventTypes(missed))
+	}
+}
+
+func TestHubSweepsIdleLists(t *testing.T) {
+	hub := NewHub(DefaultHistorySize)
+	defer hub.Close()
+	now := time.Now()
+	hub.now = func() time.Time { return now }
+
+	idle := hub.Publish("idle", ItemAdded, nil)
+	watched := hub.Publish("watched", ItemAdded, nil)
+	sub, _, _ := hub.Subscribe("watched", 0)
+	defer sub.Close()
+	left, _, _ := hub.Subscribe("left", 0)
+	hub.Publish("left", ItemAdded, nil)
+
+	// Lists nobody watches are swept once they have been idle for the TTL,
+	// counting from when their last subscriber left
+	now = now.Add(IdleTTL / 2)
+	left.Close()
+	now = now.Add(IdleTTL / 2)
+	hub.Publish("other", ItemAdded, nil)
+	if _, ok := hub.history["idle"]; ok {
+		t.Fatalf("idle list's history was kept")
+	}
+	if _, ok := hub.lastUsed["idle"]; ok {
+		t.Fatalf("idle list is still tracked")
+	}
+	for _, listID := range []string{"watched", "left"} {
+		if _, ok := hub.history[listID]; !ok {
+			t.Fatalf("%s list's history was swept", listID)
+		}
+	}
+
+	// Resuming a swept list asks for a refetch, even once it has new events
+	hub.Publish("idle", ItemUpdated, nil)
+	resumed, missed, complete := hub.Subscribe("idle", idle.ID)
+	resumed.Close()
+	if complete || len(missed) != 0 {
+		t.Fatalf("resuming a swept list missed %v, complete %v, want a resync", eventTypes(missed), complete)
+	}
+
+	resumed, missed, complete = hub.Subscribe("watched", watched.ID)
+	resumed.Close()
+	if !complete || len(missed) != 0 {
+		t.Fatalf("resuming a watched list missed %v, complete %v, want nothing", eventTypes(missed), complete)
+	}
+}
+
+func TestHubClose(t *testing.T) {
+	hub := NewHub(DefaultHistorySize)
+	sub, _, _ := hub.Subscribe("list", 0)
+	defer sub.Close()
+
+	hub.Close()
+	expectClosed(t, sub)
+
+	// Subscribing after Close ends immediately
+	late, _, complete := hub.Subscribe("list", 0)
+	defer late.Close()
+	if !complete {
+		t.Fatalf("subscription after Close is incomplete")
+	}
+	expectClosed(t, late)
+}
@@ -2,53 +2,53 @@ package handlers
 
 import (
 	"context"
+	"errors"
 	"net/http"
+	"strings"
 	"time"
 
-	"bryce-stabenow/grocer-me/config"
+	"bryce-stabenow/grocer-me/apierr"
+	"bryce-stabenow/grocer-me/metrics"
 	"bryce-stabenow/grocer-me/models"
+	"bryce-stabenow/grocer-me/store"
 	"bryce-stabenow/grocer-me/utils"
 
 	"github.com/golang-jwt/jwt/v5"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/v2/bson"
-	"go.mongodb.org/mongo-driver/v2/mongo"
 	"golang.org/x/crypto/bcrypt"
 )
 
 // HandleSignup handles user registration
-func HandleSignup(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) HandleSignup(w http.ResponseWriter, r *http.Request) {
 	var req models.SignupRequest
 	if err := utils.DecodeJSON(r, &req); err != nil {
-		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+		utils.DecodeErrorResponse(w, err)
 		return
 	}
 
 	// Check if email already exists
-	collection := config.DB.Collection("users")
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := h.OperationContext(r)
 	defer cancel()
 
-	var existingUser models.User
-	err := collection.FindOne(ctx, bson.M{"email": req.Email}).Decode(&existingUser)
+	_, err := h.Stores.Users.GetByEmail(ctx, req.Email)
 	if err == nil {
-		utils.ErrorResponse(w, http.StatusConflict, "Email already exists")
+		utils.ErrorResponse(w, apierr.EmailAlreadyExists)
 		return
 	}
-	if err != mongo.ErrNoDocuments {
-		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to check email")
+	if !errors.Is(err, store.ErrNotFound) {
+		utils.ErrorResponse(w, apierr.Unexpected(err, "Failed to check email"))
 		return
 	}
 
 	// Hash password
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), 10)
 	if err != nil {
-		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to hash password")
+		utils.ErrorResponse(w, apierr.Unexpected(err, "Failed to hash password"))
 		return
 	}
 
 	// Create user with profile
-	now := time.Now()
+	now := h.Now()
 	profile := &models.Profile{
 		FirstName: req.FirstName,
 		LastName:  req.LastName,
@@ -56,7 +56,7 @@ func HandleSignup(w http.ResponseWriter, r *http.Request) {
 	if req.AvatarURL != nil && *req.AvatarURL != "" {
 		profile.AvatarURL = *req.AvatarURL
 	}
-	
+
 	user := models.User{
 		ID:           primitive.NewObjectID(),
 		Email:        req.Email,
@@ -67,91 +67,136 @@ func HandleSignup(w http.ResponseWriter, r *http.Request) {
 		UpdatedAt:    now,
 	}
 
-	_, err = collection.InsertOne(ctx, user)
+	err = h.Stores.Users.Create(ctx, &user)
 	if err != nil {
-		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to create user")
+		if errors.Is(err, store.ErrDuplicate) {
+			utils.ErrorResponse(w, apierr.EmailAlreadyExists)
+			return
+		}
+		utils.ErrorResponse(w, apierr.Unexpected(err, "Failed to create user"))
 		return
 	}
+	metrics.UsersSignedUp.Inc()
+
+	// Email a link to confirm the address; the account works without it, so a
+	// failure here doesn't fail the signup
+	if err := h.startEmailVerification(ctx, utils.GetLogger(r), &user); err != nil {
+		utils.GetLogger(r).Error("Failed to start email verification", "user_id", user.ID.Hex(), "error", err)
+	}
 
-	// Generate JWT token
-	token, err := generateToken(user.ID.Hex())
+	// Start a session and set its tokens as HTTP-only cookies
+	tokens, err := h.startSession(ctx, w, r, user.ID)
 	if err != nil {
-		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to generate token")
+		utils.ErrorResponse(w, apierr.Unexpected(err, "Failed to start session"))
 		return
 	}
 
-	// Set JWT as HTTP-only cookie (24 hours expiration to match token)
-	utils.SetCookie(w, "jwt_token", token, 3600*24, "/", "", false, true)
-
 	// Return response
 	utils.JSONResponse(w, http.StatusCreated, models.AuthResponse{
-		Token: token,
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresAt:    tokens.ExpiresAt,
 		User: &models.UserPublic{
-			ID:        user.ID.Hex(),
-			Email:     user.Email,
-			Username:  user.Username,
-			Profile:   user.Profile,
-			CreatedAt: user.CreatedAt,
+			ID:            user.ID.Hex(),
+			Email:         user.Email,
+			Username:      user.Username,
+			Profile:       user.Profile,
+			EmailVerified: user.EmailVerified,
+			CreatedAt:     user.CreatedAt,
 		},
 	})
 }
 
 // HandleSignin handles user login
-func HandleSignin(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) HandleSignin(w http.ResponseWriter, r *http.Request) {
 	var req models.SigninRequest
 	if err := utils.DecodeJSON(r, &req); err != nil {
-		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+		utils.DecodeErrorResponse(w, err)
 		return
 	}
 
-	// Find user by email
-	collection := config.DB.Collection("users")
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := h.OperationContext(r)
 	defer cancel()
 
-	var user models.User
-	err := collection.FindOne(ctx, bson.M{"email": req.Email}).Decode(&user)
+	// Refuse accounts locked out by repeated failures. If the lockout can't be
+	// checked, fall back to the rate limits rather than blocking sign-in.
+	lockoutKey := "signin:" + strings.ToLower(strings.TrimSpace(req.Email))
+	lockedUntil, err := h.Stores.RateLimits.LockedUntil(ctx, lockoutKey, h.Now())
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			utils.ErrorResponse(w, http.StatusUnauthorized, "Invalid email or password")
+		utils.GetLogger(r).Error("Failed to check sign-in lockout", "error", err)
+	} else if !lockedUntil.IsZero() {
+		h.accountLocked(w, lockedUntil)
+		return
+	}
+
+	// Find user by email
+	user, err := h.Stores.Users.GetByEmail(ctx, req.Email)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			h.signinFailed(ctx, w, r, lockoutKey)
 			return
 		}
-		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to find user")
+		utils.ErrorResponse(w, apierr.Unexpected(err, "Failed to find user"))
 		return
 	}
 
 	// Verify password
 	err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password))
 	if err != nil {
-		utils.ErrorResponse(w, http.StatusUnauthorized, "Invalid email or password")
+		h.signinFailed(ctx, w, r, lockoutKey)
 		return
 	}
 
-	// Generate JWT token
-	token, err := generateToken(user.ID.Hex())
+	// A successful sign-in clears earlier failures
+	if err := h.Stores.RateLimits.ResetFailures(ctx, lockoutKey); err != nil {
+		utils.GetLogger(r).Error("Failed to reset sign-in failures", "error", err)
+	}
+
+	// Start a session and set its tokens as HTTP-only cookies
+	tokens, err := h.startSession(ctx, w, r, user.ID)
 	if err != nil {
-		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to generate token")
+		utils.ErrorResponse(w, apierr.Unexpected(err, "Failed to start session"))
 		return
 	}
 
-	// Set JWT as HTTP-only cookie (24 hours expiration to match token)
-	utils.SetCookie(w, "jwt_token", token, 3600*24, "/", "", false, true)
-
 	// Return response
 	utils.JSONResponse(w, http.StatusOK, models.AuthResponse{
-		Token: token,
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresAt:    tokens.ExpiresAt,
 		User: &models.UserPublic{
-			ID:        user.ID.Hex(),
-			Email:     user.Email,
-			Username:  user.Username,
-			Profile:   user.Profile,
-			CreatedAt: user.CreatedAt,
+			ID:            user.ID.Hex(),
+			Email:         user.Email,
+			Username:      user.Username,
+			Profile:       user.Profile,
+			EmailVerified: user.EmailVerified,
+			CreatedAt:     user.CreatedAt,
 		},
 	})
 }
 
+// signinFailed records a failed sign-in against the account and responds
+// with invalid credentials, or with the lockout if this failure caused one
+func (h *Handler) signinFailed(ctx context.Context, w http.ResponseWriter, r *http.Request, lockoutKey string) {
+	lockedUntil, err := h.Stores.RateLimits.RecordFailure(ctx, lockoutKey, h.Config.Auth.Lockout.Policy(), h.Now())
+	if err != nil {
+		utils.GetLogger(r).Error("Failed to record failed sign-in", "error", err)
+	}
+	if !lockedUntil.IsZero() {
+		h.accountLocked(w, lockedUntil)
+		return
+	}
+	utils.ErrorResponse(w, apierr.InvalidCredentials)
+}
+
+// accountLocked tells the client the account is locked out until lockedUntil
+func (h *Handler) accountLocked(w http.ResponseWriter, lockedUntil time.Time) {
+	utils.SetRetryAfter(w, lockedUntil.Sub(h.Now()))
+	utils.ErrorResponse(w, apierr.AccountLocked)
+}
+
 // HandleGetMe returns the current user's information
-func HandleGetMe(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) HandleGetMe(w http.ResponseWriter, r *http.Request) {
 	// Get authenticated user ID
 	userID, ok := utils.GetAuthenticatedUser(w, r)
 	if !ok {
@@ -159,18 +204,16 @@ func HandleGetMe(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Find user by ID
-	collection := config.DB.Collection("users")
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := h.OperationContext(r)
 	defer cancel()
 
-	var user models.User
-	err := collection.FindOne(ctx, bson.M{"_id": userID}).Decode(&user)
+	user, err := h.Stores.Users.GetByID(ctx, userID)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			utils.ErrorResponse(w, http.StatusNotFound, "User not found")
+		if errors.Is(err, store.ErrNotFound) {
+			utils.ErrorResponse(w, apierr.UserNotFound)
 			return
 		}
-		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to find user")
+		utils.ErrorResponse(w, apierr.Unexpected(err, "Failed to find user"))
 		return
 	}
 
@@ -178,25 +221,43 @@ func HandleGetMe(w http.ResponseWriter, r *http.Request) {
 	utils.JSONResponse(w, http.StatusOK, user)
 }
 
-// HandleLogout handles user logout by clearing the JWT cookie
-func HandleLogout(w http.ResponseWriter, r *http.Request) {
-	// Clear the JWT cookie by setting it with an expired expiration time
-	utils.SetCookie(w, "jwt_token", "", -1, "/", "", false, true)
-	
+// HandleLogout handles user logout by revoking the session and clearing its cookies
+func (h *Handler) HandleLogout(w http.ResponseWriter, r *http.Request) {
+	// Revoke the session so its tokens stop working everywhere
+	sessionIDStr, _ := utils.GetSessionID(r)
+	sessionID, err := primitive.ObjectIDFromHex(sessionIDStr)
+	if err != nil {
+		utils.ErrorResponse(w, apierr.InvalidID.WithMessage("Invalid session ID format"))
+		return
+	}
+
+	ctx, cancel := h.OperationContext(r)
+	defer cancel()
+
+	if err := h.Stores.Sessions.Revoke(ctx, sessionID, h.Now()); err != nil && !errors.Is(err, store.ErrNotFound) {
+		utils.ErrorResponse(w, apierr.Unexpected(err, "Failed to revoke session"))
+		return
+	}
+
+	// Clear the auth cookies by setting them with an expired expiration time
+	h.clearAuthCookies(w)
+
 	utils.JSONResponse(w, http.StatusOK, map[string]string{"message": "Logged out successfully"})
 }
 
-// generateToken creates a JWT token for the given user ID
-func generateToken(userID string) (string, error) {
-	// Token expires in 24 hours
-	expirationTime := time.Now().Add(24 * time.Hour)
+// generateToken creates a short-lived JWT for the given user and session
+func (h *Handler) generateToken(userID, sessionID string) (string, time.Time, error) {
+	now := h.Now()
+	expirationTime := now.Add(h.Config.Auth.AccessTokenTTL)
 
 	claims := jwt.MapClaims{
 		"user_id": userID,
+		"sid":     sessionID,
 		"exp":     expirationTime.Unix(),
-		"iat":     time.Now().Unix(),
+		"iat":     now.Unix(),
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(config.JWTSecret))
+	signed, err := token.SignedString([]byte(h.Config.Auth.JWTSecret))
+	return signed, expirationTime, err
 }
@@ -0,0 +1,307 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"bryce-stabenow/grocer-me/apierr"
+	"bryce-stabenow/grocer-me/events"
+	"bryce-stabenow/grocer-me/models"
+	"bryce-stabenow/grocer-me/store"
+	"bryce-stabenow/grocer-me/utils"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// HandleUpdateCollaboratorRole handles changing a collaborator's role on a list
+func (h *Handler) HandleUpdateCollaboratorRole(w http.ResponseWriter, r *http.Request) {
+	// Get authenticated user ID
+	userID, ok := utils.GetAuthenticatedUser(w, r)
+	if !ok {
+		return // Error response already sent
+	}
+
+	// Get and validate list and collaborator IDs
+	listID, ok := utils.GetAndValidateListID(w, r)
+	if !ok {
+		return // Error response already sent
+	}
+	collaboratorID, ok := utils.GetAndValidateUserID(w, r)
+	if !ok {
+		return // Error response already sent
+	}
+
+	// Parse request body
+	var req models.UpdateCollaboratorRequest
+	if err := utils.DecodeJSON(r, &req); err != nil {
+		utils.DecodeErrorResponse(w, err)
+		return
+	}
+
+	// Fetch list and verify ownership
+	list, ok := h.fetchList(w, r, listID)
+	if !ok {
+		return // Error response already sent
+	}
+
+	// Only the owner can change collaborator roles
+	if !utils.CheckListPermission(w, list, userID, models.PermissionManageSharing) {
+		return // Error response already sent
+	}
+
+	// Reject stale writes from clients holding an old version
+	if !utils.CheckIfMatch(w, r, list) {
+		return // Error response already sent
+	}
+
+	// Update the role, retrying against concurrent changes unless the client named a version
+	ctx, cancel := h.OperationContext(r)
+	defer cancel()
+
+	updatedList, err := h.writeList(ctx, r, list, func(list *models.List) (*models.List, error) {
+		if err := utils.ListPermissionError(list, userID, models.PermissionManageSharing); err != nil {
+			return nil, err
+		}
+		return h.Stores.Lists.UpdateCollaboratorRole(ctx, listID, list.Version, collaboratorID, req.Role, h.Now())
+	})
+	if err != nil {
+		writeStoreError(w, err, apierr.CollaboratorNotFound, "Failed to update collaborator")
+		return
+	}
+
+	// Notify subscribers
+	h.publishListEvent(updatedList, events.MembersChanged, models.ListEvent{UserID: collaboratorID.Hex()})
+
+	// Return the list with its version as the ETag
+	h.writeListResponse(w, r, http.StatusOK, updatedList)
+}
+
+// HandleRemoveCollaborator handles the owner removing a collaborator from a list
+func (h *Handler) HandleRemoveCollaborator(w http.ResponseWriter, r *http.Request) {
+	// Get authenticated user ID
+	userID, ok := utils.GetAuthenticatedUser(w, r)
+	if !ok {
+		return // Error response already sent
+	}
+
+	// Get and validate list and collaborator IDs
+	listID, ok := utils.GetAndValidateListID(w, r)
+	if !ok {
+		return // Error response already sent
+	}
+	collaboratorID, ok := utils.GetAndValidateUserID(w, r)
+	if !ok {
+		return // Error response already sent
+	}
+
+	// Fetch list and verify ownership
+	list, ok := h.fetchList(w, r, listID)
+	if !ok {
+		return // Error response already sent
+	}
+
+	// Only the owner can remove collaborators
+	if !utils.CheckListPermission(w, list, userID, models.PermissionManageSharing) {
+		return // Error response already sent
+	}
+
+	// Reject stale writes from clients holding an old version
+	if !utils.CheckIfMatch(w, r, list) {
+		return // Error response already sent
+	}
+
+	// Remove the collaborator, retrying against concurrent changes unless the client named a version
+	ctx, cancel := h.OperationContext(r)
+	defer cancel()
+
+	updatedList, err := h.writeList(ctx, r, list, func(list *models.List) (*models.List, error) {
+		if err := utils.ListPermissionError(list, userID, models.PermissionManageSharing); err != nil {
+			return nil, err
+		}
+		return h.Stores.Lists.RemoveCollaborator(ctx, listID, list.Version, collaboratorID, h.Now())
+	})
+	if err != nil {
+		writeStoreError(w, err, apierr.CollaboratorNotFound, "Failed to remove collaborator")
+		return
+	}
+
+	// Notify subscribers; the removed user's stream is closed
+	h.publishListEvent(updatedList, events.MembersChanged, models.ListEvent{UserID: collaboratorID.Hex()})
+
+	// Return the list with its version as the ETag
+	h.writeListResponse(w, r, http.StatusOK, updatedList)
+}
+
+// HandleLeaveList handles a collaborator removing themselves from a list
+func (h *Handler) HandleLeaveList(w http.ResponseWriter, r *http.Request) {
+	// Get authenticated user ID
+	userID, ok := utils.GetAuthenticatedUser(w, r)
+	if !ok {
+		return // Error response already sent
+	}
+
+	// Get and validate list ID
+	listID, ok := utils.GetAndValidateListID(w, r)
+	if !ok {
+		return // Error response already sent
+	}
+
+	// Fetch list
+	list, ok := h.fetchList(w, r, listID)
+	if !ok {
+		return // Error response already sent
+	}
+
+	// Check if user has access
+	if !utils.CheckListPermission(w, list, userID, models.PermissionView) {
+		return // Error response already sent
+	}
+
+	// The owner would leave the list without an owner
+	if list.UserID == userID {
+		utils.ErrorResponse(w, apierr.OwnerCannotLeave)
+		return
+	}
+
+	// Reject stale writes from clients holding an old version
+	if !utils.CheckIfMatch(w, r, list) {
+		return // Error response already sent
+	}
+
+	ctx, cancel := h.OperationContext(r)
+	defer cancel()
+
+	updatedList, err := h.removeCollaborator(ctx, r, list, userID)
+	if err != nil {
+		writeStoreError(w, err, apierr.ListNotFound, "Failed to leave list")
+		return
+	}
+
+	// Notify subscribers
+	h.publishListEvent(updatedList, events.MembersChanged, models.ListEvent{UserID: userID.Hex()})
+
+	utils.JSONResponse(w, http.StatusOK, map[string]string{"message": "Left list successfully"})
+}
+
+// HandleTransferOwnership handles the owner handing a list over to a collaborator
+func (h *Handler) HandleTransferOwnership(w http.ResponseWriter, r *http.Request) {
+	// Get authenticated user ID
+	userID, ok := utils.GetAuthenticatedUser(w, r)
+	if !ok {
+		return // Error response already sent
+	}
+
+	// Get and validate list ID
+	listID, ok := utils.GetAndValidateListID(w, r)
+	if !ok {
+		return // Error response already sent
+	}
+
+	// Parse request body
+	var req models.TransferOwnershipRequest
+	if err := utils.DecodeJSON(r, &req); err != nil {
+		utils.DecodeErrorResponse(w, err)
+		return
+	}
+
+	newOwnerID, err := primitive.ObjectIDFromHex(req.UserID)
+	if err != nil {
+		utils.ErrorResponse(w, apierr.InvalidID.WithMessage("Invalid user ID format"))
+		return
+	}
+
+	// Fetch list and verify ownership
+	list, ok := h.fetchList(w, r, listID)
+	if !ok {
+		return // Error response already sent
+	}
+
+	// Only the owner can transfer the list
+	if !utils.CheckListPermission(w, list, userID, models.PermissionManageSharing) {
+		return // Error response already sent
+	}
+
+	if newOwnerID == userID {
+		utils.ErrorResponse(w, apierr.AlreadyListOwner)
+		return
+	}
+
+	// Reject stale writes from clients holding an old version
+	if !utils.CheckIfMatch(w, r, list) {
+		return // Error response already sent
+	}
+
+	// Ownership can only go to an existing collaborator; the former owner stays on as an editor
+	ctx, cancel := h.OperationContext(r)
+	defer cancel()
+
+	updatedList, err := h.writeList(ctx, r, list, func(list *models.List) (*models.List, error) {
+		if err := utils.ListPermissionError(list, userID, models.PermissionManageSharing); err != nil {
+			return nil, err
+		}
+		return h.Stores.Lists.TransferOwnership(ctx, listID, list.Version, userID, newOwnerID, h.Now())
+	})
+	if err != nil {
+		writeStoreError(w, err, apierr.CollaboratorNotFound, "Failed to transfer ownership")
+		return
+	}
+
+	// Notify subscribers
+	h.publishListEvent(updatedList, events.MembersChanged, models.ListEvent{UserID: newOwnerID.Hex()})
+
+	// Return the list with its version as the ETag
+	h.writeListResponse(w, r, http.StatusOK, updatedList)
+}
+
+// addCollaborator adds a user to a list, retrying if the list is modified
+// concurrently unless the request's If-Match named a version. It reports
+// whether this call added the user.
+func (h *Handler) addCollaborator(ctx context.Context, r *http.Request, list *models.List, collaborator models.Collaborator) (*models.List, bool, error) {
+	added := false
+	updatedList, err := h.writeList(ctx, r, list, func(list *models.List) (*models.List, error) {
+		// A concurrent request may have added the user already
+		if _, ok := list.RoleOf(collaborator.UserID); ok {
+			added = false
+			return list, nil
+		}
+		added = true
+		return h.Stores.Lists.AddCollaborator(ctx, list.ID, list.Version, collaborator, h.Now())
+	})
+	return updatedList, added && err == nil, err
+}
+
+// removeCollaborator removes a user from a list, retrying if the list is
+// modified concurrently so leaving never fails because of unrelated edits,
+// unless the request's If-Match named a version
+func (h *Handler) removeCollaborator(ctx context.Context, r *http.Request, list *models.List, userID primitive.ObjectID) (*models.List, error) {
+	return h.writeList(ctx, r, list, func(list *models.List) (*models.List, error) {
+		// A concurrent request may have removed the user already
+		if role, ok := list.RoleOf(userID); !ok || role == models.RoleOwner {
+			return nil, store.ErrNotFound
+		}
+		return h.Stores.Lists.RemoveCollaborator(ctx, list.ID, list.Version, userID, h.Now())
+	})
+}
+
+// retryOnConflict applies a versioned write, refetching the list and trying
+// again a few times if it was modified in the meantime. If it keeps changing,
+// apierr.ListBusy is returned, since the caller asserted no version to conflict with.
+func (h *Handler) retryOnConflict(ctx context.Context, list *models.List, write func(list *models.List) (*models.List, error)) (*models.List, error) {
+	const maxAttempts = 3
+
+	for attempt := 1; ; attempt++ {
+		updatedList, err := write(list)
+		if !errors.Is(err, store.ErrVersionConflict) {
+			return updatedList, err
+		}
+		if attempt == maxAttempts {
+			return nil, apierr.ListBusy
+		}
+
+		list, err = h.Stores.Lists.Get(ctx, list.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"bryce-stabenow/grocer-me/apierr"
+	"bryce-stabenow/grocer-me/events"
+	"bryce-stabenow/grocer-me/middleware"
+	"bryce-stabenow/grocer-me/models"
+	"bryce-stabenow/grocer-me/store"
+	"bryce-stabenow/grocer-me/utils"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// HandleListEvents streams real-time changes to a list as Server-Sent Events.
+// HEAD requests get the stream's headers without opening it.
+func (h *Handler) HandleListEvents(w http.ResponseWriter, r *http.Request) {
+	// Get authenticated user ID
+	userID, ok := utils.GetAuthenticatedUser(w, r)
+	if !ok {
+		return // Error response already sent
+	}
+
+	// Get and validate list ID
+	listID, ok := utils.GetAndValidateListID(w, r)
+	if !ok {
+		return // Error response already sent
+	}
+
+	// Fetch list
+	list, ok := h.fetchList(w, r, listID)
+	if !ok {
+		return // Error response already sent
+	}
+
+	// Check if user has access
+	if !utils.CheckListPermission(w, list, userID, models.PermissionView) {
+		return // Error response already sent
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		utils.ErrorResponse(w, apierr.StreamingNotSupported)
+		return
+	}
+
+	// Browsers send Last-Event-ID automatically when an EventSource reconnects
+	var lastEventID uint64
+	if header := r.Header.Get("Last-Event-ID"); header != "" {
+		parsed, err := strconv.ParseUint(header, 10, 64)
+		if err != nil {
+			utils.ErrorResponse(w, apierr.InvalidParameter.WithMessage("Invalid Last-Event-ID"))
+			return
+		}
+		lastEventID = parsed
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	if r.Method == http.MethodHead {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	sessionID, _ := utils.GetSessionID(r)
+	sub, missed, complete := h.Events.Subscribe(listID.Hex(), lastEventID)
+	defer sub.Close()
+
+	// The stream stays open indefinitely, so it can't be bound by the server's write timeout
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+		utils.GetLogger(r).Warn("Failed to clear write deadline for event stream", "error", err)
+	}
+
+	w.WriteHeader(http.StatusOK)
+
+	// Tell the client to refetch if events it missed are no longer available
+	if !complete {
+		fmt.Fprintf(w, "event: resync\ndata: {}\n\n")
+	}
+	for _, event := range missed {
+		if err := writeEvent(w, event); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(h.Config.Server.EventHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, open := <-sub.C:
+			if !open {
+				// Dropped by the hub, or the list was deleted; the client
+				// will reconnect and resume or be refused
+				return
+			}
+			if err := writeEvent(w, event); err != nil {
+				return
+			}
+			flusher.Flush()
+
+			// Stop streaming to users who were removed or left
+			if changesMember(event, userID) && h.lostAccess(r.Context(), listID, userID, sessionID) {
+				return
+			}
+		case <-heartbeat.C:
+			// Stop streaming once the user signs out or loses access some other way
+			if h.lostAccess(r.Context(), listID, userID, sessionID) {
+				return
+			}
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// writeEvent writes a single event in text/event-stream format
+func writeEvent(w http.ResponseWriter, event events.Event) error {
+	data, err := json.Marshal(event.Data)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+	return err
+}
+
+// publishListEvent notifies a list's subscribers of a change
+func (h *Handler) publishListEvent(list *models.List, eventType string, event models.ListEvent) {
+	event.ListID = list.ID.Hex()
+	event.Version = list.Version
+	h.Events.Publish(event.ListID, eventType, event)
+}
+
+// changesMember reports whether an event changed the user's membership
+func changesMember(event events.Event, userID primitive.ObjectID) bool {
+	data, ok := event.Data.(models.ListEvent)
+	return ok && event.Type == events.MembersChanged && data.UserID == userID.Hex()
+}
+
+// lostAccess reports whether the user's session has ended or they can no
+// longer see the list. Store failures don't end the stream.
+func (h *Handler) lostAccess(ctx context.Context, listID, userID primitive.ObjectID, sessionID string) bool {
+	if err := middleware.CheckSession(ctx, h.App, sessionID, userID.Hex()); err != nil {
+		return errors.Is(err, middleware.ErrSessionRevoked) || errors.Is(err, middleware.ErrInvalidClaims)
+	}
+
+	ctx, cancel := h.StoreContext(ctx)
+	defer cancel()
+
+	list, err := h.Stores.Lists.Get(ctx, listID)
+	if err != nil {
+		return errors.Is(err, store.ErrNotFound)
+	}
+	_, ok := list.RoleOf(userID)
+	return !ok
+}
+
+// findItem returns the item with the given ID from a list, if present
+func findItem(list *models.List, itemID primitive.ObjectID) *models.ListItem {
+	for i := range list.Items {
+		if list.Items[i].ID == itemID {
+			return &list.Items[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"bryce-stabenow/grocer-me/apierr"
+	"bryce-stabenow/grocer-me/app"
+	"bryce-stabenow/grocer-me/models"
+	"bryce-stabenow/grocer-me/store"
+	"bryce-stabenow/grocer-me/tracing"
+	"bryce-stabenow/grocer-me/utils"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Handler serves the API's endpoints using the stores, mailer and settings
+// of its App
+type Handler struct {
+	*app.App
+}
+
+// requestModels are the request bodies handlers decode with utils.DecodeJSON
+var requestModels = []interface{}{
+	models.SignupRequest{},
+	models.SigninRequest{},
+	models.RefreshTokenRequest{},
+	models.CreateListRequest{},
+	models.UpdateListRequest{},
+	models.AddListItemRequest{},
+	models.UpdateListItemRequest{},
+	models.UpdateListItemCheckedRequest{},
+	models.UpdateCollaboratorRequest{},
+	models.TransferOwnershipRequest{},
+	models.CreateInviteRequest{},
+	models.ForgotPasswordRequest{},
+	models.ResetPasswordRequest{},
+}
+
+// New creates a Handler backed by a. It panics if a request model has a
+// malformed binding tag, so the mistake stops the server from starting
+// rather than failing requests.
+func New(a *app.App) *Handler {
+	if err := utils.CheckBindings(requestModels...); err != nil {
+		panic(err.Error())
+	}
+	return &Handler{App: a}
+}
+
+// fetchList retrieves a list by ID from the list store
+func (h *Handler) fetchList(w http.ResponseWriter, r *http.Request, listID primitive.ObjectID) (*models.List, bool) {
+	ctx, span := tracing.Start(r.Context(), "FetchList")
+	defer span.End()
+
+	ctx, cancel := h.StoreContext(ctx)
+	defer cancel()
+
+	list, err := h.Stores.Lists.Get(ctx, listID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			utils.ErrorResponse(w, apierr.ListNotFound)
+			return nil, false
+		}
+		utils.ErrorResponse(w, apierr.Unexpected(err, "Failed to find list"))
+		return nil, false
+	}
+
+	return list, true
+}
@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"bryce-stabenow/grocer-me/apierr"
+	"bryce-stabenow/grocer-me/metrics"
+	"bryce-stabenow/grocer-me/models"
+	"bryce-stabenow/grocer-me/store"
+	"bryce-stabenow/grocer-me/utils"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// defaultInviteTTL is how long an invite lasts when no expiry is requested
+const defaultInviteTTL = 7 * 24 * time.Hour
+
+// HandleCreateInvite handles minting a new invite token for a list
+func (h *Handler) HandleCreateInvite(w http.ResponseWriter, r *http.Request) {
+	// Get authenticated user ID
+	userID, ok := utils.GetAuthenticatedUser(w, r)
+	if !ok {
+		return // Error response already sent
+	}
+
+	// Get and validate list ID
+	listID, ok := utils.GetAndValidateListID(w, r)
+	if !ok {
+		return // Error response already sent
+	}
+
+	// Parse request body
+	var req models.CreateInviteRequest
+	if err := utils.DecodeJSON(r, &req); err != nil {
+		utils.DecodeErrorResponse(w, err)
+		return
+	}
+
+	// Default to inviting editors, matching how sharing worked before roles
+	role := models.RoleEditor
+	if req.Role != "" {
+		role = req.Role
+	}
+
+	// Default to a single-use invite; 0 allows unlimited uses
+	maxUses := 1
+	if req.MaxUses != nil {
+		maxUses = *req.MaxUses
+	}
+
+	// The expiry was bounded by validation, so it can't overflow
+	ttl := defaultInviteTTL
+	if req.ExpiresInHours != 0 {
+		ttl = time.Duration(req.ExpiresInHours) * time.Hour
+	}
+
+	// Fetch list and verify ownership
+	list, ok := h.fetchList(w, r, listID)
+	if !ok {
+		return // Error response already sent
+	}
+
+	// Only the owner can invite collaborators
+	if !utils.CheckListPermission(w, list, userID, models.PermissionManageSharing) {
+		return // Error response already sent
+	}
+
+	// Generate the token; only its hash is stored
+	token, err := utils.NewRandomToken()
+	if err != nil {
+		utils.ErrorResponse(w, apierr.Unexpected(err, "Failed to generate invite token"))
+		return
+	}
+
+	ctx, cancel := h.OperationContext(r)
+	defer cancel()
+
+	now := h.Now()
+	invite := models.Invite{
+		ID:        primitive.NewObjectID(),
+		ListID:    listID,
+		TokenHash: utils.HashToken(token),
+		CreatedBy: userID,
+		Role:      role,
+		MaxUses:   maxUses,
+		Uses:      0,
+		ExpiresAt: now.Add(ttl),
+		CreatedAt: now,
+	}
+
+	if err := h.Stores.Invites.Create(ctx, &invite); err != nil {
+		utils.ErrorResponse(w, apierr.Unexpected(err, "Failed to create invite"))
+		return
+	}
+	metrics.InvitesCreated.Inc()
+
+	// The raw token is only ever returned here
+	utils.JSONResponse(w, http.StatusCreated, inviteToResponse(&invite, token))
+}
+
+// HandleGetInvites handles listing a list's outstanding invites
+func (h *Handler) HandleGetInvites(w http.ResponseWriter, r *http.Request) {
+	// Get authenticated user ID
+	userID, ok := utils.GetAuthenticatedUser(w, r)
+	if !ok {
+		return // Error response already sent
+	}
+
+	// Get and validate list ID
+	listID, ok := utils.GetAndValidateListID(w, r)
+	if !ok {
+		return // Error response already sent
+	}
+
+	// Fetch list and verify ownership
+	list, ok := h.fetchList(w, r, listID)
+	if !ok {
+		return // Error response already sent
+	}
+
+	// Only the owner can see invites
+	if !utils.CheckListPermission(w, list, userID, models.PermissionManageSharing) {
+		return // Error response already sent
+	}
+
+	ctx, cancel := h.OperationContext(r)
+	defer cancel()
+
+	invites, err := h.Stores.Invites.ListActive(ctx, listID, h.Now())
+	if err != nil {
+		utils.ErrorResponse(w, apierr.Unexpected(err, "Failed to fetch invites"))
+		return
+	}
+
+	// Convert to response format
+	responses := make([]models.InviteResponse, len(invites))
+	for i, invite := range invites {
+		responses[i] = inviteToResponse(&invite, "")
+	}
+
+	utils.JSONResponse(w, http.StatusOK, responses)
+}
+
+// HandleRevokeInvite handles revoking an outstanding invite
+func (h *Handler) HandleRevokeInvite(w http.ResponseWriter, r *http.Request) {
+	// Get authenticated user ID
+	userID, ok := utils.GetAuthenticatedUser(w, r)
+	if !ok {
+		return // Error response already sent
+	}
+
+	// Get and validate list and invite IDs
+	listID, ok := utils.GetAndValidateListID(w, r)
+	if !ok {
+		return // Error response already sent
+	}
+	inviteID, ok := utils.GetAndValidateInviteID(w, r)
+	if !ok {
+		return // Error response already sent
+	}
+
+	// Fetch list and verify ownership
+	list, ok := h.fetchList(w, r, listID)
+	if !ok {
+		return // Error response already sent
+	}
+
+	// Only the owner can revoke invites
+	if !utils.CheckListPermission(w, list, userID, models.PermissionManageSharing) {
+		return // Error response already sent
+	}
+
+	ctx, cancel := h.OperationContext(r)
+	defer cancel()
+
+	if err := h.Stores.Invites.Revoke(ctx, listID, inviteID, h.Now()); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			utils.ErrorResponse(w, apierr.InviteNotFound)
+			return
+		}
+		utils.ErrorResponse(w, apierr.Unexpected(err, "Failed to revoke invite"))
+		return
+	}
+
+	utils.JSONResponse(w, http.StatusOK, map[string]string{"message": "Invite revoked successfully"})
+}
+
+// inviteToResponse converts an Invite model to InviteResponse
+func inviteToResponse(invite *models.Invite, token string) models.InviteResponse {
+	return models.InviteResponse{
+		ID:        invite.ID.Hex(),
+		ListID:    invite.ListID.Hex(),
+		Token:     token,
+		Role:      invite.Role,
+		MaxUses:   invite.MaxUses,
+		Uses:      invite.Uses,
+		ExpiresAt: invite.ExpiresAt,
+		CreatedAt: invite.CreatedAt,
+	}
+}
@@ -2,21 +2,22 @@ package handlers
 
 import (
 	"context"
+	"errors"
 	"net/http"
-	"time"
 
-	"bryce-stabenow/grocer-me/config"
-	"bryce-stabenow/grocer-me/middleware"
+	"bryce-stabenow/grocer-me/apierr"
+	"bryce-stabenow/grocer-me/events"
+	"bryce-stabenow/grocer-me/metrics"
 	"bryce-stabenow/grocer-me/models"
+	"bryce-stabenow/grocer-me/store"
+	"bryce-stabenow/grocer-me/tracing"
 	"bryce-stabenow/grocer-me/utils"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/v2/bson"
-	"go.mongodb.org/mongo-driver/v2/mongo/options"
 )
 
 // HandleCreateList handles creating a new list
-func HandleCreateList(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) HandleCreateList(w http.ResponseWriter, r *http.Request) {
 	// Get authenticated user ID
 	userID, ok := utils.GetAuthenticatedUser(w, r)
 	if !ok {
@@ -26,93 +27,73 @@ func HandleCreateList(w http.ResponseWriter, r *http.Request) {
 	// Parse request body
 	var req models.CreateListRequest
 	if err := utils.DecodeJSON(r, &req); err != nil {
-		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+		utils.DecodeErrorResponse(w, err)
 		return
 	}
 
 	// Create list
-	collection := config.DB.Collection("lists")
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := h.OperationContext(r)
 	defer cancel()
 
-	now := time.Now()
+	now := h.Now()
 	list := models.List{
 		ID:          primitive.NewObjectID(),
 		UserID:      userID,
 		Name:        req.Name,
 		Description: req.Description,
 		Items:       []models.ListItem{},
-		SharedWith:  []primitive.ObjectID{},
+		SharedWith:  []models.Collaborator{},
+		Version:     1,
 		CreatedAt:   now,
 		UpdatedAt:   now,
 	}
 
-	result, err := collection.InsertOne(ctx, list)
-	if err != nil {
-		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to create list")
+	if err := h.Stores.Lists.Create(ctx, &list); err != nil {
+		utils.ErrorResponse(w, apierr.Unexpected(err, "Failed to create list"))
 		return
 	}
+	metrics.ListsCreated.Inc()
 
 	// Fetch the created list to return
-	var createdList models.List
-	err = collection.FindOne(ctx, bson.M{"_id": result.InsertedID}).Decode(&createdList)
+	createdList, err := h.Stores.Lists.Get(ctx, list.ID)
 	if err != nil {
-		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to retrieve created list")
+		utils.ErrorResponse(w, apierr.Unexpected(err, "Failed to retrieve created list"))
 		return
 	}
 
-	// Convert to response format
-	response := listToResponse(&createdList)
-	utils.JSONResponse(w, http.StatusCreated, response)
+	// Return the list with its version as the ETag
+	h.writeListResponse(w, r, http.StatusCreated, createdList)
 }
 
 // HandleGetLists handles getting all lists for the authenticated user
-func HandleGetLists(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) HandleGetLists(w http.ResponseWriter, r *http.Request) {
 	// Get authenticated user ID
 	userID, ok := utils.GetAuthenticatedUser(w, r)
 	if !ok {
 		return // Error response already sent
 	}
 
-	// Find lists where user is owner or in shared_with array
-	collection := config.DB.Collection("lists")
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	// Find lists where user is owner or collaborator
+	ctx, cancel := h.OperationContext(r)
 	defer cancel()
 
-	filter := bson.M{
-		"$or": []bson.M{
-			{"user_id": userID},
-			{"shared_with": userID},
-		},
-	}
-
-	// Sort by created_at descending
-	opts := options.Find().SetSort(bson.M{"created_at": -1})
-
-	cursor, err := collection.Find(ctx, filter, opts)
+	lists, err := h.Stores.Lists.ListForUser(ctx, userID)
 	if err != nil {
-		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to fetch lists")
-		return
-	}
-	defer cursor.Close(ctx)
-
-	var lists []models.List
-	if err = cursor.All(ctx, &lists); err != nil {
-		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to decode lists")
+		utils.ErrorResponse(w, apierr.Unexpected(err, "Failed to fetch lists"))
 		return
 	}
 
 	// Convert to response format
 	responses := make([]models.ListResponse, len(lists))
 	for i, list := range lists {
-		responses[i] = listToResponse(&list)
+		responses[i] = h.listToResponse(ctx, &list)
 	}
 
 	utils.JSONResponse(w, http.StatusOK, responses)
 }
 
 // HandleGetList handles getting a single list by ID
-func HandleGetList(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) HandleGetList(w http.ResponseWriter, r *http.Request) {
 	// Get authenticated user ID
 	userID, ok := utils.GetAuthenticatedUser(w, r)
 	if !ok {
@@ -126,23 +107,22 @@ func HandleGetList(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Fetch list
-	list, ok := utils.FetchList(w, listID)
+	list, ok := h.fetchList(w, r, listID)
 	if !ok {
 		return // Error response already sent
 	}
 
 	// Check if user has access
-	if !utils.CheckListAccess(w, list, userID) {
+	if !utils.CheckListPermission(w, list, userID, models.PermissionView) {
 		return // Error response already sent
 	}
 
-	// Convert to response format
-	response := listToResponse(list)
-	utils.JSONResponse(w, http.StatusOK, response)
+	// Return the list with its version as the ETag
+	h.writeListResponse(w, r, http.StatusOK, list)
 }
 
 // HandleUpdateList handles updating a list
-func HandleUpdateList(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) HandleUpdateList(w http.ResponseWriter, r *http.Request) {
 	// Get authenticated user ID
 	userID, ok := utils.GetAuthenticatedUser(w, r)
 	if !ok {
@@ -158,62 +138,62 @@ func HandleUpdateList(w http.ResponseWriter, r *http.Request) {
 	// Parse request body
 	var req models.UpdateListRequest
 	if err := utils.DecodeJSON(r, &req); err != nil {
-		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+		utils.DecodeErrorResponse(w, err)
 		return
 	}
 
 	// Fetch list and verify access
-	list, ok := utils.FetchList(w, listID)
+	list, ok := h.fetchList(w, r, listID)
 	if !ok {
 		return // Error response already sent
 	}
 
-	// Check if user has access
-	if !utils.CheckListAccess(w, list, userID) {
+	// Check if user can edit the list
+	if !utils.CheckListPermission(w, list, userID, models.PermissionEditList) {
 		return // Error response already sent
 	}
 
-	// Build update document
-	collection := config.DB.Collection("lists")
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	update := bson.M{
-		"updated_at": time.Now(),
+	// Reject stale writes from clients holding an old version
+	if !utils.CheckIfMatch(w, r, list) {
+		return // Error response already sent
 	}
+
+	// Build update
+	var update store.ListUpdate
 	if req.Name != "" {
-		update["name"] = req.Name
+		update.Name = &req.Name
 	}
 	if req.Description != "" {
-		update["description"] = req.Description
+		update.Description = &req.Description
 	}
 
-	// Update the list
-	_, err := collection.UpdateOne(
-		ctx,
-		bson.M{"_id": listID},
-		bson.M{"$set": update},
-	)
-	if err != nil {
-		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to update list")
-		return
-	}
+	// Update the list, retrying against concurrent changes unless the client named a version
+	ctx, cancel := h.OperationContext(r)
+	defer cancel()
 
-	// Fetch the updated list to return
-	var updatedList models.List
-	err = collection.FindOne(ctx, bson.M{"_id": listID}).Decode(&updatedList)
+	updatedList, err := h.writeList(ctx, r, list, func(list *models.List) (*models.List, error) {
+		if err := utils.ListPermissionError(list, userID, models.PermissionEditList); err != nil {
+			return nil, err
+		}
+		return h.Stores.Lists.Update(ctx, listID, list.Version, update, h.Now())
+	})
 	if err != nil {
-		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to retrieve updated list")
+		writeStoreError(w, err, apierr.ListNotFound, "Failed to update list")
 		return
 	}
 
-	// Convert to response format
-	response := listToResponse(&updatedList)
-	utils.JSONResponse(w, http.StatusOK, response)
+	// Notify subscribers
+	h.publishListEvent(updatedList, events.ListRenamed, models.ListEvent{
+		Name:        updatedList.Name,
+		Description: updatedList.Description,
+	})
+
+	// Return the list with its version as the ETag
+	h.writeListResponse(w, r, http.StatusOK, updatedList)
 }
 
 // HandleAddListItem handles adding an item to a list
-func HandleAddListItem(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) HandleAddListItem(w http.ResponseWriter, r *http.Request) {
 	// Get authenticated user ID
 	userID, ok := utils.GetAuthenticatedUser(w, r)
 	if !ok {
@@ -229,7 +209,7 @@ func HandleAddListItem(w http.ResponseWriter, r *http.Request) {
 	// Parse request body
 	var req models.AddListItemRequest
 	if err := utils.DecodeJSON(r, &req); err != nil {
-		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+		utils.DecodeErrorResponse(w, err)
 		return
 	}
 
@@ -240,326 +220,268 @@ func HandleAddListItem(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Fetch list and verify access
-	list, ok := utils.FetchList(w, listID)
+	list, ok := h.fetchList(w, r, listID)
 	if !ok {
 		return // Error response already sent
 	}
 
-	// Check if user has access
-	if !utils.CheckListAccess(w, list, userID) {
+	// Check if user can edit items
+	if !utils.CheckListPermission(w, list, userID, models.PermissionEditItems) {
 		return // Error response already sent
 	}
 
-	// Create new item
-	collection := config.DB.Collection("lists")
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+	// Reject stale writes from clients holding an old version
+	if !utils.CheckIfMatch(w, r, list) {
+		return // Error response already sent
+	}
 
-	now := time.Now()
+	// Create new item
 	newItem := models.ListItem{
+		ID:       primitive.NewObjectID(),
 		Name:     req.Name,
 		Quantity: quantity,
 		Checked:  false,
 		Details:  req.Details,
 		AddedBy:  userID,
-		AddedAt:  now,
+		AddedAt:  h.Now(),
 	}
 
-	// Add item to list and update updated_at
-	update := bson.M{
-		"$push": bson.M{"items": newItem},
-		"$set":  bson.M{"updated_at": now},
-	}
+	// Add item to list
+	ctx, cancel := h.OperationContext(r)
+	defer cancel()
 
-	_, err := collection.UpdateOne(
-		ctx,
-		bson.M{"_id": listID},
-		update,
-	)
+	updatedList, err := h.writeList(ctx, r, list, func(list *models.List) (*models.List, error) {
+		if err := utils.ListPermissionError(list, userID, models.PermissionEditItems); err != nil {
+			return nil, err
+		}
+		return h.Stores.Lists.AddItem(ctx, listID, list.Version, newItem, h.Now())
+	})
 	if err != nil {
-		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to add item to list")
+		writeStoreError(w, err, apierr.ListNotFound, "Failed to add item to list")
 		return
 	}
+	metrics.ItemsAdded.Inc()
 
-	// Fetch the updated list to return
-	var updatedList models.List
-	err = collection.FindOne(ctx, bson.M{"_id": listID}).Decode(&updatedList)
-	if err != nil {
-		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to retrieve updated list")
-		return
-	}
+	// Notify subscribers
+	h.publishListEvent(updatedList, events.ItemAdded, models.ListEvent{Item: &newItem})
 
-	// Convert to response format
-	response := listToResponse(&updatedList)
-	utils.JSONResponse(w, http.StatusOK, response)
+	// Return the list with its version as the ETag
+	h.writeListResponse(w, r, http.StatusOK, updatedList)
 }
 
 // HandleUpdateListItemChecked handles updating an item's checked state
-func HandleUpdateListItemChecked(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) HandleUpdateListItemChecked(w http.ResponseWriter, r *http.Request) {
 	// Get authenticated user ID
 	userID, ok := utils.GetAuthenticatedUser(w, r)
 	if !ok {
 		return // Error response already sent
 	}
 
-	// Get and validate list ID
+	// Get and validate list and item IDs
 	listID, ok := utils.GetAndValidateListID(w, r)
 	if !ok {
 		return // Error response already sent
 	}
+	itemID, ok := utils.GetAndValidateItemID(w, r)
+	if !ok {
+		return // Error response already sent
+	}
 
 	// Parse request body
 	var req models.UpdateListItemCheckedRequest
 	if err := utils.DecodeJSON(r, &req); err != nil {
-		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+		utils.DecodeErrorResponse(w, err)
 		return
 	}
 
 	// Fetch list and verify access
-	list, ok := utils.FetchList(w, listID)
+	list, ok := h.fetchList(w, r, listID)
 	if !ok {
 		return // Error response already sent
 	}
 
-	// Check if user has access
-	if !utils.CheckListAccess(w, list, userID) {
+	// Check if user can check items (viewers included)
+	if !utils.CheckListPermission(w, list, userID, models.PermissionCheckItems) {
 		return // Error response already sent
 	}
 
-	// Validate index
-	if req.Index == nil {
-		utils.ErrorResponse(w, http.StatusBadRequest, "Index is required")
-		return
+	// Reject stale writes from clients holding an old version
+	if !utils.CheckIfMatch(w, r, list) {
+		return // Error response already sent
 	}
 
-	index := *req.Index
-	if index < 0 || index >= len(list.Items) {
-		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid item index")
-		return
+	// Verify the item exists
+	if _, ok := utils.FindListItem(w, list, itemID); !ok {
+		return // Error response already sent
 	}
 
-	// Update the item's checked state
-	collection := config.DB.Collection("lists")
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	// Update the item's checked state in place
+	ctx, cancel := h.OperationContext(r)
 	defer cancel()
 
-	now := time.Now()
-	
-	// Update the item in the slice
-	list.Items[index].Checked = req.Checked
-
-	// Update the entire items array and updated_at in the database
-	_, err := collection.UpdateOne(
-		ctx,
-		bson.M{"_id": listID},
-		bson.M{
-			"$set": bson.M{
-				"items":      list.Items,
-				"updated_at": now,
-			},
-		},
-	)
+	update := store.ItemUpdate{Checked: &req.Checked}
+	updatedList, err := h.writeList(ctx, r, list, func(list *models.List) (*models.List, error) {
+		if err := utils.ListPermissionError(list, userID, models.PermissionCheckItems); err != nil {
+			return nil, err
+		}
+		return h.Stores.Lists.UpdateItem(ctx, listID, list.Version, itemID, update, h.Now())
+	})
 	if err != nil {
-		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to update item")
+		writeStoreError(w, err, apierr.ItemNotFound, "Failed to update item")
 		return
 	}
 
-	// Fetch the updated list to return
-	var updatedList models.List
-	err = collection.FindOne(ctx, bson.M{"_id": listID}).Decode(&updatedList)
-	if err != nil {
-		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to retrieve updated list")
-		return
-	}
+	// Notify subscribers
+	h.publishListEvent(updatedList, events.ItemChecked, models.ListEvent{Item: findItem(updatedList, itemID)})
 
-	// Convert to response format
-	response := listToResponse(&updatedList)
-	utils.JSONResponse(w, http.StatusOK, response)
+	// Return the list with its version as the ETag
+	h.writeListResponse(w, r, http.StatusOK, updatedList)
 }
 
 // HandleUpdateListItem handles updating an item's name, details, and quantity
-func HandleUpdateListItem(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) HandleUpdateListItem(w http.ResponseWriter, r *http.Request) {
 	// Get authenticated user ID
 	userID, ok := utils.GetAuthenticatedUser(w, r)
 	if !ok {
 		return // Error response already sent
 	}
 
-	// Get and validate list ID
+	// Get and validate list and item IDs
 	listID, ok := utils.GetAndValidateListID(w, r)
 	if !ok {
 		return // Error response already sent
 	}
+	itemID, ok := utils.GetAndValidateItemID(w, r)
+	if !ok {
+		return // Error response already sent
+	}
 
 	// Parse request body
 	var req models.UpdateListItemRequest
 	if err := utils.DecodeJSON(r, &req); err != nil {
-		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+		utils.DecodeErrorResponse(w, err)
 		return
 	}
 
 	// Fetch list and verify access
-	list, ok := utils.FetchList(w, listID)
+	list, ok := h.fetchList(w, r, listID)
 	if !ok {
 		return // Error response already sent
 	}
 
-	// Check if user has access
-	if !utils.CheckListAccess(w, list, userID) {
+	// Check if user can edit items
+	if !utils.CheckListPermission(w, list, userID, models.PermissionEditItems) {
 		return // Error response already sent
 	}
 
-	// Validate index
-	if req.Index == nil {
-		utils.ErrorResponse(w, http.StatusBadRequest, "Index is required")
-		return
-	}
-
-	index := *req.Index
-	if index < 0 || index >= len(list.Items) {
-		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid item index")
-		return
+	// Reject stale writes from clients holding an old version
+	if !utils.CheckIfMatch(w, r, list) {
+		return // Error response already sent
 	}
 
-	// Validate details length if provided
-	if req.Details != nil && len(*req.Details) > 512 {
-		utils.ErrorResponse(w, http.StatusBadRequest, "Details must be 512 characters or less")
-		return
+	// Verify the item exists
+	if _, ok := utils.FindListItem(w, list, itemID); !ok {
+		return // Error response already sent
 	}
 
-	// Update the item's fields
-	collection := config.DB.Collection("lists")
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	now := time.Now()
-	
 	// Update fields if provided
+	var update store.ItemUpdate
 	if req.Name != "" {
-		list.Items[index].Name = req.Name
+		update.Name = &req.Name
 	}
 	if req.Quantity != nil && *req.Quantity > 0 {
-		list.Items[index].Quantity = *req.Quantity
+		update.Quantity = req.Quantity
 	}
 	if req.Details != nil {
 		// Allow empty string to clear the details field
-		list.Items[index].Details = *req.Details
-	}
-
-	// Update the entire items array and updated_at in the database
-	_, err := collection.UpdateOne(
-		ctx,
-		bson.M{"_id": listID},
-		bson.M{
-			"$set": bson.M{
-				"items":      list.Items,
-				"updated_at": now,
-			},
-		},
-	)
-	if err != nil {
-		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to update item")
-		return
+		update.Details = req.Details
 	}
 
-	// Fetch the updated list to return
-	var updatedList models.List
-	err = collection.FindOne(ctx, bson.M{"_id": listID}).Decode(&updatedList)
+	// Update only the matched item
+	ctx, cancel := h.OperationContext(r)
+	defer cancel()
+
+	updatedList, err := h.writeList(ctx, r, list, func(list *models.List) (*models.List, error) {
+		if err := utils.ListPermissionError(list, userID, models.PermissionEditItems); err != nil {
+			return nil, err
+		}
+		return h.Stores.Lists.UpdateItem(ctx, listID, list.Version, itemID, update, h.Now())
+	})
 	if err != nil {
-		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to retrieve updated list")
+		writeStoreError(w, err, apierr.ItemNotFound, "Failed to update item")
 		return
 	}
 
-	// Convert to response format
-	response := listToResponse(&updatedList)
-	utils.JSONResponse(w, http.StatusOK, response)
+	// Notify subscribers
+	h.publishListEvent(updatedList, events.ItemUpdated, models.ListEvent{Item: findItem(updatedList, itemID)})
+
+	// Return the list with its version as the ETag
+	h.writeListResponse(w, r, http.StatusOK, updatedList)
 }
 
 // HandleDeleteListItem handles deleting an item from a list
-func HandleDeleteListItem(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) HandleDeleteListItem(w http.ResponseWriter, r *http.Request) {
 	// Get authenticated user ID
 	userID, ok := utils.GetAuthenticatedUser(w, r)
 	if !ok {
 		return // Error response already sent
 	}
 
-	// Get and validate list ID
+	// Get and validate list and item IDs
 	listID, ok := utils.GetAndValidateListID(w, r)
 	if !ok {
 		return // Error response already sent
 	}
-
-	// Parse request body
-	var req models.DeleteListItemRequest
-	if err := utils.DecodeJSON(r, &req); err != nil {
-		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
-		return
+	itemID, ok := utils.GetAndValidateItemID(w, r)
+	if !ok {
+		return // Error response already sent
 	}
 
 	// Fetch list and verify access
-	list, ok := utils.FetchList(w, listID)
+	list, ok := h.fetchList(w, r, listID)
 	if !ok {
 		return // Error response already sent
 	}
 
-	// Check if user has access
-	if !utils.CheckListAccess(w, list, userID) {
+	// Check if user can edit items
+	if !utils.CheckListPermission(w, list, userID, models.PermissionEditItems) {
 		return // Error response already sent
 	}
 
-	// Validate index
-	if req.Index == nil {
-		utils.ErrorResponse(w, http.StatusBadRequest, "Index is required")
-		return
+	// Reject stale writes from clients holding an old version
+	if !utils.CheckIfMatch(w, r, list) {
+		return // Error response already sent
 	}
 
-	index := *req.Index
-	if index < 0 || index >= len(list.Items) {
-		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid item index")
-		return
+	// Verify the item exists
+	if _, ok := utils.FindListItem(w, list, itemID); !ok {
+		return // Error response already sent
 	}
 
-	// Remove the item from the slice
-	collection := config.DB.Collection("lists")
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	// Remove the item from the list
+	ctx, cancel := h.OperationContext(r)
 	defer cancel()
 
-	updatedItems := make([]models.ListItem, 0, len(list.Items)-1)
-	updatedItems = append(updatedItems, list.Items[:index]...)
-	updatedItems = append(updatedItems, list.Items[index+1:]...)
-
-	// Update the items array and updated_at in the database
-	now := time.Now()
-	_, err := collection.UpdateOne(
-		ctx,
-		bson.M{"_id": listID},
-		bson.M{
-			"$set": bson.M{
-				"items":      updatedItems,
-				"updated_at": now,
-			},
-		},
-	)
+	updatedList, err := h.writeList(ctx, r, list, func(list *models.List) (*models.List, error) {
+		if err := utils.ListPermissionError(list, userID, models.PermissionEditItems); err != nil {
+			return nil, err
+		}
+		return h.Stores.Lists.DeleteItem(ctx, listID, list.Version, itemID, h.Now())
+	})
 	if err != nil {
-		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to delete item")
+		writeStoreError(w, err, apierr.ItemNotFound, "Failed to delete item")
 		return
 	}
 
-	// Fetch the updated list to return
-	var updatedList models.List
-	err = collection.FindOne(ctx, bson.M{"_id": listID}).Decode(&updatedList)
-	if err != nil {
-		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to retrieve updated list")
-		return
-	}
+	// Notify subscribers
+	h.publishListEvent(updatedList, events.ItemDeleted, models.ListEvent{ItemID: itemID.Hex()})
 
-	// Convert to response format
-	response := listToResponse(&updatedList)
-	utils.JSONResponse(w, http.StatusOK, response)
+	// Return the list with its version as the ETag
+	h.writeListResponse(w, r, http.StatusOK, updatedList)
 }
 
 // HandleDeleteList handles deleting a list
-func HandleDeleteList(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) HandleDeleteList(w http.ResponseWriter, r *http.Request) {
 	// Get authenticated user ID
 	userID, ok := utils.GetAuthenticatedUser(w, r)
 	if !ok {
@@ -573,158 +495,207 @@ func HandleDeleteList(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Fetch list and verify ownership
-	list, ok := utils.FetchList(w, listID)
+	list, ok := h.fetchList(w, r, listID)
 	if !ok {
 		return // Error response already sent
 	}
 
 	// Only the owner can delete the list
-	if !utils.CheckListOwnership(w, list, userID) {
+	if !utils.CheckListPermission(w, list, userID, models.PermissionDeleteList) {
+		return // Error response already sent
+	}
+
+	// Reject stale writes from clients holding an old version
+	if !utils.CheckIfMatch(w, r, list) {
 		return // Error response already sent
 	}
 
 	// Delete the list
-	collection := config.DB.Collection("lists")
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := h.OperationContext(r)
 	defer cancel()
 
-	_, err := collection.DeleteOne(ctx, bson.M{"_id": listID})
+	_, err := h.writeList(ctx, r, list, func(list *models.List) (*models.List, error) {
+		if err := utils.ListPermissionError(list, userID, models.PermissionDeleteList); err != nil {
+			return nil, err
+		}
+		return list, h.Stores.Lists.Delete(ctx, listID, list.Version)
+	})
 	if err != nil {
-		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to delete list")
+		writeStoreError(w, err, apierr.ListNotFound, "Failed to delete list")
 		return
 	}
 
+	// Disconnect subscribers and drop the list's event history
+	h.Events.Forget(listID.Hex())
+
+	// Outstanding invites can no longer be redeemed
+	if err := h.Stores.Invites.DeleteForList(ctx, listID); err != nil {
+		utils.GetLogger(r).Error("Failed to delete invites for list", "list_id", listID.Hex(), "error", err)
+	}
+
 	utils.JSONResponse(w, http.StatusOK, map[string]string{"message": "List deleted successfully"})
 }
 
-// HandleShareList handles adding the current user to a list's shared_with array
-// This endpoint is public but requires authentication (checked internally)
-func HandleShareList(w http.ResponseWriter, r *http.Request) {
-	// Try to extract user ID from JWT (manual check for this public endpoint)
-	userIDStr, err := middleware.ExtractUserID(r)
-	if err != nil {
-		utils.ErrorResponse(w, http.StatusUnauthorized, "Authentication required. Please sign in to join this list.")
-		return
+// HandleShareList handles redeeming an invite token to join a list
+func (h *Handler) HandleShareList(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.GetAuthenticatedUser(w, r)
+	if !ok {
+		return // Error response already sent
 	}
 
-	userID, err := primitive.ObjectIDFromHex(userIDStr)
-	if err != nil {
-		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid user ID format")
+	// Get invite token
+	token := utils.GetPathParam(r, "token")
+	if token == "" {
+		utils.ErrorResponse(w, apierr.MissingParameter.WithMessage("Invite token is required"))
 		return
 	}
 
-	// Get and validate list ID
-	listID, ok := utils.GetAndValidateListID(w, r)
-	if !ok {
-		return // Error response already sent
+	// Look up the invite by the hash of its token
+	ctx, cancel := h.OperationContext(r)
+	defer cancel()
+
+	invite, err := h.Stores.Invites.GetByTokenHash(ctx, utils.HashToken(token))
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			utils.ErrorResponse(w, apierr.InviteNotFound)
+			return
+		}
+		utils.ErrorResponse(w, apierr.Unexpected(err, "Failed to find invite"))
+		return
 	}
 
 	// Fetch list
-	list, ok := utils.FetchList(w, listID)
+	list, ok := h.fetchList(w, r, invite.ListID)
 	if !ok {
 		return // Error response already sent
 	}
 
-	// Check if user is already the owner
-	if list.UserID == userID {
-		utils.ErrorResponse(w, http.StatusBadRequest, "You are already the owner of this list")
+	// Check if user is already the owner or a collaborator
+	role, alreadyShared := list.RoleOf(userID)
+	if role == models.RoleOwner {
+		utils.ErrorResponse(w, apierr.AlreadyListOwner)
 		return
 	}
 
-	// Check if user is already in shared_with array
-	alreadyShared := false
-	for _, sharedUserID := range list.SharedWith {
-		if sharedUserID == userID {
-			alreadyShared = true
-			break
-		}
+	if alreadyShared {
+		// User is already shared, return the list without using up the invite (idempotent)
+		h.writeListResponse(w, r, http.StatusOK, list)
+		return
 	}
 
-	if alreadyShared {
-		// User is already shared, return the list anyway (idempotent)
-		response := listToResponse(list)
-		utils.JSONResponse(w, http.StatusOK, response)
+	now := h.Now()
+	if !invite.IsUsable(now) {
+		utils.ErrorResponse(w, apierr.InviteExpired)
 		return
 	}
 
-	// Add user to shared_with array
-	collection := config.DB.Collection("lists")
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+	// Reject stale writes from clients holding an old version, before using up the invite
+	if !utils.CheckIfMatch(w, r, list) {
+		return // Error response already sent
+	}
 
-	now := time.Now()
-	_, err = collection.UpdateOne(
-		ctx,
-		bson.M{"_id": listID},
-		bson.M{
-			"$addToSet": bson.M{"shared_with": userID},
-			"$set":      bson.M{"updated_at": now},
-		},
-	)
-	if err != nil {
-		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to add user to shared list")
+	// Consume one use of the invite
+	if err := h.Stores.Invites.Redeem(ctx, invite.ID, now); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			utils.ErrorResponse(w, apierr.InviteExpired)
+			return
+		}
+		utils.ErrorResponse(w, apierr.Unexpected(err, "Failed to redeem invite"))
 		return
 	}
 
-	// Fetch the updated list to return
-	var updatedList models.List
-	err = collection.FindOne(ctx, bson.M{"_id": listID}).Decode(&updatedList)
+	// Add user to shared_with array with the role granted by the invite
+	collaborator := models.Collaborator{UserID: userID, Role: invite.Role}
+	updatedList, added, err := h.addCollaborator(ctx, r, list, collaborator)
+	if !added {
+		// The user didn't join through this use, so give it back; the request
+		// may have timed out, so don't let its context cancel the release
+		if err := h.Stores.Invites.Release(context.WithoutCancel(ctx), invite.ID); err != nil {
+			utils.GetLogger(r).Error("Failed to release invite use", "invite_id", invite.ID.Hex(), "error", err)
+		}
+	}
 	if err != nil {
-		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to retrieve updated list")
+		writeStoreError(w, err, apierr.ListNotFound, "Failed to add user to shared list")
 		return
 	}
+	if !added {
+		// A concurrent request added the user already
+		h.writeListResponse(w, r, http.StatusOK, updatedList)
+		return
+	}
+	metrics.SharesJoined.Inc()
 
-	// Convert to response format
-	response := listToResponse(&updatedList)
-	utils.JSONResponse(w, http.StatusOK, response)
+	// Notify subscribers
+	h.publishListEvent(updatedList, events.MembersChanged, models.ListEvent{UserID: userID.Hex()})
+
+	// Return the list with its version as the ETag
+	h.writeListResponse(w, r, http.StatusOK, updatedList)
+}
+
+// writeListResponse sends a list along with its version as the ETag header
+func (h *Handler) writeListResponse(w http.ResponseWriter, r *http.Request, statusCode int, list *models.List) {
+	response := h.listToResponse(r.Context(), list)
+	utils.SetETag(w, list.Version)
+	utils.JSONResponse(w, statusCode, response)
+}
+
+// writeList applies a versioned write to a list read earlier in the request.
+// If the client's If-Match named a version, a concurrent change fails the
+// write with a conflict; otherwise the client asked for no precondition, so
+// the write is retried against the latest list. write must recheck anything
+// it relies on, such as the user's permission, against the list it is given.
+func (h *Handler) writeList(ctx context.Context, r *http.Request, list *models.List, write func(list *models.List) (*models.List, error)) (*models.List, error) {
+	if utils.HasVersionPrecondition(r) {
+		return write(list)
+	}
+	return h.retryOnConflict(ctx, list, write)
+}
+
+// writeStoreError maps a failed list write to an error response. API errors,
+// such as a permission lost while retrying, are sent as they are.
+func writeStoreError(w http.ResponseWriter, err error, notFound *apierr.Error, failureMessage string) {
+	var apiErr *apierr.Error
+	switch {
+	case errors.As(err, &apiErr):
+		utils.ErrorResponse(w, apiErr)
+	case errors.Is(err, store.ErrVersionConflict):
+		utils.ErrorResponse(w, apierr.ListVersionConflict)
+	case errors.Is(err, store.ErrNotFound):
+		utils.ErrorResponse(w, notFound)
+	default:
+		utils.ErrorResponse(w, apierr.Unexpected(err, failureMessage))
+	}
 }
 
 // listToResponse converts a List model to ListResponse
-func listToResponse(list *models.List) models.ListResponse {
+func (h *Handler) listToResponse(ctx context.Context, list *models.List) models.ListResponse {
+	ctx, span := tracing.Start(ctx, "listToResponse")
+	defer span.End()
+
 	// Fetch user emails for shared_with users
 	sharedWith := make([]models.SharedUser, 0, len(list.SharedWith))
 	if len(list.SharedWith) > 0 {
-		userCollection := config.DB.Collection("users")
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		ctx, cancel := h.StoreContext(ctx)
 		defer cancel()
 
-		// Fetch all users in a single query
-		cursor, err := userCollection.Find(ctx, bson.M{"_id": bson.M{"$in": list.SharedWith}})
+		// Fetch all users in a single query; if it fails, fall back to just IDs
+		userMap := make(map[primitive.ObjectID]string)
+		users, err := h.Stores.Users.GetByIDs(ctx, list.CollaboratorIDs())
 		if err == nil {
-			defer cursor.Close(ctx)
-			
 			// Create a map of user ID to email for quick lookup
-			userMap := make(map[primitive.ObjectID]string)
-			var user models.User
-			for cursor.Next(ctx) {
-				if err := cursor.Decode(&user); err == nil {
-					userMap[user.ID] = user.Email
-				}
+			for _, user := range users {
+				userMap[user.ID] = user.Email
 			}
+		}
 
-			// Build sharedWith array maintaining the original order
-			for _, userID := range list.SharedWith {
-				if email, exists := userMap[userID]; exists {
-					sharedWith = append(sharedWith, models.SharedUser{
-						ID:    userID.Hex(),
-						Email: email,
-					})
-				} else {
-					// If user not found, still include the ID but with empty email
-					sharedWith = append(sharedWith, models.SharedUser{
-						ID:    userID.Hex(),
-						Email: "",
-					})
-				}
-			}
-		} else {
-			// If query fails, fall back to just IDs
-			for _, userID := range list.SharedWith {
-				sharedWith = append(sharedWith, models.SharedUser{
-					ID:    userID.Hex(),
-					Email: "",
-				})
-			}
+		// Build sharedWith array maintaining the original order
+		// If user not found, still include the ID but with empty email
+		for _, collaborator := range list.SharedWith {
+			sharedWith = append(sharedWith, models.SharedUser{
+				ID:    collaborator.UserID.Hex(),
+				Email: userMap[collaborator.UserID],
+				Role:  collaborator.Role,
+			})
 		}
 	}
 
@@ -735,6 +706,7 @@ func listToResponse(list *models.List) models.ListResponse {
 		Description: list.Description,
 		Items:       list.Items,
 		SharedWith:  sharedWith,
+		Version:     list.Version,
 		CreatedAt:   list.CreatedAt,
 		UpdatedAt:   list.UpdatedAt,
 	}
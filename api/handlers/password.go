@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+
+	"bryce-stabenow/grocer-me/apierr"
+	"bryce-stabenow/grocer-me/mailer"
+	"bryce-stabenow/grocer-me/models"
+	"bryce-stabenow/grocer-me/store"
+	"bryce-stabenow/grocer-me/utils"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// passwordResetTTL is how long a password reset link stays valid
+const passwordResetTTL = time.Hour
+
+// passwordResetCooldown is how long after sending a reset link no other is
+// sent while it is still usable, so an address can't be flooded with email
+const passwordResetCooldown = 10 * time.Minute
+
+// HandleForgotPassword handles emailing a password reset link
+func (h *Handler) HandleForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var req models.ForgotPasswordRequest
+	if err := utils.DecodeJSON(r, &req); err != nil {
+		utils.DecodeErrorResponse(w, err)
+		return
+	}
+
+	// The account is looked up in the background and the response is the same
+	// whether or not it exists, so neither the body nor the response time
+	// reveals which emails are registered
+	logger := utils.GetLogger(r)
+	now := h.Now()
+	err := h.Workers.Go(func(ctx context.Context) {
+		h.startPasswordReset(ctx, logger, req.Email, now)
+	})
+	if err != nil {
+		logger.Warn("Failed to start password reset", "error", err)
+	}
+
+	utils.JSONResponse(w, http.StatusOK, map[string]string{"message": "If an account exists for that email, a password reset link has been sent"})
+}
+
+// HandleResetPassword handles choosing a new password with a reset token
+func (h *Handler) HandleResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req models.ResetPasswordRequest
+	if err := utils.DecodeJSON(r, &req); err != nil {
+		utils.DecodeErrorResponse(w, err)
+		return
+	}
+
+	ctx, cancel := h.OperationContext(r)
+	defer cancel()
+
+	// Consume the token so it can't be used twice
+	now := h.Now()
+	reset, err := h.Stores.Resets.Consume(ctx, utils.HashToken(req.Token), now)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			utils.ErrorResponse(w, apierr.ResetTokenInvalid)
+			return
+		}
+		utils.ErrorResponse(w, apierr.Unexpected(err, "Failed to verify reset token"))
+		return
+	}
+
+	// Hash password
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), 10)
+	if err != nil {
+		utils.ErrorResponse(w, apierr.Unexpected(err, "Failed to hash password"))
+		return
+	}
+
+	if err := h.Stores.Users.UpdatePassword(ctx, reset.UserID, string(hashedPassword), now); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			utils.ErrorResponse(w, apierr.ResetTokenInvalid)
+			return
+		}
+		utils.ErrorResponse(w, apierr.Unexpected(err, "Failed to update password"))
+		return
+	}
+
+	// Whoever had the old password is signed out everywhere
+	if err := h.Stores.Resets.InvalidateForUser(ctx, reset.UserID, now); err != nil {
+		utils.GetLogger(r).Error("Failed to invalidate reset tokens", "user_id", reset.UserID.Hex(), "error", err)
+	}
+	if err := h.Stores.Sessions.RevokeAllForUser(ctx, reset.UserID, now); err != nil {
+		utils.GetLogger(r).Error("Failed to revoke sessions", "user_id", reset.UserID.Hex(), "error", err)
+	}
+
+	utils.JSONResponse(w, http.StatusOK, map[string]string{"message": "Password has been reset. Please sign in."})
+}
+
+// startPasswordReset replaces any outstanding reset links for the account
+// with the given email, if there is one, and emails the new link. now is when
+// the link was requested. It runs in the background, so failures are logged
+// rather than returned.
+func (h *Handler) startPasswordReset(ctx context.Context, logger *slog.Logger, email string, now time.Time) {
+	storeCtx, cancel := h.StoreContext(ctx)
+	defer cancel()
+
+	user, err := h.Stores.Users.GetByEmail(storeCtx, email)
+	if err != nil {
+		if !errors.Is(err, store.ErrNotFound) {
+			logger.Error("Failed to find user for password reset", "error", err)
+		}
+		return
+	}
+
+	// Don't send another link while a recent one is still outstanding
+	latest, err := h.Stores.Resets.LatestUsable(storeCtx, user.ID, now)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		logger.Error("Failed to check for outstanding reset tokens", "user_id", user.ID.Hex(), "error", err)
+		return
+	}
+	if latest != nil && now.Sub(latest.CreatedAt) < passwordResetCooldown {
+		logger.Info("Skipped password reset email during cooldown", "user_id", user.ID.Hex())
+		return
+	}
+
+	// Only the most recently requested link works
+	if err := h.Stores.Resets.InvalidateForUser(storeCtx, user.ID, now); err != nil {
+		logger.Error("Failed to invalidate reset tokens", "user_id", user.ID.Hex(), "error", err)
+		return
+	}
+
+	// Generate the token; only its hash is stored
+	token, err := utils.NewRandomToken()
+	if err != nil {
+		logger.Error("Failed to generate reset token", "error", err)
+		return
+	}
+
+	reset := models.PasswordReset{
+		ID:        primitive.NewObjectID(),
+		UserID:    user.ID,
+		TokenHash: utils.HashToken(token),
+		ExpiresAt: now.Add(passwordResetTTL),
+		CreatedAt: now,
+	}
+
+	if err := h.Stores.Resets.Create(storeCtx, &reset); err != nil {
+		logger.Error("Failed to create reset token", "user_id", user.ID.Hex(), "error", err)
+		return
+	}
+
+	h.sendPasswordResetEmail(ctx, logger, user.Email, token)
+}
+
+// sendPasswordResetEmail emails a reset link, logging rather than returning failures
+func (h *Handler) sendPasswordResetEmail(ctx context.Context, logger *slog.Logger, email, token string) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	link := h.Config.AppURL + "/reset-password?token=" + url.QueryEscape(token)
+	msg := mailer.Message{
+		To:      email,
+		Subject: "Reset your GrocerMe password",
+		Body: fmt.Sprintf("Someone asked to reset the password for your GrocerMe account.\n\n"+
+			"To choose a new password, open this link within %d minutes:\n\n%s\n\n"+
+			"If you didn't ask for this, you can ignore this email.\n",
+			int(passwordResetTTL.Minutes()), link),
+	}
+
+	if err := h.Mailer.Send(ctx, msg); err != nil {
+		logger.Error("Failed to send password reset email", "error", err)
+	}
+}
@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"bryce-stabenow/grocer-me/apierr"
+	"bryce-stabenow/grocer-me/middleware"
+	"bryce-stabenow/grocer-me/models"
+	"bryce-stabenow/grocer-me/store"
+	"bryce-stabenow/grocer-me/utils"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	accessTokenCookie  = "jwt_token"
+	refreshTokenCookie = "refresh_token"
+)
+
+// HandleRefreshToken exchanges a refresh token for a new access token,
+// rotating the refresh token in the process
+func (h *Handler) HandleRefreshToken(w http.ResponseWriter, r *http.Request) {
+	// Browsers send the refresh token as a cookie; other clients in the body
+	var refreshToken string
+	if cookie, err := r.Cookie(refreshTokenCookie); err == nil {
+		// The cookie can't be paired with a CSRF token, since the page
+		// refreshing may not have one yet, so other sites are refused by origin
+		if !middleware.CheckOrigin(h.App, w, r) {
+			return // Error response already sent
+		}
+		refreshToken = cookie.Value
+	} else {
+		var req models.RefreshTokenRequest
+		if err := utils.DecodeJSON(r, &req); err != nil {
+			utils.DecodeErrorResponse(w, err)
+			return
+		}
+		refreshToken = req.RefreshToken
+	}
+
+	if refreshToken == "" {
+		utils.ErrorResponse(w, apierr.AuthRequired.WithMessage("Refresh token is required"))
+		return
+	}
+
+	ctx, cancel := h.OperationContext(r)
+	defer cancel()
+
+	// Look up the session by the token's hash
+	tokenHash := utils.HashToken(refreshToken)
+	session, err := h.Stores.Sessions.GetByRefreshTokenHash(ctx, tokenHash)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			h.clearAuthCookies(w)
+			utils.ErrorResponse(w, apierr.RefreshTokenInvalid)
+			return
+		}
+		utils.ErrorResponse(w, apierr.Unexpected(err, "Failed to find session"))
+		return
+	}
+
+	now := h.Now()
+
+	// A rotated token being replayed means it may have been stolen, so the
+	// whole session is revoked unless this is a near-simultaneous refresh with
+	// the token the last rotation replaced
+	if session.RefreshTokenHash != tokenHash {
+		concurrent := tokenHash == session.LastRotatedTokenHash() && now.Sub(session.LastUsedAt) < h.Config.Auth.RefreshReuseGrace
+		if !concurrent {
+			if err := h.Stores.Sessions.Revoke(ctx, session.ID, now); err != nil && !errors.Is(err, store.ErrNotFound) {
+				utils.ErrorResponse(w, apierr.Unexpected(err, "Failed to revoke session"))
+				return
+			}
+			h.clearAuthCookies(w)
+		}
+		utils.ErrorResponse(w, apierr.RefreshTokenReused)
+		return
+	}
+
+	if !session.IsActive(now) {
+		h.clearAuthCookies(w)
+		utils.ErrorResponse(w, apierr.SessionEnded)
+		return
+	}
+
+	// Rotate the refresh token; losing a race with another refresh counts as reuse
+	newRefreshToken, err := utils.NewRandomToken()
+	if err != nil {
+		utils.ErrorResponse(w, apierr.Unexpected(err, "Failed to generate token"))
+		return
+	}
+
+	err = h.Stores.Sessions.Rotate(ctx, session.ID, tokenHash, utils.HashToken(newRefreshToken), now, now.Add(h.Config.Auth.RefreshTokenTTL))
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			utils.ErrorResponse(w, apierr.RefreshTokenReused)
+			return
+		}
+		utils.ErrorResponse(w, apierr.Unexpected(err, "Failed to refresh session"))
+		return
+	}
+
+	// Issue a new access token for the same session
+	accessToken, expiresAt, err := h.generateToken(session.UserID.Hex(), session.ID.Hex())
+	if err != nil {
+		utils.ErrorResponse(w, apierr.Unexpected(err, "Failed to generate token"))
+		return
+	}
+
+	h.setAuthCookies(w, accessToken, newRefreshToken)
+
+	utils.JSONResponse(w, http.StatusOK, models.TokenResponse{
+		Token:        accessToken,
+		RefreshToken: newRefreshToken,
+		ExpiresAt:    expiresAt,
+	})
+}
+
+// HandleLogoutAll handles signing the user out of every device
+func (h *Handler) HandleLogoutAll(w http.ResponseWriter, r *http.Request) {
+	// Get authenticated user ID
+	userID, ok := utils.GetAuthenticatedUser(w, r)
+	if !ok {
+		return // Error response already sent
+	}
+
+	ctx, cancel := h.OperationContext(r)
+	defer cancel()
+
+	if err := h.Stores.Sessions.RevokeAllForUser(ctx, userID, h.Now()); err != nil {
+		utils.ErrorResponse(w, apierr.Unexpected(err, "Failed to revoke sessions"))
+		return
+	}
+
+	h.clearAuthCookies(w)
+
+	utils.JSONResponse(w, http.StatusOK, map[string]string{"message": "Logged out of all devices successfully"})
+}
+
+// HandleCSRFToken returns the CSRF token for the current session
+func (h *Handler) HandleCSRFToken(w http.ResponseWriter, r *http.Request) {
+	sessionID, _ := utils.GetSessionID(r)
+
+	// Keep the token out of caches
+	w.Header().Set("Cache-Control", "no-store")
+	utils.JSONResponse(w, http.StatusOK, models.CSRFTokenResponse{CSRFToken: middleware.CSRFToken(h.App, sessionID)})
+}
+
+// sessionTokens holds the credentials issued when a session starts
+type sessionTokens struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresAt    time.Time
+}
+
+// startSession creates a session for a newly authenticated user and sets its
+// tokens as cookies
+func (h *Handler) startSession(ctx context.Context, w http.ResponseWriter, r *http.Request, userID primitive.ObjectID) (*sessionTokens, error) {
+	refreshToken, err := utils.NewRandomToken()
+	if err != nil {
+		return nil, err
+	}
+
+	now := h.Now()
+	session := models.Session{
+		ID:               primitive.NewObjectID(),
+		UserID:           userID,
+		RefreshTokenHash: utils.HashToken(refreshToken),
+		UserAgent:        r.UserAgent(),
+		CreatedAt:        now,
+		LastUsedAt:       now,
+		ExpiresAt:        now.Add(h.Config.Auth.RefreshTokenTTL),
+	}
+
+	if err := h.Stores.Sessions.Create(ctx, &session); err != nil {
+		return nil, err
+	}
+
+	accessToken, expiresAt, err := h.generateToken(userID.Hex(), session.ID.Hex())
+	if err != nil {
+		return nil, err
+	}
+
+	h.setAuthCookies(w, accessToken, refreshToken)
+
+	return &sessionTokens{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresAt:    expiresAt,
+	}, nil
+}
+
+// setAuthCookies stores the access and refresh tokens in HTTP-only cookies
+func (h *Handler) setAuthCookies(w http.ResponseWriter, accessToken, refreshToken string) {
+	utils.SetCookie(w, accessTokenCookie, accessToken, int(h.Config.Auth.AccessTokenTTL.Seconds()), "/", "", h.Config.Auth.Secure(), true, h.Config.Auth.SameSite())
+	utils.SetCookie(w, refreshTokenCookie, refreshToken, int(h.Config.Auth.RefreshTokenTTL.Seconds()), "/", "", h.Config.Auth.Secure(), true, h.Config.Auth.SameSite())
+}
+
+// clearAuthCookies expires both auth cookies
+func (h *Handler) clearAuthCookies(w http.ResponseWriter) {
+	utils.SetCookie(w, accessTokenCookie, "", -1, "/", "", h.Config.Auth.Secure(), true, h.Config.Auth.SameSite())
+	utils.SetCookie(w, refreshTokenCookie, "", -1, "/", "", h.Config.Auth.Secure(), true, h.Config.Auth.SameSite())
+}
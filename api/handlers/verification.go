@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+
+	"bryce-stabenow/grocer-me/apierr"
+	"bryce-stabenow/grocer-me/mailer"
+	"bryce-stabenow/grocer-me/models"
+	"bryce-stabenow/grocer-me/store"
+	"bryce-stabenow/grocer-me/utils"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// emailVerificationTTL is how long an email verification link stays valid
+const emailVerificationTTL = 24 * time.Hour
+
+// HandleVerifyEmail handles confirming an email address from an emailed link
+func (h *Handler) HandleVerifyEmail(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		utils.ErrorResponse(w, apierr.MissingParameter.WithMessage("Verification token is required"))
+		return
+	}
+
+	ctx, cancel := h.OperationContext(r)
+	defer cancel()
+
+	// Consume the token so it can't be used twice
+	now := h.Now()
+	verification, err := h.Stores.Verifications.Consume(ctx, utils.HashToken(token), now)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			utils.ErrorResponse(w, apierr.VerificationInvalid)
+			return
+		}
+		utils.ErrorResponse(w, apierr.Unexpected(err, "Failed to verify email"))
+		return
+	}
+
+	// The link only verifies the address it was sent to
+	if err := h.Stores.Users.MarkEmailVerified(ctx, verification.UserID, verification.Email, now); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			utils.ErrorResponse(w, apierr.VerificationInvalid)
+			return
+		}
+		utils.ErrorResponse(w, apierr.Unexpected(err, "Failed to verify email"))
+		return
+	}
+
+	utils.JSONResponse(w, http.StatusOK, map[string]string{"message": "Email verified successfully"})
+}
+
+// HandleResendVerification handles emailing a fresh verification link to the current user
+func (h *Handler) HandleResendVerification(w http.ResponseWriter, r *http.Request) {
+	// Get authenticated user ID
+	userID, ok := utils.GetAuthenticatedUser(w, r)
+	if !ok {
+		return // Error response already sent
+	}
+
+	ctx, cancel := h.OperationContext(r)
+	defer cancel()
+
+	user, err := h.Stores.Users.GetByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			utils.ErrorResponse(w, apierr.UserNotFound)
+			return
+		}
+		utils.ErrorResponse(w, apierr.Unexpected(err, "Failed to find user"))
+		return
+	}
+
+	if user.EmailVerified {
+		utils.ErrorResponse(w, apierr.EmailAlreadyVerified)
+		return
+	}
+
+	if err := h.startEmailVerification(ctx, utils.GetLogger(r), user); err != nil {
+		utils.ErrorResponse(w, apierr.Unexpected(err, "Failed to send verification email"))
+		return
+	}
+
+	utils.JSONResponse(w, http.StatusOK, map[string]string{"message": "Verification email sent"})
+}
+
+// startEmailVerification replaces any outstanding verification links for a
+// user with a new one and emails it in the background
+func (h *Handler) startEmailVerification(ctx context.Context, logger *slog.Logger, user *models.User) error {
+	// Only the most recently sent link works
+	now := h.Now()
+	if err := h.Stores.Verifications.InvalidateForUser(ctx, user.ID, now); err != nil {
+		return err
+	}
+
+	// Generate the token; only its hash is stored
+	token, err := utils.NewRandomToken()
+	if err != nil {
+		return err
+	}
+
+	verification := models.EmailVerification{
+		ID:        primitive.NewObjectID(),
+		UserID:    user.ID,
+		Email:     user.Email,
+		TokenHash: utils.HashToken(token),
+		ExpiresAt: now.Add(emailVerificationTTL),
+		CreatedAt: now,
+	}
+
+	if err := h.Stores.Verifications.Create(ctx, &verification); err != nil {
+		return err
+	}
+
+	return h.Workers.Go(func(ctx context.Context) {
+		h.sendVerificationEmail(ctx, logger, user.Email, token)
+	})
+}
+
+// sendVerificationEmail emails a verification link, logging rather than returning failures
+func (h *Handler) sendVerificationEmail(ctx context.Context, logger *slog.Logger, email, token string) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	link := h.Config.AppURL + "/verify-email?token=" + url.QueryEscape(token)
+	msg := mailer.Message{
+		To:      email,
+		Subject: "Verify your GrocerMe email address",
+		Body: fmt.Sprintf("Welcome to GrocerMe!\n\n"+
+			"Please confirm your email address by opening this link within %d hours:\n\n%s\n\n"+
+			"If you didn't create an account, you can ignore this email.\n",
+			int(emailVerificationTTL.Hours()), link),
+	}
+
+	if err := h.Mailer.Send(ctx, msg); err != nil {
+		logger.Error("Failed to send verification email", "error", err)
+	}
+}
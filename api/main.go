@@ -2,97 +2,198 @@ package main
 
 import (
 	"context"
-	"fmt"
+	"flag"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
 
+	"bryce-stabenow/grocer-me/app"
 	"bryce-stabenow/grocer-me/config"
-	"bryce-stabenow/grocer-me/handlers"
-	"bryce-stabenow/grocer-me/middleware"
-	"bryce-stabenow/grocer-me/utils"
+	"bryce-stabenow/grocer-me/mailer"
+	"bryce-stabenow/grocer-me/metrics"
+	"bryce-stabenow/grocer-me/server"
+	"bryce-stabenow/grocer-me/store"
+	"bryce-stabenow/grocer-me/tracing"
 
+	"github.com/joho/godotenv"
 	"go.mongodb.org/mongo-driver/v2/mongo"
 	"go.mongodb.org/mongo-driver/v2/mongo/options"
 	"go.mongodb.org/mongo-driver/v2/mongo/readpref"
 )
 
 func main() {
-	// Initialize config (loads JWT_SECRET)
-	config.Init()
+	// Load .env file from project root (ignore error if it doesn't exist)
+	_ = godotenv.Load("../.env")
 
-	// Get MongoDB URI from environment variable
-	mongoURI := config.GetMongoURI()
+	// Load and validate the configuration
+	flags := flag.NewFlagSet("api", flag.ExitOnError)
+	printConfig := flags.Bool("print-config", false, "print the configuration, with secrets redacted, and exit")
+	cfg, err := config.Load(flags, os.Args[1:], os.Getenv)
+	if err != nil {
+		log.Fatalf("Invalid configuration:\n%v", err)
+	}
+	// --print-config shows the settings even when they're invalid, then
+	// reports the problems and exits non-zero, so it can check a config
+	validateErr := cfg.Validate()
+	if *printConfig {
+		if err := cfg.Print(os.Stdout); err != nil {
+			log.Fatal("Failed to print configuration:", err)
+		}
+	}
+	if validateErr != nil {
+		log.Fatalf("Invalid configuration:\n%v", validateErr)
+	}
+	if *printConfig {
+		return
+	}
+
+	// Set up structured logging; the standard log package writes through it too
+	logger := newLogger(cfg.Log)
+	slog.SetDefault(logger)
+
+	// Set up tracing; buffered spans are flushed on shutdown
+	shutdownTracing, err := tracing.Init(context.Background(), cfg.Log.TraceExporter)
+	if err != nil {
+		log.Fatal("Failed to set up tracing:", err)
+	}
+
+	// Set up storage
+	var client *mongo.Client
+	var stores store.Stores
+	if cfg.Database.Backend == "memory" {
+		stores = store.NewMemoryStores()
+		logger.Warn("Using in-memory storage (data will be lost on restart)")
+	} else {
+		client = connectMongo(cfg.Database.URI)
+		stores = store.NewMongoStores(client.Database(cfg.Database.Name))
+	}
+
+	// Assemble the app with outgoing mail, then build its routes
+	a := app.New(cfg, stores)
+	a.Mailer = newMailer(cfg.Mail)
+	a.Logger = logger
+	router := server.New(a)
+
+	httpServer := &http.Server{
+		Addr:              ":" + strconv.Itoa(cfg.Server.Port),
+		Handler:           router,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+		ErrorLog:          slog.NewLogLogger(logger.Handler(), slog.LevelError),
+	}
+
+	// Event streams never finish on their own, so end them when shutdown starts
+	httpServer.RegisterOnShutdown(a.Events.Close)
+
+	// Serve until the server fails or the process is asked to stop
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+
+	serverErr := make(chan error, 1)
+	go func() {
+		logger.Info("Server starting", "port", cfg.Server.Port)
+		serverErr <- httpServer.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serverErr:
+		log.Fatal("Failed to start server:", err)
+	case sig := <-stop:
+		logger.Info("Shutting down", "signal", sig.String(), "timeout", cfg.Server.ShutdownTimeout)
+	}
+
+	// A second signal skips the graceful shutdown
+	signal.Reset(os.Interrupt, syscall.SIGTERM)
+
+	shutdown(a, httpServer, client, shutdownTracing)
+}
+
+// shutdown stops the server in dependency order within SHUTDOWN_TIMEOUT:
+// in-flight requests drain first, then background tasks they started finish,
+// then MongoDB disconnects and any remaining spans are flushed
+func shutdown(a *app.App, httpServer *http.Server, client *mongo.Client, shutdownTracing func(context.Context) error) {
+	logger := a.Logger
+	ctx, cancel := context.WithTimeout(context.Background(), a.Config.Server.ShutdownTimeout)
+	defer cancel()
+
+	if err := httpServer.Shutdown(ctx); err != nil {
+		logger.Error("Timed out draining requests", "error", err)
+		httpServer.Close()
+	}
 
+	if err := a.Workers.Shutdown(ctx); err != nil {
+		logger.Error("Timed out waiting for background tasks", "error", err)
+	}
+
+	if client != nil {
+		if err := client.Disconnect(ctx); err != nil {
+			logger.Error("Failed to disconnect from MongoDB", "error", err)
+		}
+	}
+
+	if err := shutdownTracing(ctx); err != nil {
+		logger.Error("Failed to flush traces", "error", err)
+	}
+
+	logger.Info("Server stopped")
+}
+
+// connectMongo connects to MongoDB and verifies the connection
+func connectMongo(mongoURI string) *mongo.Client {
 	// Use the SetServerAPIOptions() method to set the version of the Stable API on the client
 	serverAPI := options.ServerAPI(options.ServerAPIVersion1)
 	opts := options.Client().ApplyURI(mongoURI).SetServerAPIOptions(serverAPI)
 
+	// Time and trace every command
+	opts.SetMonitor(tracing.CombineMonitors(metrics.MongoMonitor(), tracing.MongoMonitor()))
+
 	// Create a new client and connect to the server
 	client, err := mongo.Connect(opts)
 	if err != nil {
 		log.Fatal("Failed to connect to MongoDB:", err)
 	}
 
-	defer func() {
-		if err = client.Disconnect(context.TODO()); err != nil {
-			log.Fatal("Failed to disconnect from MongoDB:", err)
-		}
-	}()
-
 	// Send a ping to confirm a successful connection
 	if err := client.Ping(context.TODO(), readpref.Primary()); err != nil {
 		log.Fatal("Failed to ping MongoDB:", err)
 	}
-	fmt.Println("Successfully connected to MongoDB!")
+	slog.Info("Connected to MongoDB")
 
-	// Set MongoDB client in config
-	config.SetMongoClient(client)
-
-	// Initialize router
-	router := utils.NewRouter()
-
-	// Apply CORS middleware to all routes
-	router.Use(middleware.CORS)
-
-	// Health check endpoint
-	router.GET("/health", func(w http.ResponseWriter, r *http.Request) {
-		utils.JSONResponse(w, http.StatusOK, map[string]string{"status": "ok"})
-	})
-
-	// Public routes - API endpoints
-	router.POST("/signup", handlers.HandleSignup)
-	router.POST("/signin", handlers.HandleSignin)
-	router.POST("/lists/share/:id", handlers.HandleShareList)
-
-	// Protected routes (require JWT)
-	router.GET("/me", withAuth(handlers.HandleGetMe))
-	router.POST("/logout", withAuth(handlers.HandleLogout))
+	return client
+}
 
-	// List routes
-	router.POST("/lists", withAuth(handlers.HandleCreateList))
-	router.GET("/lists", withAuth(handlers.HandleGetLists))
-	router.GET("/lists/:id", withAuth(handlers.HandleGetList))
-	router.PUT("/lists/:id", withAuth(handlers.HandleUpdateList))
-	router.DELETE("/lists/:id", withAuth(handlers.HandleDeleteList))
-	router.POST("/lists/:id/items", withAuth(handlers.HandleAddListItem))
-	router.PUT("/lists/:id/items", withAuth(handlers.HandleUpdateListItem))
-	router.DELETE("/lists/:id/items", withAuth(handlers.HandleDeleteListItem))
-	router.PUT("/lists/:id/items/checked", withAuth(handlers.HandleUpdateListItemChecked))
+// newLogger creates the logger selected by LOG_FORMAT and LOG_LEVEL
+func newLogger(cfg config.LogConfig) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: cfg.Level}
+	if cfg.Format == "json" {
+		return slog.New(slog.NewJSONHandler(os.Stdout, opts))
+	}
+	return slog.New(slog.NewTextHandler(os.Stdout, opts))
+}
 
-	// Get port from environment or default to 8080
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+// newMailer creates the mailer selected by MAIL_BACKEND
+func newMailer(cfg config.MailConfig) mailer.Mailer {
+	if cfg.Backend == "smtp" {
+		slog.Info("Sending email through SMTP", "host", cfg.SMTPHost, "port", cfg.SMTPPort)
+		return mailer.NewSMTPMailer(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword, cfg.From)
 	}
 
-	fmt.Printf("Server starting on port %s\n", port)
-	if err := http.ListenAndServe(":"+port, router); err != nil {
-		log.Fatal("Failed to start server:", err)
+	if cfg.LogFile == "" {
+		slog.Info("Writing email to stdout instead of sending it")
+		return mailer.NewLogMailer(os.Stdout)
 	}
-}
 
-// withAuth wraps a handler with JWT authentication middleware
-func withAuth(handler http.HandlerFunc) http.HandlerFunc {
-	return middleware.JWTAuth(handler)
+	// The file stays open for the life of the process
+	file, err := os.OpenFile(cfg.LogFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		log.Fatal("Failed to open mail log file:", err)
+	}
+	slog.Info("Writing email to a file instead of sending it", "file", cfg.LogFile)
+	return mailer.NewLogMailer(file)
 }
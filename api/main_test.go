@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"bryce-stabenow/grocer-me/app"
+	"bryce-stabenow/grocer-me/config"
+	"bryce-stabenow/grocer-me/store"
+)
+
+// steps records the order things happen in
+type steps struct {
+	mu    sync.Mutex
+	steps []string
+}
+
+func (s *steps) add(step string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.steps = append(s.steps, step)
+}
+
+func (s *steps) get() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.steps...)
+}
+
+// serve starts an API server for a whose only handler runs handle
+func serve(t *testing.T, a *app.App, handle http.HandlerFunc) (*http.Server, string) {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	httpServer := &http.Server{Handler: handle}
+	go httpServer.Serve(listener)
+	return httpServer, "http://" + listener.Addr().String()
+}
+
+func newShutdownApp(timeout time.Duration) *app.App {
+	cfg := config.Default()
+	cfg.Server.ShutdownTimeout = timeout
+	a := app.New(cfg, store.NewMemoryStores())
+	a.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	return a
+}
+
+func TestShutdownOrder(t *testing.T) {
+	a := newShutdownApp(5 * time.Second)
+	var order steps
+	started := make(chan struct{})
+	finishRequest := make(chan struct{})
+	finishTask := make(chan struct{})
+
+	// The request starts a background task, as sending email does
+	httpServer, url := serve(t, a, func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-finishRequest
+		a.Workers.Go(func(ctx context.Context) {
+			<-finishTask
+			order.add("task")
+		})
+		order.add("request")
+	})
+	go func() {
+		if resp, err := http.Get(url); err == nil {
+			resp.Body.Close()
+		}
+	}()
+	<-started
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		shutdown(a, httpServer, nil, func(context.Context) error {
+			order.add("tracing")
+			return nil
+		})
+	}()
+
+	// Shutdown waits for the request, then its task, then flushes spans
+	time.Sleep(50 * time.Millisecond)
+	if got := order.get(); len(got) != 0 {
+		t.Fatalf("shutdown got to %v before the request finished", got)
+	}
+	close(finishRequest)
+	time.Sleep(50 * time.Millisecond)
+	if got := order.get(); len(got) != 1 {
+		t.Fatalf("shutdown got to %v before the task finished, want just the request", got)
+	}
+	close(finishTask)
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("shutdown didn't finish")
+	}
+	if got := order.get(); len(got) != 3 || got[0] != "request" || got[1] != "task" || got[2] != "tracing" {
+		t.Fatalf("shutdown ran %v, want request, task, tracing", got)
+	}
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	a := newShutdownApp(50 * time.Millisecond)
+	cancelled := make(chan struct{})
+	err := a.Workers.Go(func(ctx context.Context) {
+		<-ctx.Done()
+		close(cancelled)
+	})
+	if err != nil {
+		t.Fatalf("Go: %v", err)
+	}
+	httpServer, _ := serve(t, a, func(w http.ResponseWriter, r *http.Request) {})
+
+	// A task that never finishes is cancelled, and spans are still flushed
+	flushed := false
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		shutdown(a, httpServer, nil, func(context.Context) error {
+			flushed = true
+			return nil
+		})
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("shutdown didn't give up after its timeout")
+	}
+	<-cancelled
+	if !flushed {
+		t.Fatalf("spans not flushed after timing out")
+	}
+}
@@ -0,0 +1,118 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.mongodb.org/mongo-driver/v2/event"
+)
+
+// Registry holds every metric the API exports. A dedicated registry keeps
+// metrics registered by dependencies out of /metrics.
+var Registry = prometheus.NewRegistry()
+
+// HTTP metrics, labeled by route pattern rather than path so IDs don't
+// create a new series per list
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests handled, by method, route pattern and status code.",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Time taken to handle HTTP requests, by method, route pattern and status code.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	httpInFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "http_requests_in_flight",
+		Help: "HTTP requests currently being handled, including open event streams.",
+	})
+)
+
+// mongoDuration times every command sent to MongoDB
+var mongoDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "mongo_command_duration_seconds",
+	Help:    "Time taken by MongoDB commands, by command name and outcome.",
+	Buckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+}, []string{"command", "status"})
+
+// Domain counters
+var (
+	// UsersSignedUp counts accounts created
+	UsersSignedUp = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "grocerme_users_signed_up_total",
+		Help: "Accounts created.",
+	})
+	// ListsCreated counts lists created
+	ListsCreated = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "grocerme_lists_created_total",
+		Help: "Lists created.",
+	})
+	// ItemsAdded counts items added to lists
+	ItemsAdded = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "grocerme_items_added_total",
+		Help: "Items added to lists.",
+	})
+	// InvitesCreated counts share invites created
+	InvitesCreated = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "grocerme_invites_created_total",
+		Help: "Share invites created.",
+	})
+	// SharesJoined counts users joining a list through an invite
+	SharesJoined = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "grocerme_shares_joined_total",
+		Help: "Users who joined a shared list through an invite.",
+	})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests,
+		httpDuration,
+		httpInFlight,
+		mongoDuration,
+		UsersSignedUp,
+		ListsCreated,
+		ItemsAdded,
+		InvitesCreated,
+		SharesJoined,
+	)
+}
+
+// Handler serves the registry in the Prometheus text format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// RequestStarted marks a request as in flight, returning a func that records
+// it once handled
+func RequestStarted() func(method, route string, status int, duration time.Duration) {
+	httpInFlight.Inc()
+	return func(method, route string, status int, duration time.Duration) {
+		httpInFlight.Dec()
+		code := strconv.Itoa(status)
+		httpRequests.WithLabelValues(method, route, code).Inc()
+		httpDuration.WithLabelValues(method, route, code).Observe(duration.Seconds())
+	}
+}
+
+// MongoMonitor returns a driver command monitor that times every command
+func MongoMonitor() *event.CommandMonitor {
+	return &event.CommandMonitor{
+		Succeeded: func(_ context.Context, e *event.CommandSucceededEvent) {
+			mongoDuration.WithLabelValues(e.CommandName, "ok").Observe(e.Duration.Seconds())
+		},
+		Failed: func(_ context.Context, e *event.CommandFailedEvent) {
+			mongoDuration.WithLabelValues(e.CommandName, "error").Observe(e.Duration.Seconds())
+		},
+	}
+}
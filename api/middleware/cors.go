@@ -2,26 +2,121 @@ package middleware
 
 import (
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"bryce-stabenow/grocer-me/apierr"
+	"bryce-stabenow/grocer-me/app"
+	"bryce-stabenow/grocer-me/utils"
 )
 
-// CORS middleware handles Cross-Origin Resource Sharing
-func CORS(next http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		origin := r.Header.Get("Origin")
-		
-		// Set CORS headers
-		w.Header().Set("Access-Control-Allow-Origin", origin)
-		w.Header().Set("Access-Control-Allow-Credentials", "true")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS, PATCH")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Requested-With")
-		w.Header().Set("Access-Control-Max-Age", "3600")
-
-		// Handle preflight OPTIONS request
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusNoContent)
-			return
+// CORSPolicy lists who may make cross-origin requests and what they may send
+type CORSPolicy struct {
+	// AllowedOrigins are exact origins such as "https://grocer.me", or
+	// "https://*.grocer.me" to allow any subdomain (but not the domain itself)
+	AllowedOrigins []string
+	AllowedMethods []string
+	AllowedHeaders []string
+	ExposedHeaders []string
+	MaxAge         time.Duration
+}
+
+// CORS returns middleware that handles Cross-Origin Resource Sharing.
+// Requests from origins the policy allows get CORS headers, including
+// permission to send cookies; other origins get none, so browsers block them.
+// Preflight requests from allowed origins are answered here with 204 whether
+// or not the path exists, so a mistyped path shows up as a 404 on the actual
+// request rather than as a CORS failure. Other preflights fall through to the
+// router, which responds 204 for known routes and 404 for unknown ones. Other
+// requests only get CORS headers when they match a route; the router's own
+// 404 and 405 responses get none.
+func CORS(policy CORSPolicy) func(http.HandlerFunc) http.HandlerFunc {
+	allowedMethods := strings.Join(policy.AllowedMethods, ", ")
+	allowedHeaders := strings.Join(policy.AllowedHeaders, ", ")
+	exposedHeaders := strings.Join(policy.ExposedHeaders, ", ")
+	maxAge := strconv.Itoa(int(policy.MaxAge.Seconds()))
+
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+			if origin == "" || (!preflight && utils.GetRoutePattern(r) == "") {
+				next(w, r)
+				return
+			}
+
+			// The response depends on the origin, so caches must key on it
+			w.Header().Add("Vary", "Origin")
+			if !policy.allows(origin) {
+				next(w, r)
+				return
+			}
+
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+
+			if preflight {
+				// Preflight: say what the actual request may use
+				w.Header().Add("Vary", "Access-Control-Request-Method")
+				w.Header().Add("Vary", "Access-Control-Request-Headers")
+				w.Header().Set("Access-Control-Allow-Methods", allowedMethods)
+				w.Header().Set("Access-Control-Allow-Headers", allowedHeaders)
+				w.Header().Set("Access-Control-Max-Age", maxAge)
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+
+			if exposedHeaders != "" {
+				w.Header().Set("Access-Control-Expose-Headers", exposedHeaders)
+			}
+
+			next(w, r)
 		}
+	}
+}
 
-		next(w, r)
+// CheckOrigin verifies that a request sent from a browser comes from an origin
+// the CORS settings allow, sending a 403 if not. It guards cookie-authenticated
+// requests that can't carry a CSRF token. Requests without an Origin header,
+// such as those from servers and native clients, pass.
+func CheckOrigin(a *app.App, w http.ResponseWriter, r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	policy := CORSPolicy{AllowedOrigins: a.Config.CORS.AllowedOrigins}
+	if !policy.allows(origin) {
+		utils.ErrorResponse(w, apierr.OriginNotAllowed)
+		return false
+	}
+	return true
+}
+
+// allows reports whether the policy permits requests from origin
+func (policy CORSPolicy) allows(origin string) bool {
+	origin = strings.ToLower(origin)
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+
+	for _, allowed := range policy.AllowedOrigins {
+		allowed = strings.ToLower(allowed)
+		scheme, host, ok := strings.Cut(allowed, "://*.")
+		if !ok {
+			if origin == allowed {
+				return true
+			}
+			continue
+		}
+
+		// Wildcards match one or more subdomain labels with the same scheme and port
+		if u.Scheme == scheme && len(u.Host) > len(host)+1 && strings.HasSuffix(u.Host, "."+host) {
+			return true
+		}
 	}
+	return false
 }
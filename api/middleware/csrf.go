@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+
+	"bryce-stabenow/grocer-me/apierr"
+	"bryce-stabenow/grocer-me/app"
+	"bryce-stabenow/grocer-me/utils"
+)
+
+// CSRFHeader is the header clients echo their CSRF token in
+const CSRFHeader = "X-CSRF-Token"
+
+// CSRF returns middleware that rejects state-changing requests authenticated by the jwt_token cookie
+// unless they carry the session's CSRF token, since browsers attach cookies
+// to requests forged by other sites. Requests with a bearer token are exempt
+// because other sites can't make a browser send one. It must run inside
+// JWTAuth.
+func CSRF(a *app.App) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if !csrfSafe(r) {
+				sessionID, _ := utils.GetSessionID(r)
+				token := r.Header.Get(CSRFHeader)
+				if !hmac.Equal([]byte(token), []byte(CSRFToken(a, sessionID))) {
+					utils.ErrorResponse(w, apierr.CSRFTokenInvalid)
+					return
+				}
+			}
+			next(w, r)
+		}
+	}
+}
+
+// csrfSafe reports whether a request needs no CSRF token: it can't change
+// state, or its bearer token can't have been attached by the browser
+func csrfSafe(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return bearerToken(r) != ""
+}
+
+// CSRFToken derives a session's CSRF token. It is an HMAC of the session ID,
+// so it needs no storage, can't be forged without the secret, and stays valid
+// until the session ends.
+func CSRFToken(a *app.App, sessionID string) string {
+	mac := hmac.New(sha256.New, []byte(a.Config.Auth.JWTSecret))
+	mac.Write([]byte("csrf:" + sessionID))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -1,127 +1,169 @@
 package middleware
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"strings"
 
-	"bryce-stabenow/grocer-me/config"
+	"bryce-stabenow/grocer-me/apierr"
+	"bryce-stabenow/grocer-me/app"
+	"bryce-stabenow/grocer-me/store"
 	"bryce-stabenow/grocer-me/utils"
 
 	"github.com/golang-jwt/jwt/v5"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
-// JWTAuth validates JWT tokens and extracts user ID
-func JWTAuth(next http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		var tokenString string
-
-		// First, try to get token from Authorization header
-		authHeader := r.Header.Get("Authorization")
-		if authHeader != "" {
-			// Extract token from "Bearer <token>"
-			parts := strings.Split(authHeader, " ")
-			if len(parts) == 2 && parts[0] == "Bearer" {
-				tokenString = parts[1]
-			}
-		}
-
-		// If not in header, try to get from cookie
-		if tokenString == "" {
-			cookie, err := r.Cookie("jwt_token")
-			if err == nil && cookie != nil {
-				tokenString = cookie.Value
-			}
-		}
-
-		// If still no token, return unauthorized
-		if tokenString == "" {
-			utils.ErrorResponse(w, http.StatusUnauthorized, "Authorization required. Please sign in.")
-			return
-		}
+var (
+	// ErrNoToken is returned when a request carries no access token
+	ErrNoToken = errors.New("authorization required")
+	// ErrInvalidToken is returned when an access token is malformed or forged
+	ErrInvalidToken = errors.New("invalid token")
+	// ErrTokenExpired is returned when an access token has expired; clients should refresh it
+	ErrTokenExpired = errors.New("token has expired")
+	// ErrInvalidClaims is returned when an access token is missing required claims
+	ErrInvalidClaims = errors.New("invalid token claims")
+	// ErrSessionRevoked is returned when an access token's session has ended
+	ErrSessionRevoked = errors.New("session has been revoked")
+)
 
-		// Parse and validate token
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			// Validate signing method
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, jwt.ErrSignatureInvalid
+// JWTAuth returns middleware that validates JWT tokens and extracts the user ID
+func JWTAuth(a *app.App) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			userID, sessionID, err := Authenticate(a, r)
+			if err != nil {
+				utils.ErrorResponse(w, AuthError(err))
+				return
 			}
-			return []byte(config.JWTSecret), nil
-		})
-
-		if err != nil || !token.Valid {
-			utils.ErrorResponse(w, http.StatusUnauthorized, "Invalid or expired token")
-			return
-		}
 
-		// Extract claims
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok {
-			utils.ErrorResponse(w, http.StatusUnauthorized, "Invalid token claims")
-			return
+			// Store user and session IDs in context
+			r = utils.SetUserID(r, userID)
+			r = utils.SetSessionID(r, sessionID)
+			next(w, r)
 		}
-
-		// Extract user ID from claims
-		userID, ok := claims["user_id"].(string)
-		if !ok {
-			utils.ErrorResponse(w, http.StatusUnauthorized, "Invalid user ID in token")
-			return
-		}
-
-		// Store user ID in context
-		r = utils.SetUserID(r, userID)
-		next(w, r)
 	}
 }
 
-// ExtractUserID extracts user ID from JWT token (used for public endpoints that optionally require auth)
-func ExtractUserID(r *http.Request) (string, error) {
-	var tokenString string
-
-	// First, try to get token from Authorization header
-	authHeader := r.Header.Get("Authorization")
-	if authHeader != "" {
-		parts := strings.Split(authHeader, " ")
-		if len(parts) == 2 && parts[0] == "Bearer" {
-			tokenString = parts[1]
-		}
+// AuthError converts an error from Authenticate into the error sent to the client
+func AuthError(err error) *apierr.Error {
+	switch {
+	case errors.Is(err, ErrNoToken):
+		return apierr.AuthRequired
+	case errors.Is(err, ErrTokenExpired):
+		return apierr.TokenExpired
+	case errors.Is(err, ErrInvalidClaims):
+		return apierr.TokenInvalid.WithMessage("Invalid token claims")
+	case errors.Is(err, ErrInvalidToken):
+		return apierr.TokenInvalid
+	case errors.Is(err, ErrSessionRevoked):
+		return apierr.SessionEnded
+	default:
+		return apierr.Unexpected(err, "Failed to verify session")
 	}
+}
 
-	// If not in header, try to get from cookie
-	if tokenString == "" {
-		cookie, err := r.Cookie("jwt_token")
-		if err == nil && cookie != nil {
-			tokenString = cookie.Value
-		}
-	}
+// ExtractUserID extracts user ID from JWT token (used for public endpoints that optionally require auth)
+func ExtractUserID(a *app.App, r *http.Request) (string, error) {
+	userID, _, err := Authenticate(a, r)
+	return userID, err
+}
 
-	// If no token found, return error
+// Authenticate validates the request's access token and verifies that its
+// session is still active, returning the user and session IDs
+func Authenticate(a *app.App, r *http.Request) (userID, sessionID string, err error) {
+	tokenString := tokenFromRequest(r)
 	if tokenString == "" {
-		return "", jwt.ErrSignatureInvalid
+		return "", "", ErrNoToken
 	}
 
 	// Parse and validate token
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		// Validate signing method
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, jwt.ErrSignatureInvalid
 		}
-		return []byte(config.JWTSecret), nil
-	})
-
+		return []byte(a.Config.Auth.JWTSecret), nil
+	}, jwt.WithTimeFunc(a.Now))
+	if errors.Is(err, jwt.ErrTokenExpired) {
+		return "", "", ErrTokenExpired
+	}
 	if err != nil || !token.Valid {
-		return "", err
+		return "", "", ErrInvalidToken
 	}
 
 	// Extract claims
 	claims, ok := token.Claims.(jwt.MapClaims)
 	if !ok {
-		return "", jwt.ErrSignatureInvalid
+		return "", "", ErrInvalidClaims
 	}
 
-	// Extract user ID from claims
-	userID, ok := claims["user_id"].(string)
+	// Tokens issued before sessions existed have no session ID and are rejected
+	userID, ok = claims["user_id"].(string)
 	if !ok {
-		return "", jwt.ErrSignatureInvalid
+		return "", "", ErrInvalidClaims
+	}
+	sessionID, ok = claims["sid"].(string)
+	if !ok {
+		return "", "", ErrInvalidClaims
+	}
+
+	if err := CheckSession(r.Context(), a, sessionID, userID); err != nil {
+		return "", "", err
+	}
+
+	return userID, sessionID, nil
+}
+
+// tokenFromRequest reads the access token from the Authorization header or cookie
+func tokenFromRequest(r *http.Request) string {
+	// First, try to get token from Authorization header
+	if token := bearerToken(r); token != "" {
+		return token
+	}
+
+	// If not in header, try to get from cookie
+	cookie, err := r.Cookie("jwt_token")
+	if err == nil && cookie != nil {
+		return cookie.Value
+	}
+
+	return ""
+}
+
+// bearerToken reads the access token from a "Bearer <token>" Authorization header
+func bearerToken(r *http.Request) string {
+	parts := strings.Split(r.Header.Get("Authorization"), " ")
+	if len(parts) == 2 && parts[0] == "Bearer" {
+		return parts[1]
+	}
+	return ""
+}
+
+// CheckSession verifies that a session exists, belongs to the user and has not
+// been revoked, so logging out invalidates outstanding access tokens. It
+// returns ErrSessionRevoked if the session has ended.
+func CheckSession(ctx context.Context, a *app.App, sessionID, userID string) error {
+	id, err := primitive.ObjectIDFromHex(sessionID)
+	if err != nil {
+		return ErrInvalidClaims
+	}
+
+	ctx, cancel := a.StoreContext(ctx)
+	defer cancel()
+
+	session, err := a.Stores.Sessions.Get(ctx, id)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return ErrSessionRevoked
+		}
+		return err
+	}
+
+	if session.UserID.Hex() != userID || !session.IsActive(a.Now()) {
+		return ErrSessionRevoked
 	}
 
-	return userID, nil
+	return nil
 }
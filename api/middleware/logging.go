@@ -0,0 +1,150 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"bryce-stabenow/grocer-me/tracing"
+	"bryce-stabenow/grocer-me/utils"
+)
+
+// maxRequestIDLength bounds request IDs accepted from clients
+const maxRequestIDLength = 128
+
+// RequestLogger returns middleware that assigns each request an ID, makes a
+// logger tagged with it available through utils.GetLogger and logs the
+// request once it completes. It should be the outermost middleware.
+func RequestLogger(logger *slog.Logger) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+
+			// Reuse the caller's request ID so logs can be correlated across services
+			requestID := r.Header.Get(utils.RequestIDHeader)
+			if !isValidRequestID(requestID) {
+				requestID = newRequestID()
+			}
+			w.Header().Set(utils.RequestIDHeader, requestID)
+
+			// Tag logs with the trace so they can be found from a span and vice versa
+			requestLogger := logger.With("request_id", requestID)
+			traceID := tracing.TraceID(r.Context())
+			if traceID != "" {
+				requestLogger = requestLogger.With("trace_id", traceID)
+			}
+
+			// Inner middleware records what it learns (e.g. the user) in info
+			info := &utils.RequestInfo{}
+			r = utils.SetRequestID(r, requestID)
+			r = utils.SetRequestInfo(r, info)
+			r = utils.SetLogger(r, requestLogger)
+
+			recorder := newResponseRecorder(w)
+			next(recorder, r)
+
+			level := slog.LevelInfo
+			if recorder.status >= http.StatusInternalServerError {
+				level = slog.LevelError
+			}
+
+			attrs := []slog.Attr{
+				slog.String("method", r.Method),
+				slog.String("route", utils.GetRoutePattern(r)),
+				slog.String("path", r.URL.Path),
+				slog.Int("status", recorder.status),
+				slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+				slog.String("user_id", info.UserID),
+				slog.Int64("bytes", recorder.bytes),
+			}
+			// Server errors carry the failure the client wasn't shown
+			if recorder.err != nil {
+				attrs = append(attrs, slog.Any("error", recorder.err))
+			}
+			requestLogger.LogAttrs(r.Context(), level, "Request completed", attrs...)
+		}
+	}
+}
+
+// isValidRequestID accepts client request IDs made of safe, printable characters
+func isValidRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+var (
+	// randRead fills request IDs with random bytes; tests replace it
+	randRead = rand.Read
+	// fallbackRequestIDs numbers request IDs made when randRead fails
+	fallbackRequestIDs atomic.Uint64
+)
+
+// newRequestID generates a random 128-bit request ID, or if the system's
+// randomness fails, one from the time and a counter so IDs stay distinct
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := randRead(b); err != nil {
+		return fmt.Sprintf("%x-%x", time.Now().UnixNano(), fallbackRequestIDs.Add(1))
+	}
+	return hex.EncodeToString(b)
+}
+
+// responseRecorder captures the status code, size and, for server errors,
+// cause of a response
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int64
+	wroteHeader bool
+	err         error
+}
+
+func newResponseRecorder(w http.ResponseWriter) *responseRecorder {
+	return &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	if !rec.wroteHeader {
+		rec.status = status
+		rec.wroteHeader = true
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	rec.wroteHeader = true
+	n, err := rec.ResponseWriter.Write(b)
+	rec.bytes += int64(n)
+	return n, err
+}
+
+// RecordError keeps the cause of a server error response for the request log
+func (rec *responseRecorder) RecordError(err error) {
+	rec.err = err
+}
+
+// Flush keeps streaming responses such as server-sent events working
+func (rec *responseRecorder) Flush() {
+	if flusher, ok := rec.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (rec *responseRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
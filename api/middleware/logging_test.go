@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"bryce-stabenow/grocer-me/apierr"
+	"bryce-stabenow/grocer-me/utils"
+)
+
+func TestRequestLoggerRecordsErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    *apierr.Error
+		status int
+		level  string
+		cause  string
+	}{
+		{name: "unexpected failure", err: apierr.Unexpected(errors.New("connection reset"), "Failed to find list"),
+			status: 500, level: "ERROR", cause: "connection reset"},
+		{name: "store timeout", err: apierr.Unexpected(context.DeadlineExceeded, "Failed to find list"),
+			status: 504, level: "ERROR", cause: "context deadline exceeded"},
+		{name: "cancelled request", err: apierr.Unexpected(context.Canceled, "Failed to find list"), status: 499, level: "INFO"},
+		{name: "client error", err: apierr.ListNotFound, status: 404, level: "INFO"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			logger := slog.New(slog.NewJSONHandler(&logs, nil))
+
+			// Recover and Metrics wrap the writer too, as they do in the server
+			handler := RequestLogger(logger)(Metrics(Recover()(func(w http.ResponseWriter, r *http.Request) {
+				utils.ErrorResponse(w, tt.err)
+			})))
+			rec := httptest.NewRecorder()
+			handler(rec, httptest.NewRequest(http.MethodGet, "/lists/abc", nil))
+
+			if rec.Code != tt.status {
+				t.Fatalf("status %d, want %d", rec.Code, tt.status)
+			}
+			if tt.cause != "" && strings.Contains(rec.Body.String(), tt.cause) {
+				t.Fatalf("response leaked the cause: %s", rec.Body)
+			}
+
+			var entry struct {
+				Level     string `json:"level"`
+				RequestID string `json:"request_id"`
+				Error     string `json:"error"`
+			}
+			if err := json.Unmarshal(logs.Bytes(), &entry); err != nil {
+				t.Fatalf("Failed to decode log %s: %v", logs.Bytes(), err)
+			}
+			if entry.Level != tt.level || entry.Error != tt.cause || entry.RequestID != rec.Header().Get(utils.RequestIDHeader) {
+				t.Fatalf("logged level %s, error %q, request ID %s; want %s, %q and the response's %s",
+					entry.Level, entry.Error, entry.RequestID, tt.level, tt.cause, rec.Header().Get(utils.RequestIDHeader))
+			}
+		})
+	}
+}
+
+func TestNewRequestIDFallback(t *testing.T) {
+	if id := newRequestID(); len(id) != 32 || !isValidRequestID(id) {
+		t.Fatalf("newRequestID() = %q, want 32 hex digits", id)
+	}
+
+	randRead = func([]byte) (int, error) { return 0, errors.New("no entropy") }
+	t.Cleanup(func() { randRead = rand.Read })
+
+	first, second := newRequestID(), newRequestID()
+	if first == second || strings.Trim(first, "0-") == "" {
+		t.Fatalf("fallback request IDs %q and %q, want distinct non-zero IDs", first, second)
+	}
+	if !isValidRequestID(first) {
+		t.Fatalf("fallback request ID %q is not a valid request ID", first)
+	}
+}
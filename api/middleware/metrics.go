@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"bryce-stabenow/grocer-me/metrics"
+	"bryce-stabenow/grocer-me/utils"
+)
+
+// unmatchedRoute labels requests that matched no route, so probes for
+// arbitrary paths can't create unbounded metric series
+const unmatchedRoute = "unmatched"
+
+// Metrics records each request's count and latency by route pattern and
+// status. It should run inside RequestLogger and outside Recover so panics
+// are counted as the 500s they become.
+func Metrics(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		done := metrics.RequestStarted()
+
+		recorder := newResponseRecorder(w)
+		next(recorder, r)
+
+		// The router only knows the pattern once it has matched the request
+		route := utils.GetRoutePattern(r)
+		if route == "" {
+			route = unmatchedRoute
+		}
+		done(methodLabel(r.Method), route, recorder.status, time.Since(start))
+	}
+}
+
+// methodLabel maps a request method to one of a fixed set of labels, so
+// requests with made-up methods can't create unbounded metric series either
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+		http.MethodPatch, http.MethodDelete, http.MethodOptions:
+		return method
+	default:
+		return "other"
+	}
+}
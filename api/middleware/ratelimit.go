@@ -0,0 +1,125 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"bryce-stabenow/grocer-me/apierr"
+	"bryce-stabenow/grocer-me/app"
+	"bryce-stabenow/grocer-me/store"
+	"bryce-stabenow/grocer-me/utils"
+)
+
+// maxPeekBytes bounds how much of a request body RequestEmail reads
+const maxPeekBytes = 64 << 10
+
+// RateLimitKey picks what a request is rate limited by, such as its client
+// IP. An empty key exempts the request from the limit.
+type RateLimitKey func(r *http.Request) string
+
+// RateLimit returns middleware that allows each key limit.Requests requests
+// per limit.Per, in bursts of up to limit.Requests, and responds 429 with
+// Retry-After once a key has used them up. name keeps the buckets of
+// different limits apart, e.g. "signin:ip".
+//
+// Every response carries RateLimit-Limit, RateLimit-Remaining and
+// RateLimit-Reset headers describing the most restrictive limit applied.
+// If the rate limit store fails, requests are let through rather than
+// locking everyone out.
+func RateLimit(a *app.App, name string, limit store.RateLimit, key RateLimitKey) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			k := key(r)
+			if k == "" {
+				next(w, r)
+				return
+			}
+
+			ctx, cancel := a.OperationContext(r)
+			allowed, remaining, err := a.Stores.RateLimits.Take(ctx, name+":"+k, limit, a.Now())
+			cancel()
+			if err != nil {
+				utils.GetLogger(r).Error("Failed to check rate limit", "limit", name, "error", err)
+				next(w, r)
+				return
+			}
+
+			setRateLimitHeaders(w, limit, remaining)
+			if !allowed {
+				utils.SetRetryAfter(w, limit.Wait(1-remaining))
+				utils.ErrorResponse(w, apierr.RateLimited)
+				return
+			}
+			next(w, r)
+		}
+	}
+}
+
+// setRateLimitHeaders describes a limit in the RateLimit-* headers, unless an
+// outer limit already set them with fewer requests remaining
+func setRateLimitHeaders(w http.ResponseWriter, limit store.RateLimit, remaining float64) {
+	left := int(remaining)
+	if current, err := strconv.Atoi(w.Header().Get("RateLimit-Remaining")); err == nil && current <= left {
+		return
+	}
+
+	w.Header().Set("RateLimit-Limit", strconv.Itoa(limit.Requests))
+	w.Header().Set("RateLimit-Remaining", strconv.Itoa(left))
+	w.Header().Set("RateLimit-Reset", utils.Seconds(limit.Wait(float64(limit.Requests)-remaining)))
+	w.Header().Set("RateLimit-Policy", strconv.Itoa(limit.Requests)+";w="+utils.Seconds(limit.Per))
+}
+
+// ClientIP keys requests by the client's IP address: the last address in
+// header if it is set, since that is the one the trusted proxy saw, or the
+// connection's remote address otherwise
+func ClientIP(header string) RateLimitKey {
+	return func(r *http.Request) string {
+		if header != "" {
+			forwarded := r.Header.Values(header)
+			if len(forwarded) > 0 {
+				last := forwarded[len(forwarded)-1]
+				return strings.TrimSpace(last[strings.LastIndex(last, ",")+1:])
+			}
+		}
+
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			return r.RemoteAddr
+		}
+		return host
+	}
+}
+
+// AuthenticatedUser keys requests by the signed-in user's ID, so an account
+// can't use its own session to send unlimited email. It must run after JWTAuth.
+func AuthenticatedUser(r *http.Request) string {
+	userID, _ := utils.GetUserID(r)
+	return userID
+}
+
+// RequestEmail keys requests by the "email" field of their JSON body, so an
+// account can't be targeted from many addresses. The body is left intact for
+// the handler.
+func RequestEmail(r *http.Request) string {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxPeekBytes))
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+	if err != nil {
+		return ""
+	}
+
+	var fields struct {
+		Email string `json:"email"`
+	}
+	if json.Unmarshal(body, &fields) != nil {
+		return ""
+	}
+	return strings.ToLower(strings.TrimSpace(fields.Email))
+}
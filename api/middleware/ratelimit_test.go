@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name      string
+		header    string
+		forwarded []string
+		remote    string
+		want      string
+	}{
+		{name: "remote address", remote: "203.0.113.7:5000", want: "203.0.113.7"},
+		{name: "IPv6 remote address", remote: "[2001:db8::1]:5000", want: "2001:db8::1"},
+		{name: "remote address without port", remote: "203.0.113.7", want: "203.0.113.7"},
+		{name: "header ignored unless configured", forwarded: []string{"198.51.100.1"}, remote: "203.0.113.7:5000", want: "203.0.113.7"},
+		{name: "single forwarded address", header: "X-Forwarded-For", forwarded: []string{"198.51.100.1"},
+			remote: "10.0.0.1:5000", want: "198.51.100.1"},
+		{name: "last hop of a list", header: "X-Forwarded-For", forwarded: []string{"192.0.2.66, 198.51.100.1"},
+			remote: "10.0.0.1:5000", want: "198.51.100.1"},
+		{name: "last of repeated headers", header: "X-Forwarded-For", forwarded: []string{"192.0.2.66", "198.51.100.1, 198.51.100.2"},
+			remote: "10.0.0.1:5000", want: "198.51.100.2"},
+		{name: "configured header missing", header: "X-Forwarded-For", remote: "10.0.0.1:5000", want: "10.0.0.1"},
+		{name: "other header", header: "X-Real-IP", forwarded: []string{"198.51.100.1"}, remote: "10.0.0.1:5000", want: "10.0.0.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/signin", nil)
+			req.RemoteAddr = tt.remote
+			for _, value := range tt.forwarded {
+				req.Header.Add("X-Forwarded-For", value)
+			}
+			if got := ClientIP(tt.header)(req); got != tt.want {
+				t.Fatalf("ClientIP(%q) = %q, want %q", tt.header, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequestEmail(t *testing.T) {
+	long := `{"password":"` + strings.Repeat("x", maxPeekBytes) + `","email":"a@example.com"}`
+
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{name: "email field", body: `{"email":"alice@example.com","password":"secret"}`, want: "alice@example.com"},
+		{name: "normalized", body: `{"email":"  Alice@Example.COM "}`, want: "alice@example.com"},
+		{name: "no email", body: `{"password":"secret"}`, want: ""},
+		{name: "not JSON", body: `email=alice@example.com`, want: ""},
+		{name: "empty body", body: ``, want: ""},
+		{name: "too long to peek", body: long, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/signin", strings.NewReader(tt.body))
+			if got := RequestEmail(req); got != tt.want {
+				t.Fatalf("RequestEmail() = %q, want %q", got, tt.want)
+			}
+
+			// The handler still reads the whole body
+			body, err := io.ReadAll(req.Body)
+			if err != nil {
+				t.Fatalf("Reading the restored body: %v", err)
+			}
+			if string(body) != tt.body {
+				t.Fatalf("restored body has %d bytes, want the original %d", len(body), len(tt.body))
+			}
+			if err := req.Body.Close(); err != nil {
+				t.Fatalf("Closing the restored body: %v", err)
+			}
+		})
+	}
+}
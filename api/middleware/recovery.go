@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+
+	"bryce-stabenow/grocer-me/apierr"
+	"bryce-stabenow/grocer-me/app"
+	"bryce-stabenow/grocer-me/utils"
+)
+
+// ErrPanic wraps the errors Recover reports, so reporters can recognize panics
+var ErrPanic = errors.New("panic")
+
+// ErrorReporter forwards unexpected failures, such as recovered panics, to an
+// error tracking backend. Reporters set in app.App.ErrorReporters are passed
+// to Recover by the server.
+type ErrorReporter = app.ErrorReporter
+
+// Recover returns middleware that turns a panic in a handler into a 500
+// response, logs it with its stack trace and passes it to each reporter. It
+// should run inside RequestLogger so the log carries the request ID.
+func Recover(reporters ...ErrorReporter) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			recorder := newResponseRecorder(w)
+
+			defer func() {
+				recovered := recover()
+				if recovered == nil {
+					return
+				}
+
+				// net/http uses this panic to abort a response deliberately
+				if recovered == http.ErrAbortHandler {
+					panic(recovered)
+				}
+
+				var err error
+				if cause, ok := recovered.(error); ok {
+					err = fmt.Errorf("%w: %w", ErrPanic, cause)
+				} else {
+					err = fmt.Errorf("%w: %v", ErrPanic, recovered)
+				}
+				stack := debug.Stack()
+
+				utils.GetLogger(r).Error("Recovered from panic", "error", err, "stack", string(stack))
+				for _, reporter := range reporters {
+					reporter.Report(r, err, stack)
+				}
+
+				// Once the response has started the client can only see a truncated body
+				if !recorder.wroteHeader {
+					utils.ErrorResponse(recorder, apierr.Internal)
+				}
+			}()
+
+			next(recorder, r)
+		}
+	}
+}
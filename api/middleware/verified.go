@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+
+	"bryce-stabenow/grocer-me/apierr"
+	"bryce-stabenow/grocer-me/app"
+	"bryce-stabenow/grocer-me/store"
+	"bryce-stabenow/grocer-me/utils"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// RequireVerifiedEmail returns middleware that blocks users who haven't
+// verified their email from a feature listed in UNVERIFIED_RESTRICTIONS. It
+// must run inside JWTAuth.
+func RequireVerifiedEmail(a *app.App, feature string) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if !a.Config.Features.Restricted(feature) {
+				next(w, r)
+				return
+			}
+
+			userID, _ := utils.GetUserID(r)
+			id, err := primitive.ObjectIDFromHex(userID)
+			if err != nil {
+				utils.ErrorResponse(w, apierr.InvalidID.WithMessage("Invalid user ID format"))
+				return
+			}
+
+			ctx, cancel := a.OperationContext(r)
+			defer cancel()
+
+			user, err := a.Stores.Users.GetByID(ctx, id)
+			if err != nil {
+				if errors.Is(err, store.ErrNotFound) {
+					utils.ErrorResponse(w, apierr.SessionEnded)
+					return
+				}
+				utils.ErrorResponse(w, apierr.Unexpected(err, "Failed to find user"))
+				return
+			}
+
+			if !user.EmailVerified {
+				utils.ErrorResponse(w, apierr.EmailNotVerified)
+				return
+			}
+
+			next(w, r)
+		}
+	}
+}
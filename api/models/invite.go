@@ -0,0 +1,48 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Invite represents a token that lets a user join a list
+type Invite struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	ListID    primitive.ObjectID `json:"list_id" bson:"list_id"`
+	TokenHash string             `json:"-" bson:"token_hash"`
+	CreatedBy primitive.ObjectID `json:"created_by" bson:"created_by"`
+	Role      Role               `json:"role" bson:"role"`
+	MaxUses   int                `json:"max_uses" bson:"max_uses"` // 0 means unlimited
+	Uses      int                `json:"uses" bson:"uses"`
+	ExpiresAt time.Time          `json:"expires_at" bson:"expires_at"`
+	RevokedAt *time.Time         `json:"revoked_at,omitempty" bson:"revoked_at,omitempty"`
+	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
+}
+
+// IsUsable reports whether the invite can still be redeemed at the given time
+func (i *Invite) IsUsable(now time.Time) bool {
+	if i.RevokedAt != nil || !now.Before(i.ExpiresAt) {
+		return false
+	}
+	return i.MaxUses == 0 || i.Uses < i.MaxUses
+}
+
+// CreateInviteRequest represents the request body for creating an invite
+type CreateInviteRequest struct {
+	Role           Role `json:"role,omitempty" binding:"omitempty,oneof=editor viewer"`
+	MaxUses        *int `json:"max_uses,omitempty" binding:"omitempty,min=0"`
+	ExpiresInHours int  `json:"expires_in_hours,omitempty" binding:"omitempty,min=1,max=720"` // At most 30 days
+}
+
+// InviteResponse represents an invite returned to the list owner
+type InviteResponse struct {
+	ID        string    `json:"id"`
+	ListID    string    `json:"list_id"`
+	Token     string    `json:"token,omitempty"` // Only returned when the invite is created
+	Role      Role      `json:"role"`
+	MaxUses   int       `json:"max_uses"`
+	Uses      int       `json:"uses"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -8,18 +8,48 @@ import (
 
 // List represents a list document in MongoDB
 type List struct {
-	ID          primitive.ObjectID   `json:"id" bson:"_id,omitempty"`
-	UserID      primitive.ObjectID   `json:"user_id" bson:"user_id"`
-	Name        string               `json:"name" bson:"name"`
-	Description string               `json:"description,omitempty" bson:"description,omitempty"`
-	Items       []ListItem           `json:"items" bson:"items"`
-	SharedWith  []primitive.ObjectID `json:"shared_with" bson:"shared_with"`
-	CreatedAt   time.Time            `json:"created_at" bson:"created_at"`
-	UpdatedAt   time.Time            `json:"updated_at" bson:"updated_at"`
+	ID          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	UserID      primitive.ObjectID `json:"user_id" bson:"user_id"`
+	Name        string             `json:"name" bson:"name"`
+	Description string             `json:"description,omitempty" bson:"description,omitempty"`
+	Items       []ListItem         `json:"items" bson:"items"`
+	SharedWith  []Collaborator     `json:"shared_with" bson:"shared_with"`
+	Version     int64              `json:"version" bson:"version"`
+	CreatedAt   time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt   time.Time          `json:"updated_at" bson:"updated_at"`
+}
+
+// Collaborator is a user a list is shared with and their role on it
+type Collaborator struct {
+	UserID primitive.ObjectID `json:"user_id" bson:"user_id"`
+	Role   Role               `json:"role" bson:"role"`
+}
+
+// RoleOf returns the user's role on the list, or false if they have no access
+func (l *List) RoleOf(userID primitive.ObjectID) (Role, bool) {
+	if l.UserID == userID {
+		return RoleOwner, true
+	}
+	for _, collaborator := range l.SharedWith {
+		if collaborator.UserID == userID {
+			return collaborator.Role, true
+		}
+	}
+	return "", false
+}
+
+// CollaboratorIDs returns the user IDs of everyone the list is shared with
+func (l *List) CollaboratorIDs() []primitive.ObjectID {
+	ids := make([]primitive.ObjectID, len(l.SharedWith))
+	for i, collaborator := range l.SharedWith {
+		ids[i] = collaborator.UserID
+	}
+	return ids
 }
 
 // ListItem represents an item in a list
 type ListItem struct {
+	ID       primitive.ObjectID `json:"id" bson:"_id"`
 	Name     string             `json:"name" bson:"name"`
 	Quantity int                `json:"quantity" bson:"quantity"`
 	Checked  bool               `json:"checked" bson:"checked"`
@@ -49,27 +79,31 @@ type AddListItemRequest struct {
 
 // UpdateListItemCheckedRequest represents the request body for updating an item's checked state
 type UpdateListItemCheckedRequest struct {
-	Index   *int `json:"index" binding:"required"`
 	Checked bool `json:"checked"`
 }
 
 // UpdateListItemRequest represents the request body for updating an item's name, details, and quantity
 type UpdateListItemRequest struct {
-	Index    *int    `json:"index" binding:"required"`
 	Name     string  `json:"name,omitempty"`
 	Quantity *int    `json:"quantity,omitempty"`
-	Details  *string `json:"details,omitempty"`
-}
-
-// DeleteListItemRequest represents the request body for deleting an item from a list
-type DeleteListItemRequest struct {
-	Index *int `json:"index" binding:"required"`
+	Details  *string `json:"details,omitempty" binding:"omitempty,max=512"`
 }
 
 // SharedUser represents a user that a list is shared with
 type SharedUser struct {
 	ID    string `json:"id"`
 	Email string `json:"email"`
+	Role  Role   `json:"role"`
+}
+
+// UpdateCollaboratorRequest represents the request body for changing a collaborator's role
+type UpdateCollaboratorRequest struct {
+	Role Role `json:"role" binding:"required,oneof=editor viewer"` // Ownership can't be granted through a role change
+}
+
+// TransferOwnershipRequest represents the request body for transferring a list
+type TransferOwnershipRequest struct {
+	UserID string `json:"user_id" binding:"required"`
 }
 
 // ListResponse represents the response for list operations
@@ -80,7 +114,18 @@ type ListResponse struct {
 	Description string       `json:"description,omitempty"`
 	Items       []ListItem   `json:"items"`
 	SharedWith  []SharedUser `json:"shared_with"`
+	Version     int64        `json:"version"`
 	CreatedAt   time.Time    `json:"created_at"`
 	UpdatedAt   time.Time    `json:"updated_at"`
 }
 
+// ListEvent is the data sent to subscribers of a list's real-time event stream
+type ListEvent struct {
+	ListID      string    `json:"list_id"`
+	Version     int64     `json:"version"`
+	Item        *ListItem `json:"item,omitempty"`
+	ItemID      string    `json:"item_id,omitempty"`
+	Name        string    `json:"name,omitempty"`
+	Description string    `json:"description,omitempty"`
+	UserID      string    `json:"user_id,omitempty"` // Member affected by a members-changed event
+}
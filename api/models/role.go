@@ -0,0 +1,63 @@
+package models
+
+// Role is a user's permission level on a list
+type Role string
+
+const (
+	// RoleOwner can do everything, including managing sharing and deleting the list
+	RoleOwner Role = "owner"
+	// RoleEditor can rename the list and add, edit, check and delete items
+	RoleEditor Role = "editor"
+	// RoleViewer can read the list and check items off
+	RoleViewer Role = "viewer"
+)
+
+// Permission is an action that may be performed on a list
+type Permission int
+
+const (
+	PermissionView Permission = iota
+	PermissionCheckItems
+	PermissionEditItems
+	PermissionEditList
+	PermissionManageSharing
+	PermissionDeleteList
+)
+
+// minimumRole is the least privileged role granted each permission
+var minimumRole = map[Permission]Role{
+	PermissionView:          RoleViewer,
+	PermissionCheckItems:    RoleViewer,
+	PermissionEditItems:     RoleEditor,
+	PermissionEditList:      RoleEditor,
+	PermissionManageSharing: RoleOwner,
+	PermissionDeleteList:    RoleOwner,
+}
+
+// rank orders roles from least to most privileged
+func (r Role) rank() int {
+	switch r {
+	case RoleViewer:
+		return 1
+	case RoleEditor:
+		return 2
+	case RoleOwner:
+		return 3
+	default:
+		return 0
+	}
+}
+
+// Can reports whether the role grants the given permission
+func (r Role) Can(p Permission) bool {
+	required, ok := minimumRole[p]
+	if !ok {
+		return false
+	}
+	return r.rank() >= required.rank()
+}
+
+// IsCollaboratorRole reports whether the role can be given to a collaborator
+func (r Role) IsCollaboratorRole() bool {
+	return r == RoleEditor || r == RoleViewer
+}
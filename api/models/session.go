@@ -0,0 +1,55 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Session is a signed-in device. Access tokens carry the session ID so they
+// stop working once the session is revoked, and the refresh token is rotated
+// every time it is used.
+type Session struct {
+	ID                  primitive.ObjectID `json:"id" bson:"_id"`
+	UserID              primitive.ObjectID `json:"user_id" bson:"user_id"`
+	RefreshTokenHash    string             `json:"-" bson:"refresh_token_hash"`
+	PreviousTokenHashes []string           `json:"-" bson:"previous_token_hashes,omitempty"` // Every rotated token, oldest first, to detect reuse
+	UserAgent           string             `json:"user_agent" bson:"user_agent"`
+	CreatedAt           time.Time          `json:"created_at" bson:"created_at"`
+	LastUsedAt          time.Time          `json:"last_used_at" bson:"last_used_at"`
+	ExpiresAt           time.Time          `json:"expires_at" bson:"expires_at"`
+	RevokedAt           *time.Time         `json:"revoked_at,omitempty" bson:"revoked_at,omitempty"`
+}
+
+// LastRotatedTokenHash returns the hash of the refresh token replaced by the
+// most recent rotation, or "" if the session has never been refreshed
+func (s *Session) LastRotatedTokenHash() string {
+	if len(s.PreviousTokenHashes) == 0 {
+		return ""
+	}
+	return s.PreviousTokenHashes[len(s.PreviousTokenHashes)-1]
+}
+
+// IsActive reports whether the session can still be used at the given time
+func (s *Session) IsActive(now time.Time) bool {
+	return s.RevokedAt == nil && now.Before(s.ExpiresAt)
+}
+
+// RefreshTokenRequest represents the request body for refreshing an access token
+// (browsers send the refresh token as a cookie instead)
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// TokenResponse represents the response for a token refresh
+type TokenResponse struct {
+	Token        string    `json:"token"`
+	RefreshToken string    `json:"refresh_token"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+// CSRFTokenResponse carries the token cookie-authenticated clients send in
+// the X-CSRF-Token header of state-changing requests
+type CSRFTokenResponse struct {
+	CSRFToken string `json:"csrf_token"`
+}
@@ -8,13 +8,15 @@ import (
 
 // User represents a user document in MongoDB
 type User struct {
-	ID           primitive.ObjectID `json:"id" bson:"_id,omitempty"`
-	Email        string             `json:"email" bson:"email"`
-	PasswordHash string             `json:"-" bson:"password_hash"`
-	Username     string             `json:"username,omitempty" bson:"username,omitempty"`
-	Profile      *Profile           `json:"profile,omitempty" bson:"profile,omitempty"`
-	CreatedAt    time.Time          `json:"created_at" bson:"created_at"`
-	UpdatedAt    time.Time          `json:"updated_at" bson:"updated_at"`
+	ID              primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Email           string             `json:"email" bson:"email"`
+	PasswordHash    string             `json:"-" bson:"password_hash"`
+	Username        string             `json:"username,omitempty" bson:"username,omitempty"`
+	Profile         *Profile           `json:"profile,omitempty" bson:"profile,omitempty"`
+	EmailVerified   bool               `json:"email_verified" bson:"email_verified"` // False until the emailed link is followed
+	EmailVerifiedAt *time.Time         `json:"email_verified_at,omitempty" bson:"email_verified_at,omitempty"`
+	CreatedAt       time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt       time.Time          `json:"updated_at" bson:"updated_at"`
 }
 
 // Profile represents user profile information
@@ -35,22 +37,24 @@ type SignupRequest struct {
 
 // SigninRequest represents the request body for signin
 type SigninRequest struct {
-	Email    string `json:"email" binding:"required,email"`
+	Email    string `json:"email" binding:"required"` // Not format-checked, so accounts from before signup checked addresses can sign in
 	Password string `json:"password" binding:"required"`
 }
 
 // AuthResponse represents the response for signup/signin
 type AuthResponse struct {
-	Token string      `json:"token"`
-	User  *UserPublic `json:"user"`
+	Token        string      `json:"token"`
+	RefreshToken string      `json:"refresh_token"`
+	ExpiresAt    time.Time   `json:"expires_at"`
+	User         *UserPublic `json:"user"`
 }
 
 // UserPublic represents public user information (without password)
 type UserPublic struct {
-	ID        string    `json:"id"`
-	Email     string    `json:"email"`
-	Username  string    `json:"username,omitempty"`
-	Profile   *Profile  `json:"profile,omitempty"`
-	CreatedAt time.Time `json:"created_at"`
+	ID            string    `json:"id"`
+	Email         string    `json:"email"`
+	Username      string    `json:"username,omitempty"`
+	Profile       *Profile  `json:"profile,omitempty"`
+	EmailVerified bool      `json:"email_verified"`
+	CreatedAt     time.Time `json:"created_at"`
 }
-
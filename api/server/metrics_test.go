@@ -0,0 +1,80 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// scrapeMetrics reads /metrics into a map from each sample's name and labels,
+// as written in the text format, to its value
+func (api *testAPI) scrapeMetrics() map[string]float64 {
+	api.t.Helper()
+
+	resp := api.request(http.MethodGet, "/metrics", "", nil).expect(api.t, http.StatusOK)
+	samples := make(map[string]float64)
+	scanner := bufio.NewScanner(bytes.NewReader(resp.body))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		i := strings.LastIndex(line, " ")
+		value, err := strconv.ParseFloat(line[i+1:], 64)
+		if err != nil {
+			api.t.Fatalf("Failed to parse metrics line %q: %v", line, err)
+		}
+		samples[line[:i]] = value
+	}
+	return samples
+}
+
+func TestMetrics(t *testing.T) {
+	api := newTestAPI(t)
+	token, _ := api.signUp("alice@example.com")
+	before := api.scrapeMetrics()
+
+	api.signUp("bob@example.com")
+	list := api.createList(token, "Groceries")
+	api.addItem(token, list.ID, "Milk")
+	api.request(http.MethodGet, "/lists/"+list.ID, token, nil).expect(t, http.StatusOK)
+	api.request(http.MethodGet, "/lists/"+list.ID, token, nil).expect(t, http.StatusOK)
+	api.request(http.MethodGet, "/no-such-route/"+list.ID, "", nil).expect(t, http.StatusNotFound)
+	api.request("FOO1", "/no-such-route", "", nil).expect(t, http.StatusNotFound)
+	api.request("FOO2", "/lists/"+list.ID, token, nil).expect(t, http.StatusMethodNotAllowed)
+
+	after := api.scrapeMetrics()
+	tests := []struct {
+		sample string
+		want   float64
+	}{
+		{`http_requests_total{method="GET",route="/lists/:id",status="200"}`, 2},
+		{`http_request_duration_seconds_count{method="GET",route="/lists/:id",status="200"}`, 2},
+		{`http_requests_total{method="POST",route="/lists/:id/items",status="200"}`, 1},
+		{`http_requests_total{method="GET",route="unmatched",status="404"}`, 1},
+		{`http_requests_total{method="other",route="unmatched",status="404"}`, 1},
+		{`http_requests_total{method="other",route="unmatched",status="405"}`, 1},
+		{`grocerme_lists_created_total`, 1},
+		{`grocerme_items_added_total`, 1},
+		{`grocerme_users_signed_up_total`, 1},
+	}
+	for _, tt := range tests {
+		if got := after[tt.sample] - before[tt.sample]; got != tt.want {
+			t.Errorf("%s went up by %v, want %v", tt.sample, got, tt.want)
+		}
+	}
+
+	// Routes are labeled by pattern and methods from a fixed set, so IDs and
+	// made-up methods never become label values
+	for sample := range after {
+		if strings.Contains(sample, list.ID) {
+			t.Errorf("metric %s is labeled with a list ID", sample)
+		}
+		if strings.Contains(sample, "FOO") {
+			t.Errorf("metric %s is labeled with a made-up method", sample)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+// Package server assembles the API's routes and middleware around an App
+package server
+
+import (
+	"net/http"
+	"strings"
+
+	"bryce-stabenow/grocer-me/app"
+	"bryce-stabenow/grocer-me/config"
+	"bryce-stabenow/grocer-me/handlers"
+	"bryce-stabenow/grocer-me/metrics"
+	"bryce-stabenow/grocer-me/middleware"
+	"bryce-stabenow/grocer-me/utils"
+)
+
+// New builds the router serving the API for a. main.go and tests both use it,
+// so each gets the same routes and middleware.
+func New(a *app.App) *utils.Router {
+	h := handlers.New(a)
+	router := utils.NewRouter()
+
+	// Log and measure every request, recover from panics, then apply CORS
+	// middleware to matched routes and preflights
+	router.Use(middleware.RequestLogger(a.Logger), middleware.Metrics, middleware.Recover(a.ErrorReporters...), middleware.CORS(corsPolicy(a.Config.CORS)))
+
+	// Health check endpoint
+	router.GET("/health", func(w http.ResponseWriter, r *http.Request) {
+		utils.JSONResponse(w, http.StatusOK, map[string]string{"status": "ok"})
+	})
+
+	// Prometheus metrics endpoint
+	router.GET("/metrics", metrics.Handler().ServeHTTP)
+
+	// Public routes - API endpoints; signing in and up, resetting passwords and
+	// verifying email are rate limited
+	router.POST("/signup", h.HandleSignup, authRateLimits(a, "signup")...)
+	router.POST("/signin", h.HandleSignin, authRateLimits(a, "signin")...)
+	router.POST("/token/refresh", h.HandleRefreshToken)
+	router.POST("/password/forgot", h.HandleForgotPassword, authRateLimits(a, "forgot")...)
+	router.POST("/password/reset", h.HandleResetPassword, authRateLimits(a, "reset")...)
+	router.GET("/verify-email", h.HandleVerifyEmail, middleware.RateLimit(a, "verify:ip", a.Config.Auth.RateLimitIP, clientIP(a)))
+
+	// Protected routes (require JWT, and a CSRF token when authenticated by cookie)
+	protected := router.Group("", middleware.JWTAuth(a), middleware.CSRF(a))
+	protected.GET("/me", h.HandleGetMe)
+	protected.GET("/csrf-token", h.HandleCSRFToken)
+	protected.POST("/logout", h.HandleLogout)
+	protected.POST("/logout/all", h.HandleLogoutAll)
+	protected.POST("/verify-email/resend", h.HandleResendVerification, middleware.RateLimit(a, "resend:user", a.Config.Auth.RateLimitResend, middleware.AuthenticatedUser)) // Each send emails the user
+
+	// List routes
+	lists := router.Group("/lists", middleware.JWTAuth(a), middleware.CSRF(a))
+	lists.POST("", h.HandleCreateList, middleware.RequireVerifiedEmail(a, config.FeatureCreateLists))
+	lists.GET("", h.HandleGetLists)
+	lists.GET("/:id", h.HandleGetList)
+	lists.GET("/:id/events", h.HandleListEvents)
+	lists.POST("/share/:token", h.HandleShareList, middleware.RequireVerifiedEmail(a, config.FeatureSharing))
+	lists.PUT("/:id", h.HandleUpdateList)
+	lists.DELETE("/:id", h.HandleDeleteList)
+	lists.POST("/:id/items", h.HandleAddListItem)
+	lists.PUT("/:id/items/:itemId", h.HandleUpdateListItem)
+	lists.DELETE("/:id/items/:itemId", h.HandleDeleteListItem)
+	lists.PUT("/:id/items/:itemId/checked", h.HandleUpdateListItemChecked)
+
+	// Invite routes
+	lists.POST("/:id/invites", h.HandleCreateInvite, middleware.RequireVerifiedEmail(a, config.FeatureSharing))
+	lists.GET("/:id/invites", h.HandleGetInvites)
+	lists.DELETE("/:id/invites/:inviteId", h.HandleRevokeInvite)
+
+	// Collaborator routes
+	lists.PUT("/:id/collaborators/:userId", h.HandleUpdateCollaboratorRole)
+	lists.DELETE("/:id/collaborators/:userId", h.HandleRemoveCollaborator)
+	lists.POST("/:id/leave", h.HandleLeaveList)
+	lists.POST("/:id/transfer", h.HandleTransferOwnership)
+
+	// List every route with its middleware chain when debugging
+	if a.Config.Server.DebugRoutes {
+		for _, route := range router.Routes() {
+			a.Logger.Info("Route", "method", route.Method, "pattern", route.Pattern, "middleware", strings.Join(route.Middleware, " -> "))
+		}
+	}
+
+	return router
+}
+
+// corsPolicy builds the CORS middleware's policy from the CORS settings
+func corsPolicy(cfg config.CORSConfig) middleware.CORSPolicy {
+	return middleware.CORSPolicy{
+		AllowedOrigins: cfg.AllowedOrigins,
+		AllowedMethods: cfg.AllowedMethods,
+		AllowedHeaders: cfg.AllowedHeaders,
+		ExposedHeaders: cfg.ExposedHeaders,
+		MaxAge:         cfg.MaxAge,
+	}
+}
+
+// authRateLimits limits attempts at an auth route per client IP and per
+// email address
+func authRateLimits(a *app.App, route string) []utils.Middleware {
+	auth := a.Config.Auth
+	return []utils.Middleware{
+		middleware.RateLimit(a, route+":ip", auth.RateLimitIP, clientIP(a)),
+		middleware.RateLimit(a, route+":email", auth.RateLimitEmail, middleware.RequestEmail),
+	}
+}
+
+// clientIP keys rate limits by client IP, as seen through any trusted proxy
+func clientIP(a *app.App) middleware.RateLimitKey {
+	return middleware.ClientIP(a.Config.Server.ClientIPHeader)
+}
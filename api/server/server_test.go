@@ -0,0 +1,1604 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"bryce-stabenow/grocer-me/apierr"
+	"bryce-stabenow/grocer-me/app"
+	"bryce-stabenow/grocer-me/config"
+	"bryce-stabenow/grocer-me/events"
+	"bryce-stabenow/grocer-me/mailer"
+	"bryce-stabenow/grocer-me/middleware"
+	"bryce-stabenow/grocer-me/models"
+	"bryce-stabenow/grocer-me/store"
+	"bryce-stabenow/grocer-me/utils"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testAPI serves the whole API over in-memory stores for one test
+type testAPI struct {
+	t      *testing.T
+	app    *app.App
+	server *httptest.Server
+	mail   *testMailer
+}
+
+// newTestAPI starts an API with test settings, adjusted by configure
+func newTestAPI(t *testing.T, configure ...func(cfg *config.Config)) *testAPI {
+	t.Helper()
+	return startTestAPI(t, newTestApp(configure...))
+}
+
+// newTestApp creates an App with test settings, adjusted by configure, that
+// tests can change further before starting it with startTestAPI
+func newTestApp(configure ...func(cfg *config.Config)) *app.App {
+	cfg := config.Default()
+	cfg.Database.Backend = "memory"
+	cfg.Auth.JWTSecret = "test-secret"
+	cfg.Features.UnverifiedRestrictions = []string{"none"}
+	for _, fn := range configure {
+		fn(cfg)
+	}
+
+	a := app.New(cfg, store.NewMemoryStores())
+	a.Mailer = &testMailer{notify: make(chan struct{}, 1)}
+	a.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	return a
+}
+
+// startTestAPI serves the API for an App made by newTestApp
+func startTestAPI(t *testing.T, a *app.App) *testAPI {
+	t.Helper()
+
+	server := httptest.NewServer(New(a))
+	t.Cleanup(func() {
+		server.Close()
+		a.Events.Close()
+		a.Workers.Shutdown(context.Background())
+	})
+	return &testAPI{t: t, app: a, server: server, mail: a.Mailer.(*testMailer)}
+}
+
+// testMailer keeps the email the API sends so tests can read it
+type testMailer struct {
+	mu     sync.Mutex
+	sent   []mailer.Message
+	notify chan struct{}
+}
+
+func (m *testMailer) Send(ctx context.Context, msg mailer.Message) error {
+	m.mu.Lock()
+	m.sent = append(m.sent, msg)
+	m.mu.Unlock()
+
+	select {
+	case m.notify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// take removes and returns the first email to the given address whose
+// subject contains subject, waiting for it to be sent
+func (m *testMailer) take(t *testing.T, to, subject string) mailer.Message {
+	t.Helper()
+
+	timeout := time.After(5 * time.Second)
+	for {
+		m.mu.Lock()
+		for i, msg := range m.sent {
+			if msg.To == to && strings.Contains(msg.Subject, subject) {
+				m.sent = append(m.sent[:i], m.sent[i+1:]...)
+				m.mu.Unlock()
+				return msg
+			}
+		}
+		m.mu.Unlock()
+
+		select {
+		case <-m.notify:
+		case <-timeout:
+			t.Fatalf("no %q email sent to %s", subject, to)
+		}
+	}
+}
+
+// count returns how many unread emails were sent to the given address
+func (m *testMailer) count(to string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n := 0
+	for _, msg := range m.sent {
+		if msg.To == to {
+			n++
+		}
+	}
+	return n
+}
+
+// linkToken returns the token in the link an email carries
+func linkToken(t *testing.T, msg mailer.Message) string {
+	t.Helper()
+
+	_, link, ok := strings.Cut(msg.Body, "?token=")
+	if !ok {
+		t.Fatalf("email %q has no token link:\n%s", msg.Subject, msg.Body)
+	}
+	link, _, _ = strings.Cut(link, "\n")
+	token, err := url.QueryUnescape(link)
+	if err != nil {
+		t.Fatalf("Failed to read the token in %q: %v", link, err)
+	}
+	return token
+}
+
+// testResponse is a response with its body read
+type testResponse struct {
+	*http.Response
+	body []byte
+}
+
+// request sends a request with body encoded as JSON, authenticated with the
+// bearer token if one is given. headers are name, value pairs.
+func (api *testAPI) request(method, path, token string, body interface{}, headers ...string) *testResponse {
+	api.t.Helper()
+
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			api.t.Fatalf("Failed to encode request body: %v", err)
+		}
+		reader = bytes.NewReader(encoded)
+	}
+
+	req, err := http.NewRequest(method, api.server.URL+path, reader)
+	if err != nil {
+		api.t.Fatalf("Failed to create request: %v", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+
+	resp, err := api.server.Client().Do(req)
+	if err != nil {
+		api.t.Fatalf("%s %s failed: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		api.t.Fatalf("Failed to read response body: %v", err)
+	}
+	return &testResponse{Response: resp, body: data}
+}
+
+// expect fails the test unless the response has the given status
+func (resp *testResponse) expect(t *testing.T, status int) *testResponse {
+	t.Helper()
+	if resp.StatusCode != status {
+		t.Fatalf("%s %s returned %d, want %d: %s", resp.Request.Method, resp.Request.URL.Path, resp.StatusCode, status, resp.body)
+	}
+	return resp
+}
+
+// expectError fails the test unless the response is the given API error
+func (resp *testResponse) expectError(t *testing.T, want *apierr.Error) *testResponse {
+	t.Helper()
+	resp.expect(t, want.Status)
+
+	var problem apierr.Problem
+	resp.decode(t, &problem)
+	if problem.Code != want.Code {
+		t.Fatalf("%s %s returned code %s, want %s", resp.Request.Method, resp.Request.URL.Path, problem.Code, want.Code)
+	}
+	return resp
+}
+
+// decode unmarshals the response body into v
+func (resp *testResponse) decode(t *testing.T, v interface{}) {
+	t.Helper()
+	if err := json.Unmarshal(resp.body, v); err != nil {
+		t.Fatalf("Failed to decode %s: %v", resp.body, err)
+	}
+}
+
+// signUp creates an account, returning its access token and user ID
+func (api *testAPI) signUp(email string) (token, userID string) {
+	api.t.Helper()
+
+	var auth models.AuthResponse
+	api.request(http.MethodPost, "/signup", "", map[string]string{
+		"email":      email,
+		"password":   "password123",
+		"first_name": "Test",
+		"last_name":  "User",
+	}).expect(api.t, http.StatusCreated).decode(api.t, &auth)
+	return auth.Token, auth.User.ID
+}
+
+// createList creates a list owned by the token's user
+func (api *testAPI) createList(token, name string) models.ListResponse {
+	api.t.Helper()
+
+	var list models.ListResponse
+	api.request(http.MethodPost, "/lists", token, map[string]string{"name": name}).
+		expect(api.t, http.StatusCreated).decode(api.t, &list)
+	return list
+}
+
+// addItem adds an item to a list, returning the updated list
+func (api *testAPI) addItem(token, listID, name string) models.ListResponse {
+	api.t.Helper()
+
+	var list models.ListResponse
+	api.request(http.MethodPost, "/lists/"+listID+"/items", token, map[string]string{"name": name}).
+		expect(api.t, http.StatusOK).decode(api.t, &list)
+	return list
+}
+
+// share invites a user to a list with the given role and has them join it
+func (api *testAPI) share(ownerToken, listID string, role models.Role, userToken string) {
+	api.t.Helper()
+
+	var invite models.InviteResponse
+	api.request(http.MethodPost, "/lists/"+listID+"/invites", ownerToken, map[string]string{"role": string(role)}).
+		expect(api.t, http.StatusCreated).decode(api.t, &invite)
+	api.request(http.MethodPost, "/lists/share/"+invite.Token, userToken, nil).expect(api.t, http.StatusOK)
+}
+
+func TestSignUpAndSignIn(t *testing.T) {
+	api := newTestAPI(t)
+	token, userID := api.signUp("alice@example.com")
+
+	var me models.User
+	api.request(http.MethodGet, "/me", token, nil).expect(t, http.StatusOK).decode(t, &me)
+	if me.ID.Hex() != userID || me.Email != "alice@example.com" {
+		t.Fatalf("/me returned %s %s, want %s alice@example.com", me.ID.Hex(), me.Email, userID)
+	}
+
+	api.request(http.MethodPost, "/signup", "", map[string]string{
+		"email": "alice@example.com", "password": "password123", "first_name": "A", "last_name": "B",
+	}).expectError(t, apierr.EmailAlreadyExists)
+
+	api.request(http.MethodPost, "/signin", "", map[string]string{"email": "alice@example.com", "password": "wrong"}).
+		expectError(t, apierr.InvalidCredentials)
+	api.request(http.MethodPost, "/signin", "", map[string]string{"email": "nobody@example.com", "password": "password123"}).
+		expectError(t, apierr.InvalidCredentials)
+
+	var auth models.AuthResponse
+	api.request(http.MethodPost, "/signin", "", map[string]string{"email": "alice@example.com", "password": "password123"}).
+		expect(t, http.StatusOK).decode(t, &auth)
+	if auth.Token == "" || auth.User.ID != userID {
+		t.Fatalf("/signin returned token %q for user %s, want a token for %s", auth.Token, auth.User.ID, userID)
+	}
+	api.request(http.MethodGet, "/me", auth.Token, nil).expect(t, http.StatusOK)
+
+	// Requests without a valid token are refused
+	api.request(http.MethodGet, "/me", "", nil).expectError(t, apierr.AuthRequired)
+	api.request(http.MethodGet, "/me", "not-a-token", nil).expectError(t, apierr.TokenInvalid)
+
+	// Logging out ends the session the token belongs to
+	api.request(http.MethodPost, "/logout", auth.Token, nil).expect(t, http.StatusOK)
+	api.request(http.MethodGet, "/me", auth.Token, nil).expectError(t, apierr.SessionEnded)
+	api.request(http.MethodGet, "/me", token, nil).expect(t, http.StatusOK)
+}
+
+func TestSigninLegacyEmail(t *testing.T) {
+	api := newTestAPI(t)
+
+	// Accounts created before signup checked addresses may not pass the check
+	hash, err := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("Failed to hash password: %v", err)
+	}
+	legacy := models.User{ID: primitive.NewObjectID(), Email: "alice@localhost", PasswordHash: string(hash)}
+	if err := api.app.Stores.Users.Create(context.Background(), &legacy); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	api.request(http.MethodPost, "/signin", "", map[string]string{"email": "alice@localhost", "password": "wrong"}).
+		expectError(t, apierr.InvalidCredentials)
+	api.request(http.MethodPost, "/signin", "", map[string]string{"email": "alice@localhost", "password": "password123"}).
+		expect(t, http.StatusOK)
+	api.request(http.MethodPost, "/password/forgot", "", map[string]string{"email": "alice@localhost"}).expect(t, http.StatusOK)
+	api.mail.take(t, "alice@localhost", "Reset")
+
+	// New accounts still need a valid address
+	api.request(http.MethodPost, "/signup", "", map[string]string{
+		"email": "bob@localhost", "password": "password123", "first_name": "B", "last_name": "C",
+	}).expectError(t, apierr.ValidationFailed)
+}
+
+func TestSignUpValidation(t *testing.T) {
+	api := newTestAPI(t)
+
+	resp := api.request(http.MethodPost, "/signup", "", map[string]string{
+		"email": "not-an-email", "password": "short", "first_name": "A",
+	}).expectError(t, apierr.ValidationFailed)
+
+	var problem struct {
+		Details []struct {
+			Field string `json:"field"`
+			Rule  string `json:"rule"`
+		} `json:"details"`
+	}
+	resp.decode(t, &problem)
+	got := make(map[string]string)
+	for _, detail := range problem.Details {
+		got[detail.Field] = detail.Rule
+	}
+	want := map[string]string{"email": "email", "password": "min", "last_name": "required"}
+	if len(got) != len(want) {
+		t.Fatalf("validation details = %v, want %v", got, want)
+	}
+	for field, rule := range want {
+		if got[field] != rule {
+			t.Fatalf("validation details = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestListAndItemCRUD(t *testing.T) {
+	api := newTestAPI(t)
+	token, userID := api.signUp("alice@example.com")
+
+	list := api.createList(token, "Groceries")
+	if list.Name != "Groceries" || list.UserID != userID || list.Version != 1 {
+		t.Fatalf("created list %+v, want Groceries owned by %s at version 1", list, userID)
+	}
+	listPath := "/lists/" + list.ID
+
+	var lists []models.ListResponse
+	api.request(http.MethodGet, "/lists", token, nil).expect(t, http.StatusOK).decode(t, &lists)
+	if len(lists) != 1 || lists[0].ID != list.ID {
+		t.Fatalf("GET /lists returned %d lists, want the created one", len(lists))
+	}
+
+	resp := api.request(http.MethodGet, listPath, token, nil).expect(t, http.StatusOK)
+	if etag := resp.Header.Get("ETag"); etag != `"1"` {
+		t.Fatalf("ETag = %s, want \"1\"", etag)
+	}
+
+	resp = api.request(http.MethodPut, listPath, token, map[string]string{"name": "Weekly shop"}).expect(t, http.StatusOK)
+	resp.decode(t, &list)
+	if list.Name != "Weekly shop" || list.Version != 2 || resp.Header.Get("ETag") != `"2"` {
+		t.Fatalf("renamed list is %q at version %d with ETag %s, want Weekly shop at 2", list.Name, list.Version, resp.Header.Get("ETag"))
+	}
+
+	list = api.addItem(token, list.ID, "Milk")
+	if len(list.Items) != 1 || list.Items[0].Name != "Milk" || list.Items[0].Quantity != 1 || list.Version != 3 {
+		t.Fatalf("list after adding an item: %+v", list)
+	}
+	itemPath := listPath + "/items/" + list.Items[0].ID.Hex()
+
+	api.request(http.MethodPut, itemPath, token, map[string]interface{}{"name": "Oat milk", "quantity": 2}).
+		expect(t, http.StatusOK).decode(t, &list)
+	if item := list.Items[0]; item.Name != "Oat milk" || item.Quantity != 2 {
+		t.Fatalf("updated item is %+v, want Oat milk x2", item)
+	}
+
+	api.request(http.MethodPut, itemPath+"/checked", token, map[string]bool{"checked": true}).
+		expect(t, http.StatusOK).decode(t, &list)
+	if !list.Items[0].Checked {
+		t.Fatalf("item was not checked")
+	}
+
+	api.request(http.MethodDelete, itemPath, token, nil).expect(t, http.StatusOK).decode(t, &list)
+	if len(list.Items) != 0 || list.Version != 6 {
+		t.Fatalf("list after deleting its item has %d items at version %d, want 0 at 6", len(list.Items), list.Version)
+	}
+	api.request(http.MethodDelete, itemPath, token, nil).expectError(t, apierr.ItemNotFound)
+
+	api.request(http.MethodDelete, listPath, token, nil).expect(t, http.StatusOK)
+	api.request(http.MethodGet, listPath, token, nil).expectError(t, apierr.ListNotFound)
+	api.request(http.MethodGet, "/lists/not-an-id", token, nil).expectError(t, apierr.InvalidID)
+}
+
+func TestListVersionConflict(t *testing.T) {
+	api := newTestAPI(t)
+	token, _ := api.signUp("alice@example.com")
+	list := api.createList(token, "Groceries")
+	listPath := "/lists/" + list.ID
+
+	// Another client changes the list after this one read version 1
+	api.addItem(token, list.ID, "Milk")
+
+	api.request(http.MethodPut, listPath, token, map[string]string{"name": "Stale"}, "If-Match", `"1"`).
+		expectError(t, apierr.ListVersionConflict)
+	api.request(http.MethodPost, listPath+"/items", token, map[string]string{"name": "Eggs"}, "If-Match", `"1"`).
+		expectError(t, apierr.ListVersionConflict)
+	api.request(http.MethodDelete, listPath, token, nil, "If-Match", `"1"`).
+		expectError(t, apierr.ListVersionConflict)
+
+	var current models.ListResponse
+	api.request(http.MethodGet, listPath, token, nil).expect(t, http.StatusOK).decode(t, &current)
+	if current.Name != "Groceries" || len(current.Items) != 1 {
+		t.Fatalf("rejected writes changed the list: %+v", current)
+	}
+
+	// The current version, or any version, is accepted
+	api.request(http.MethodPut, listPath, token, map[string]string{"name": "Fresh"}, "If-Match", `"2"`).expect(t, http.StatusOK)
+	api.request(http.MethodPut, listPath, token, map[string]string{"name": "Any"}, "If-Match", `"1", *`).expect(t, http.StatusOK)
+}
+
+func TestMembershipVersionConflict(t *testing.T) {
+	api := newTestAPI(t)
+	ownerToken, _ := api.signUp("owner@example.com")
+	guestToken, _ := api.signUp("guest@example.com")
+	list := api.createList(ownerToken, "Groceries")
+	listPath := "/lists/" + list.ID
+
+	var invite models.InviteResponse
+	api.request(http.MethodPost, listPath+"/invites", ownerToken, map[string]string{}).
+		expect(t, http.StatusCreated).decode(t, &invite)
+
+	// Joining against a stale version fails without using up the single-use invite
+	api.addItem(ownerToken, list.ID, "Milk")
+	api.request(http.MethodPost, "/lists/share/"+invite.Token, guestToken, nil, "If-Match", `"1"`).
+		expectError(t, apierr.ListVersionConflict)
+	api.request(http.MethodPost, "/lists/share/"+invite.Token, guestToken, nil, "If-Match", `"2"`).
+		expect(t, http.StatusOK)
+
+	// Leaving against a stale version fails and keeps the guest on the list
+	api.request(http.MethodPost, listPath+"/leave", guestToken, nil, "If-Match", `"2"`).
+		expectError(t, apierr.ListVersionConflict)
+	api.request(http.MethodGet, listPath, guestToken, nil).expect(t, http.StatusOK)
+	api.request(http.MethodPost, listPath+"/leave", guestToken, nil, "If-Match", `"3"`).expect(t, http.StatusOK)
+	api.request(http.MethodGet, listPath, guestToken, nil).expectError(t, apierr.ListAccessDenied)
+}
+
+func TestListPermissions(t *testing.T) {
+	api := newTestAPI(t)
+	ownerToken, _ := api.signUp("owner@example.com")
+	editorToken, _ := api.signUp("editor@example.com")
+	viewerToken, viewerID := api.signUp("viewer@example.com")
+	strangerToken, _ := api.signUp("stranger@example.com")
+
+	list := api.addItem(ownerToken, api.createList(ownerToken, "Groceries").ID, "Milk")
+	listPath := "/lists/" + list.ID
+	itemPath := listPath + "/items/" + list.Items[0].ID.Hex()
+	api.share(ownerToken, list.ID, models.RoleEditor, editorToken)
+	api.share(ownerToken, list.ID, models.RoleViewer, viewerToken)
+
+	// Strangers can't see the list at all
+	api.request(http.MethodGet, listPath, strangerToken, nil).expectError(t, apierr.ListAccessDenied)
+	api.request(http.MethodPost, listPath+"/items", strangerToken, map[string]string{"name": "Eggs"}).expectError(t, apierr.ListAccessDenied)
+
+	// Viewers can read and check items off, but not change the list
+	api.request(http.MethodGet, listPath, viewerToken, nil).expect(t, http.StatusOK)
+	api.request(http.MethodPut, itemPath+"/checked", viewerToken, map[string]bool{"checked": true}).expect(t, http.StatusOK)
+	api.request(http.MethodPost, listPath+"/items", viewerToken, map[string]string{"name": "Eggs"}).expectError(t, apierr.PermissionDenied)
+	api.request(http.MethodPut, itemPath, viewerToken, map[string]string{"name": "Cream"}).expectError(t, apierr.PermissionDenied)
+	api.request(http.MethodDelete, itemPath, viewerToken, nil).expectError(t, apierr.PermissionDenied)
+	api.request(http.MethodPut, listPath, viewerToken, map[string]string{"name": "Mine"}).expectError(t, apierr.PermissionDenied)
+
+	// Editors can change items and the list, but not sharing or deletion
+	api.request(http.MethodPost, listPath+"/items", editorToken, map[string]string{"name": "Eggs"}).expect(t, http.StatusOK)
+	api.request(http.MethodPut, listPath, editorToken, map[string]string{"name": "Shared groceries"}).expect(t, http.StatusOK)
+	api.request(http.MethodPost, listPath+"/invites", editorToken, map[string]string{}).expectError(t, apierr.PermissionDenied)
+	api.request(http.MethodPut, listPath+"/collaborators/"+viewerID, editorToken, map[string]string{"role": "editor"}).expectError(t, apierr.PermissionDenied)
+	api.request(http.MethodDelete, listPath, editorToken, nil).expectError(t, apierr.PermissionDenied)
+
+	// Promoting the viewer lets them edit
+	api.request(http.MethodPut, listPath+"/collaborators/"+viewerID, ownerToken, map[string]string{"role": "editor"}).expect(t, http.StatusOK)
+	api.request(http.MethodPost, listPath+"/items", viewerToken, map[string]string{"name": "Bread"}).expect(t, http.StatusOK)
+
+	// Removed collaborators lose access
+	api.request(http.MethodDelete, listPath+"/collaborators/"+viewerID, ownerToken, nil).expect(t, http.StatusOK)
+	api.request(http.MethodGet, listPath, viewerToken, nil).expectError(t, apierr.ListAccessDenied)
+}
+
+// roles maps each collaborator's ID to their role on a list
+func roles(list models.ListResponse) map[string]models.Role {
+	roles := make(map[string]models.Role)
+	for _, user := range list.SharedWith {
+		roles[user.ID] = user.Role
+	}
+	return roles
+}
+
+func TestCollaborators(t *testing.T) {
+	api := newTestAPI(t)
+	ownerToken, ownerID := api.signUp("owner@example.com")
+	editorToken, editorID := api.signUp("editor@example.com")
+	viewerToken, viewerID := api.signUp("viewer@example.com")
+	_, strangerID := api.signUp("stranger@example.com")
+	list := api.createList(ownerToken, "Groceries")
+	listPath := "/lists/" + list.ID
+	api.share(ownerToken, list.ID, models.RoleEditor, editorToken)
+	api.share(ownerToken, list.ID, models.RoleViewer, viewerToken)
+
+	// Viewers and editors can't manage sharing
+	for _, token := range []string{viewerToken, editorToken} {
+		api.request(http.MethodPut, listPath+"/collaborators/"+viewerID, token, map[string]string{"role": "editor"}).
+			expectError(t, apierr.PermissionDenied)
+		api.request(http.MethodDelete, listPath+"/collaborators/"+viewerID, token, nil).expectError(t, apierr.PermissionDenied)
+		api.request(http.MethodPost, listPath+"/transfer", token, map[string]string{"user_id": ownerID}).
+			expectError(t, apierr.PermissionDenied)
+	}
+
+	// Roles can be changed between editor and viewer, but not to owner
+	api.request(http.MethodPut, listPath+"/collaborators/"+viewerID, ownerToken, map[string]string{"role": "owner"}).
+		expectError(t, apierr.ValidationFailed)
+	api.request(http.MethodPut, listPath+"/collaborators/"+strangerID, ownerToken, map[string]string{"role": "editor"}).
+		expectError(t, apierr.CollaboratorNotFound)
+
+	// The owner can't leave or transfer the list to themselves
+	api.request(http.MethodPost, listPath+"/leave", ownerToken, nil).expectError(t, apierr.OwnerCannotLeave)
+	api.request(http.MethodPost, listPath+"/transfer", ownerToken, map[string]string{"user_id": ownerID}).
+		expectError(t, apierr.AlreadyListOwner)
+
+	// Ownership only goes to collaborators
+	api.request(http.MethodPost, listPath+"/transfer", ownerToken, map[string]string{"user_id": strangerID}).
+		expectError(t, apierr.CollaboratorNotFound)
+	api.request(http.MethodPost, listPath+"/transfer", ownerToken, map[string]string{"user_id": "not-an-id"}).
+		expectError(t, apierr.InvalidID)
+
+	// Transferring makes the former owner an editor
+	var transferred models.ListResponse
+	api.request(http.MethodPost, listPath+"/transfer", ownerToken, map[string]string{"user_id": viewerID}).
+		expect(t, http.StatusOK).decode(t, &transferred)
+	if got := roles(transferred); transferred.UserID != viewerID || len(got) != 2 ||
+		got[ownerID] != models.RoleEditor || got[editorID] != models.RoleEditor {
+		t.Fatalf("transferred list is owned by %s with collaborators %v, want %s with the former owner as an editor",
+			transferred.UserID, got, viewerID)
+	}
+	api.request(http.MethodDelete, listPath+"/collaborators/"+editorID, ownerToken, nil).expectError(t, apierr.PermissionDenied)
+
+	// The new owner manages sharing, and the former owner can leave
+	api.request(http.MethodDelete, listPath+"/collaborators/"+editorID, viewerToken, nil).expect(t, http.StatusOK)
+	api.request(http.MethodDelete, listPath+"/collaborators/"+editorID, viewerToken, nil).expectError(t, apierr.CollaboratorNotFound)
+	api.request(http.MethodPost, listPath+"/leave", ownerToken, nil).expect(t, http.StatusOK)
+	api.request(http.MethodPost, listPath+"/leave", ownerToken, nil).expectError(t, apierr.ListAccessDenied)
+
+	var current models.ListResponse
+	api.request(http.MethodGet, listPath, viewerToken, nil).expect(t, http.StatusOK).decode(t, &current)
+	if current.UserID != viewerID || len(current.SharedWith) != 0 {
+		t.Fatalf("list is owned by %s and shared with %v, want %s alone", current.UserID, roles(current), viewerID)
+	}
+}
+
+func TestInvites(t *testing.T) {
+	api := newTestAPI(t)
+	ownerToken, _ := api.signUp("owner@example.com")
+	firstToken, _ := api.signUp("first@example.com")
+	secondToken, _ := api.signUp("second@example.com")
+	list := api.createList(ownerToken, "Groceries")
+
+	// Invites are single use by default
+	var invite models.InviteResponse
+	api.request(http.MethodPost, "/lists/"+list.ID+"/invites", ownerToken, map[string]string{}).
+		expect(t, http.StatusCreated).decode(t, &invite)
+	if invite.Token == "" || invite.MaxUses != 1 || invite.Role != models.RoleEditor {
+		t.Fatalf("created invite %+v, want a single-use editor invite with a token", invite)
+	}
+
+	api.request(http.MethodPost, "/lists/share/"+invite.Token, ownerToken, nil).expectError(t, apierr.AlreadyListOwner)
+	api.request(http.MethodPost, "/lists/share/"+invite.Token, firstToken, nil).expect(t, http.StatusOK)
+	// Joining again is a no-op that doesn't need a use
+	api.request(http.MethodPost, "/lists/share/"+invite.Token, firstToken, nil).expect(t, http.StatusOK)
+	api.request(http.MethodPost, "/lists/share/"+invite.Token, secondToken, nil).expectError(t, apierr.InviteExpired)
+	api.request(http.MethodPost, "/lists/share/not-a-token", secondToken, nil).expectError(t, apierr.InviteNotFound)
+
+	// Revoked invites can't be redeemed
+	api.request(http.MethodPost, "/lists/"+list.ID+"/invites", ownerToken, map[string]int{"max_uses": 0}).
+		expect(t, http.StatusCreated).decode(t, &invite)
+	api.request(http.MethodDelete, "/lists/"+list.ID+"/invites/"+invite.ID, ownerToken, nil).expect(t, http.StatusOK)
+	api.request(http.MethodPost, "/lists/share/"+invite.Token, secondToken, nil).expectError(t, apierr.InviteExpired)
+
+	var invites []models.InviteResponse
+	api.request(http.MethodGet, "/lists/"+list.ID+"/invites", ownerToken, nil).expect(t, http.StatusOK).decode(t, &invites)
+	if len(invites) != 0 {
+		t.Fatalf("GET invites returned %d, want none active", len(invites))
+	}
+
+	// Invites last up to 30 days
+	for _, hours := range []int{-1, 721, 1 << 62} {
+		resp := api.request(http.MethodPost, "/lists/"+list.ID+"/invites", ownerToken, map[string]int{"expires_in_hours": hours}).
+			expectError(t, apierr.ValidationFailed)
+		if !bytes.Contains(resp.body, []byte(`"field":"expires_in_hours"`)) {
+			t.Fatalf("expiry of %d hours rejected with %s, want a field error", hours, resp.body)
+		}
+	}
+	api.request(http.MethodPost, "/lists/"+list.ID+"/invites", ownerToken, map[string]int{"expires_in_hours": 720}).
+		expect(t, http.StatusCreated).decode(t, &invite)
+	if expiry := time.Until(invite.ExpiresAt); expiry < 719*time.Hour || expiry > 720*time.Hour {
+		t.Fatalf("invite expires in %s, want 30 days", expiry)
+	}
+}
+
+// racingLists is a list store where another client changes a list right
+// after it is next read, as if its write landed between a read and a write
+type racingLists struct {
+	store.ListStore
+
+	mu   sync.Mutex
+	race func(list *models.List)
+}
+
+// raceNextGet runs race once, after the next list is read
+func (l *racingLists) raceNextGet(race func(list *models.List)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.race = race
+}
+
+func (l *racingLists) Get(ctx context.Context, id primitive.ObjectID) (*models.List, error) {
+	list, err := l.ListStore.Get(ctx, id)
+	l.mu.Lock()
+	race := l.race
+	l.race = nil
+	l.mu.Unlock()
+	if err == nil && race != nil {
+		race(list)
+	}
+	return list, err
+}
+
+func TestListWriteRace(t *testing.T) {
+	api := newTestAPI(t)
+	lists := &racingLists{ListStore: api.app.Stores.Lists}
+	api.app.Stores.Lists = lists
+
+	token, userID := api.signUp("alice@example.com")
+	list := api.createList(token, "Groceries")
+	listPath := "/lists/" + list.ID
+	ownerID, _ := primitive.ObjectIDFromHex(userID)
+
+	addConcurrently := func(name string) func(list *models.List) {
+		return func(list *models.List) {
+			item := models.ListItem{ID: primitive.NewObjectID(), Name: name, Quantity: 1, AddedBy: ownerID}
+			if _, err := lists.ListStore.AddItem(context.Background(), list.ID, list.Version, item, api.app.Now()); err != nil {
+				t.Errorf("Concurrent AddItem failed: %v", err)
+			}
+		}
+	}
+
+	// Without If-Match the write is retried against the newer list
+	lists.raceNextGet(addConcurrently("Milk"))
+	var renamed models.ListResponse
+	api.request(http.MethodPut, listPath, token, map[string]string{"name": "Weekly shop"}).
+		expect(t, http.StatusOK).decode(t, &renamed)
+	if renamed.Name != "Weekly shop" || len(renamed.Items) != 1 || renamed.Version != 3 {
+		t.Fatalf("renamed list is %q with %d items at version %d, want Weekly shop with the concurrent item at 3",
+			renamed.Name, len(renamed.Items), renamed.Version)
+	}
+
+	// With If-Match the client's version is stale by the time it writes
+	lists.raceNextGet(addConcurrently("Eggs"))
+	api.request(http.MethodPut, listPath, token, map[string]string{"name": "Stale"}, "If-Match", `"3"`).
+		expectError(t, apierr.ListVersionConflict)
+
+	var current models.ListResponse
+	api.request(http.MethodGet, listPath, token, nil).expect(t, http.StatusOK).decode(t, &current)
+	if current.Name != "Weekly shop" || len(current.Items) != 2 || current.Version != 4 {
+		t.Fatalf("list after the rejected rename is %q with %d items at version %d, want Weekly shop with 2 items at 4",
+			current.Name, len(current.Items), current.Version)
+	}
+}
+
+// failingCollaborators is a list store that can't add collaborators
+type failingCollaborators struct {
+	store.ListStore
+}
+
+func (failingCollaborators) AddCollaborator(ctx context.Context, id primitive.ObjectID, version int64, collaborator models.Collaborator, now time.Time) (*models.List, error) {
+	return nil, errors.New("database unavailable")
+}
+
+func TestFailedJoinKeepsInviteUse(t *testing.T) {
+	api := newTestAPI(t)
+	ownerToken, _ := api.signUp("owner@example.com")
+	guestToken, _ := api.signUp("guest@example.com")
+	list := api.createList(ownerToken, "Groceries")
+
+	var invite models.InviteResponse
+	api.request(http.MethodPost, "/lists/"+list.ID+"/invites", ownerToken, map[string]string{}).
+		expect(t, http.StatusCreated).decode(t, &invite)
+
+	lists := api.app.Stores.Lists
+	api.app.Stores.Lists = failingCollaborators{ListStore: lists}
+	api.request(http.MethodPost, "/lists/share/"+invite.Token, guestToken, nil).expectError(t, apierr.Internal)
+
+	// The single use is still there once joining works again
+	api.app.Stores.Lists = lists
+	api.request(http.MethodPost, "/lists/share/"+invite.Token, guestToken, nil).expect(t, http.StatusOK)
+}
+
+// blockingLists is a list store whose ListForUser waits until its context
+// ends, like a query against a database that stopped responding
+type blockingLists struct {
+	store.ListStore
+	entered chan struct{}
+}
+
+func (l *blockingLists) ListForUser(ctx context.Context, userID primitive.ObjectID) ([]models.List, error) {
+	l.entered <- struct{}{}
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestCancelledRequest(t *testing.T) {
+	api := newTestAPI(t)
+	token, _ := api.signUp("alice@example.com")
+	lists := &blockingLists{ListStore: api.app.Stores.Lists, entered: make(chan struct{}, 1)}
+	api.app.Stores.Lists = lists
+
+	// A client going away cancels the store call it was waiting on
+	ctx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequest(http.MethodGet, "/lists", nil).WithContext(ctx)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		New(api.app).ServeHTTP(rec, req)
+	}()
+
+	<-lists.entered
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("store call not cancelled with the request")
+	}
+
+	var problem apierr.Problem
+	if err := json.Unmarshal(rec.Body.Bytes(), &problem); err != nil {
+		t.Fatalf("Failed to decode %s: %v", rec.Body.Bytes(), err)
+	}
+	if rec.Code != apierr.StatusClientClosedRequest || problem.Status != apierr.StatusClientClosedRequest ||
+		problem.Code != apierr.RequestCancelled.Code || problem.Title != "Client Closed Request" {
+		t.Fatalf("cancelled request returned %d: %s, want a %s problem", rec.Code, rec.Body.Bytes(), apierr.RequestCancelled.Code)
+	}
+}
+
+func TestStoreTimeout(t *testing.T) {
+	api := newTestAPI(t, func(cfg *config.Config) {
+		cfg.Database.Timeout = 50 * time.Millisecond
+	})
+	token, _ := api.signUp("alice@example.com")
+	api.app.Stores.Lists = &blockingLists{ListStore: api.app.Stores.Lists, entered: make(chan struct{}, 1)}
+
+	// A store call that outlives the store timeout fails the request
+	api.request(http.MethodGet, "/lists", token, nil).expectError(t, apierr.Timeout)
+}
+
+// cookie returns the value of a cookie the response set
+func (resp *testResponse) cookie(t *testing.T, name string) string {
+	t.Helper()
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name == name {
+			return cookie.Value
+		}
+	}
+	t.Fatalf("%s %s set no %s cookie", resp.Request.Method, resp.Request.URL.Path, name)
+	return ""
+}
+
+func TestRefreshTokenCookieOrigin(t *testing.T) {
+	api := newTestAPI(t, func(cfg *config.Config) {
+		cfg.CORS.AllowedOrigins = []string{"https://grocer.me"}
+	})
+	api.signUp("alice@example.com")
+	refreshToken := api.request(http.MethodPost, "/signin", "", map[string]string{"email": "alice@example.com", "password": "password123"}).
+		expect(t, http.StatusOK).cookie(t, "refresh_token")
+
+	// Other sites can't use the browser's refresh cookie, and trying doesn't spend it
+	api.request(http.MethodPost, "/token/refresh", "", nil, "Cookie", "refresh_token="+refreshToken, "Origin", "https://evil.example").
+		expectError(t, apierr.OriginNotAllowed)
+
+	refreshToken = api.request(http.MethodPost, "/token/refresh", "", nil, "Cookie", "refresh_token="+refreshToken, "Origin", "https://grocer.me").
+		expect(t, http.StatusOK).cookie(t, "refresh_token")
+
+	// Server-side refreshes send no Origin
+	refreshToken = api.request(http.MethodPost, "/token/refresh", "", nil, "Cookie", "refresh_token="+refreshToken).
+		expect(t, http.StatusOK).cookie(t, "refresh_token")
+
+	// Tokens in the body aren't sent by browsers on their own, so any origin may use them
+	api.request(http.MethodPost, "/token/refresh", "", map[string]string{"refresh_token": refreshToken}, "Origin", "https://evil.example").
+		expect(t, http.StatusOK)
+}
+
+// testClock is a clock for the API that only moves when told to
+type testClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// useClock makes the API tell the time by a test clock starting now
+func (api *testAPI) useClock() *testClock {
+	clock := &testClock{now: time.Now()}
+	api.app.Now = clock.Now
+	return clock
+}
+
+func (c *testClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *testClock) advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// expectHeaders fails the test unless the response has the given headers,
+// given as name, value pairs
+func (resp *testResponse) expectHeaders(t *testing.T, headers ...string) *testResponse {
+	t.Helper()
+	for i := 0; i+1 < len(headers); i += 2 {
+		if got := resp.Header.Get(headers[i]); got != headers[i+1] {
+			t.Fatalf("%s %s returned %s: %q, want %q", resp.Request.Method, resp.Request.URL.Path, headers[i], got, headers[i+1])
+		}
+	}
+	return resp
+}
+
+func TestSigninRateLimit(t *testing.T) {
+	api := newTestAPI(t, func(cfg *config.Config) {
+		cfg.Auth.RateLimitIP = store.RateLimit{Requests: 100, Per: time.Minute}
+		cfg.Auth.RateLimitEmail = store.RateLimit{Requests: 3, Per: time.Minute}
+	})
+	clock := api.useClock()
+	api.signUp("alice@example.com")
+	api.signUp("bob@example.com")
+
+	signin := func(email string) *testResponse {
+		return api.request(http.MethodPost, "/signin", "", map[string]string{"email": email, "password": "password123"})
+	}
+
+	// Each email gets 3 attempts a minute, reported by the tighter of the two limits
+	for remaining := 2; remaining >= 0; remaining-- {
+		signin("alice@example.com").expect(t, http.StatusOK).
+			expectHeaders(t, "RateLimit-Limit", "3", "RateLimit-Remaining", strconv.Itoa(remaining), "RateLimit-Policy", "3;w=60")
+	}
+	signin("Alice@Example.com").expectError(t, apierr.RateLimited).
+		expectHeaders(t, "Retry-After", "20", "RateLimit-Remaining", "0", "RateLimit-Reset", "60")
+
+	// Other accounts are unaffected
+	signin("bob@example.com").expect(t, http.StatusOK)
+
+	// The bucket refills at one attempt every 20 seconds
+	clock.advance(20 * time.Second)
+	signin("alice@example.com").expect(t, http.StatusOK)
+	signin("alice@example.com").expectError(t, apierr.RateLimited)
+}
+
+func TestSigninLockout(t *testing.T) {
+	api := newTestAPI(t, func(cfg *config.Config) {
+		cfg.Auth.RateLimitEmail = store.RateLimit{Requests: 100, Per: time.Minute}
+		cfg.Auth.Lockout.Threshold = 3
+		cfg.Auth.Lockout.Base = time.Minute
+	})
+	clock := api.useClock()
+	api.signUp("alice@example.com")
+
+	signin := func(password string) *testResponse {
+		return api.request(http.MethodPost, "/signin", "", map[string]string{"email": "alice@example.com", "password": password})
+	}
+
+	signin("wrong").expectError(t, apierr.InvalidCredentials)
+	signin("wrong").expectError(t, apierr.InvalidCredentials)
+	signin("wrong").expectError(t, apierr.AccountLocked).expectHeaders(t, "Retry-After", "60")
+
+	// A locked account can't sign in even with the right password
+	clock.advance(30 * time.Second)
+	signin("password123").expectError(t, apierr.AccountLocked).expectHeaders(t, "Retry-After", "30")
+
+	// Once the lockout ends, signing in works and clears the failures
+	clock.advance(31 * time.Second)
+	signin("password123").expect(t, http.StatusOK)
+	signin("wrong").expectError(t, apierr.InvalidCredentials)
+	signin("wrong").expectError(t, apierr.InvalidCredentials)
+
+	// Failing again after the threshold locks the account for twice as long
+	signin("wrong").expectError(t, apierr.AccountLocked).expectHeaders(t, "Retry-After", "60")
+	clock.advance(61 * time.Second)
+	signin("wrong").expectError(t, apierr.AccountLocked).expectHeaders(t, "Retry-After", "120")
+}
+
+// sseEvent is one event read from an event stream
+type sseEvent struct {
+	id, event, data string
+}
+
+// eventStream reads server-sent events from an open response
+type eventStream struct {
+	t      *testing.T
+	events chan sseEvent
+}
+
+// stream opens a list's event stream, resuming after lastEventID if it's set.
+// The stream is closed when the test ends.
+func (api *testAPI) stream(token, listID, lastEventID string) *eventStream {
+	api.t.Helper()
+
+	req, err := http.NewRequest(http.MethodGet, api.server.URL+"/lists/"+listID+"/events", nil)
+	if err != nil {
+		api.t.Fatalf("Failed to create request: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := api.server.Client().Do(req)
+	if err != nil {
+		api.t.Fatalf("GET events failed: %v", err)
+	}
+	api.t.Cleanup(func() { resp.Body.Close() })
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		api.t.Fatalf("GET events returned %d %s, want a 200 event stream", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	stream := &eventStream{t: api.t, events: make(chan sseEvent, 16)}
+	go func() {
+		defer close(stream.events)
+		scanner := bufio.NewScanner(resp.Body)
+		var event sseEvent
+		for scanner.Scan() {
+			line := scanner.Text()
+			name, value, _ := strings.Cut(line, ": ")
+			switch name {
+			case "id":
+				event.id = value
+			case "event":
+				event.event = value
+			case "data":
+				event.data = value
+			case "":
+				if event.event != "" {
+					stream.events <- event
+				}
+				event = sseEvent{}
+			}
+		}
+	}()
+	return stream
+}
+
+// next returns the next event, failing the test if none arrives
+func (s *eventStream) next(want string) sseEvent {
+	s.t.Helper()
+	select {
+	case event, open := <-s.events:
+		if !open {
+			s.t.Fatalf("event stream ended, want %s", want)
+		}
+		if event.event != want {
+			s.t.Fatalf("received %s event, want %s", event.event, want)
+		}
+		return event
+	case <-time.After(5 * time.Second):
+		s.t.Fatalf("no %s event received", want)
+		return sseEvent{}
+	}
+}
+
+// expectEnd fails the test unless the server ends the stream
+func (s *eventStream) expectEnd() {
+	s.t.Helper()
+	select {
+	case event, open := <-s.events:
+		if open {
+			s.t.Fatalf("received %s event, want the stream to end", event.event)
+		}
+	case <-time.After(5 * time.Second):
+		s.t.Fatalf("event stream still open")
+	}
+}
+
+func TestListEvents(t *testing.T) {
+	api := newTestAPI(t)
+	ownerToken, _ := api.signUp("owner@example.com")
+	guestToken, guestID := api.signUp("guest@example.com")
+	strangerToken, _ := api.signUp("stranger@example.com")
+	list := api.createList(ownerToken, "Groceries")
+	api.share(ownerToken, list.ID, models.RoleViewer, guestToken)
+
+	api.request(http.MethodGet, "/lists/"+list.ID+"/events", strangerToken, nil).expectError(t, apierr.ListAccessDenied)
+	api.request(http.MethodGet, "/lists/"+list.ID+"/events", guestToken, nil, "Last-Event-ID", "x").
+		expectError(t, apierr.InvalidParameter)
+
+	// Subscribers receive item changes as they happen
+	stream := api.stream(guestToken, list.ID, "")
+	api.addItem(ownerToken, list.ID, "Milk")
+	added := stream.next(events.ItemAdded)
+	var data models.ListEvent
+	if err := json.Unmarshal([]byte(added.data), &data); err != nil || data.ListID != list.ID || data.Version != 3 || data.Item == nil || data.Item.Name != "Milk" {
+		t.Fatalf("item-added data %s, want Milk at version 3", added.data)
+	}
+	api.request(http.MethodPut, "/lists/"+list.ID, ownerToken, map[string]string{"name": "Weekly shop"}).expect(t, http.StatusOK)
+	renamed := stream.next(events.ListRenamed)
+
+	// Reconnecting with Last-Event-ID replays what was missed
+	api.addItem(ownerToken, list.ID, "Eggs")
+	stream.next(events.ItemAdded)
+	resumed := api.stream(guestToken, list.ID, added.id)
+	if event := resumed.next(events.ListRenamed); event.id != renamed.id {
+		t.Fatalf("resumed at event %s, want %s", event.id, renamed.id)
+	}
+	resumed.next(events.ItemAdded)
+
+	// Removing the guest ends their streams
+	api.request(http.MethodDelete, "/lists/"+list.ID+"/collaborators/"+guestID, ownerToken, nil).expect(t, http.StatusOK)
+	stream.next(events.MembersChanged)
+	stream.expectEnd()
+	resumed.next(events.MembersChanged)
+	resumed.expectEnd()
+}
+
+func TestListEventsHead(t *testing.T) {
+	api := newTestAPI(t)
+	token, _ := api.signUp("alice@example.com")
+	list := api.createList(token, "Groceries")
+
+	// HEAD answers with the stream's headers instead of holding the connection open
+	resp := api.request(http.MethodHead, "/lists/"+list.ID+"/events", token, nil).expect(t, http.StatusOK).
+		expectHeaders(t, "Content-Type", "text/event-stream")
+	if len(resp.body) != 0 {
+		t.Fatalf("HEAD events returned a body: %q", resp.body)
+	}
+}
+
+func TestListEventsEnd(t *testing.T) {
+	api := newTestAPI(t, func(cfg *config.Config) {
+		cfg.Server.EventHeartbeat = 20 * time.Millisecond
+	})
+	ownerToken, _ := api.signUp("owner@example.com")
+	guestToken, _ := api.signUp("guest@example.com")
+	list := api.createList(ownerToken, "Groceries")
+	api.share(ownerToken, list.ID, models.RoleEditor, guestToken)
+
+	// Signing out ends the session's streams at the next heartbeat
+	stream := api.stream(guestToken, list.ID, "")
+	other := api.stream(ownerToken, list.ID, "")
+	api.request(http.MethodPost, "/logout", guestToken, nil).expect(t, http.StatusOK)
+	stream.expectEnd()
+
+	// Deleting the list ends every stream
+	api.request(http.MethodDelete, "/lists/"+list.ID, ownerToken, nil).expect(t, http.StatusOK)
+	other.expectEnd()
+}
+
+func TestListEventsResync(t *testing.T) {
+	api := newTestAPI(t)
+	api.app.Events = events.NewHub(2)
+	token, _ := api.signUp("alice@example.com")
+	list := api.createList(token, "Groceries")
+
+	stream := api.stream(token, list.ID, "")
+	api.addItem(token, list.ID, "Milk")
+	seen := stream.next(events.ItemAdded)
+	for _, name := range []string{"Eggs", "Bread", "Butter"} {
+		api.addItem(token, list.ID, name)
+	}
+
+	// Events after the one seen have been overrun, so the client must refetch
+	resumed := api.stream(token, list.ID, seen.id)
+	resumed.next("resync")
+	api.addItem(token, list.ID, "Jam")
+	resumed.next(events.ItemAdded)
+}
+
+// signIn starts a new session for an account created by signUp
+func (api *testAPI) signIn(email string) models.AuthResponse {
+	api.t.Helper()
+
+	var auth models.AuthResponse
+	api.request(http.MethodPost, "/signin", "", map[string]string{"email": email, "password": "password123"}).
+		expect(api.t, http.StatusOK).decode(api.t, &auth)
+	return auth
+}
+
+// refresh exchanges a refresh token sent in the request body
+func (api *testAPI) refresh(refreshToken string) *testResponse {
+	api.t.Helper()
+	return api.request(http.MethodPost, "/token/refresh", "", map[string]string{"refresh_token": refreshToken})
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	api := newTestAPI(t)
+	clock := api.useClock()
+	api.signUp("alice@example.com")
+	auth := api.signIn("alice@example.com")
+
+	// Refreshing rotates the refresh token
+	var first models.TokenResponse
+	api.refresh(auth.RefreshToken).expect(t, http.StatusOK).decode(t, &first)
+	if first.RefreshToken == "" || first.RefreshToken == auth.RefreshToken || first.Token == "" {
+		t.Fatalf("refresh returned refresh token %q, want a new one", first.RefreshToken)
+	}
+	api.request(http.MethodGet, "/me", first.Token, nil).expect(t, http.StatusOK)
+
+	// A near-simultaneous refresh with the old token, e.g. from another tab,
+	// is refused without ending the session
+	api.refresh(auth.RefreshToken).expectError(t, apierr.RefreshTokenReused)
+	api.request(http.MethodGet, "/me", first.Token, nil).expect(t, http.StatusOK)
+
+	var second models.TokenResponse
+	api.refresh(first.RefreshToken).expect(t, http.StatusOK).decode(t, &second)
+
+	// Replaying a rotated token after the grace period revokes the session
+	clock.advance(api.app.Config.Auth.RefreshReuseGrace + time.Second)
+	api.refresh(first.RefreshToken).expectError(t, apierr.RefreshTokenReused)
+	api.request(http.MethodGet, "/me", second.Token, nil).expectError(t, apierr.SessionEnded)
+	api.refresh(second.RefreshToken).expectError(t, apierr.SessionEnded)
+
+	api.refresh("not-a-token").expectError(t, apierr.RefreshTokenInvalid)
+	api.refresh("").expectError(t, apierr.AuthRequired)
+}
+
+func TestRefreshTokenOldReuse(t *testing.T) {
+	api := newTestAPI(t)
+	clock := api.useClock()
+	api.signUp("alice@example.com")
+	stolen := api.signIn("alice@example.com").RefreshToken
+
+	// A thief refreshes twice with a stolen token before its owner does
+	var first, second models.TokenResponse
+	api.refresh(stolen).expect(t, http.StatusOK).decode(t, &first)
+	clock.advance(time.Minute)
+	api.refresh(first.RefreshToken).expect(t, http.StatusOK).decode(t, &second)
+
+	// The owner's token is two rotations old but still revokes the session
+	clock.advance(api.app.Config.Auth.RefreshReuseGrace + time.Second)
+	api.refresh(stolen).expectError(t, apierr.RefreshTokenReused)
+	api.request(http.MethodGet, "/me", second.Token, nil).expectError(t, apierr.SessionEnded)
+	api.refresh(second.RefreshToken).expectError(t, apierr.SessionEnded)
+}
+
+func TestRefreshTokenNoReuseGrace(t *testing.T) {
+	api := newTestAPI(t, func(cfg *config.Config) {
+		cfg.Auth.RefreshReuseGrace = 0
+	})
+	api.useClock()
+	api.signUp("alice@example.com")
+	auth := api.signIn("alice@example.com")
+
+	// Without a grace period even an immediate reuse revokes the session
+	var refreshed models.TokenResponse
+	api.refresh(auth.RefreshToken).expect(t, http.StatusOK).decode(t, &refreshed)
+	api.refresh(auth.RefreshToken).expectError(t, apierr.RefreshTokenReused)
+	api.request(http.MethodGet, "/me", refreshed.Token, nil).expectError(t, apierr.SessionEnded)
+}
+
+func TestTokenExpiry(t *testing.T) {
+	api := newTestAPI(t)
+	clock := api.useClock()
+	api.signUp("alice@example.com")
+	auth := api.signIn("alice@example.com")
+
+	// Access tokens expire, but the session can be refreshed until it does
+	clock.advance(api.app.Config.Auth.AccessTokenTTL + time.Second)
+	api.request(http.MethodGet, "/me", auth.Token, nil).expectError(t, apierr.TokenExpired)
+	var refreshed models.TokenResponse
+	api.refresh(auth.RefreshToken).expect(t, http.StatusOK).decode(t, &refreshed)
+	api.request(http.MethodGet, "/me", refreshed.Token, nil).expect(t, http.StatusOK)
+
+	clock.advance(api.app.Config.Auth.RefreshTokenTTL + time.Second)
+	api.refresh(refreshed.RefreshToken).expectError(t, apierr.SessionEnded)
+}
+
+// racingSessions is a session store where another refresh rotates a
+// session's token right after the next lookup, as if it won a race
+type racingSessions struct {
+	store.SessionStore
+
+	mu   sync.Mutex
+	race bool
+}
+
+// raceNextLookup has another refresh win the race after the next lookup
+func (s *racingSessions) raceNextLookup() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.race = true
+}
+
+func (s *racingSessions) GetByRefreshTokenHash(ctx context.Context, tokenHash string) (*models.Session, error) {
+	session, err := s.SessionStore.GetByRefreshTokenHash(ctx, tokenHash)
+	s.mu.Lock()
+	race := s.race
+	s.race = false
+	s.mu.Unlock()
+	if err == nil && race {
+		if err := s.SessionStore.Rotate(ctx, session.ID, tokenHash, "winner", session.LastUsedAt, session.ExpiresAt); err != nil {
+			return nil, err
+		}
+	}
+	return session, err
+}
+
+func TestRefreshTokenRotateRace(t *testing.T) {
+	api := newTestAPI(t)
+	sessions := &racingSessions{SessionStore: api.app.Stores.Sessions}
+	api.app.Stores.Sessions = sessions
+	api.signUp("alice@example.com")
+	auth := api.signIn("alice@example.com")
+
+	// Losing the race to rotate is reported as reuse, but the winner keeps the session
+	sessions.raceNextLookup()
+	api.refresh(auth.RefreshToken).expectError(t, apierr.RefreshTokenReused)
+	api.request(http.MethodGet, "/me", auth.Token, nil).expect(t, http.StatusOK)
+}
+
+func TestLogout(t *testing.T) {
+	api := newTestAPI(t)
+	api.signUp("alice@example.com")
+	phone := api.signIn("alice@example.com")
+	laptop := api.signIn("alice@example.com")
+	tablet := api.signIn("alice@example.com")
+
+	// Logging out ends only that session, including its refresh token
+	api.request(http.MethodPost, "/logout", phone.Token, nil).expect(t, http.StatusOK)
+	api.request(http.MethodGet, "/me", phone.Token, nil).expectError(t, apierr.SessionEnded)
+	api.refresh(phone.RefreshToken).expectError(t, apierr.SessionEnded)
+	api.request(http.MethodGet, "/me", laptop.Token, nil).expect(t, http.StatusOK)
+
+	// Logging out of all devices ends every session
+	api.request(http.MethodPost, "/logout/all", laptop.Token, nil).expect(t, http.StatusOK)
+	for _, auth := range []models.AuthResponse{laptop, tablet} {
+		api.request(http.MethodGet, "/me", auth.Token, nil).expectError(t, apierr.SessionEnded)
+		api.refresh(auth.RefreshToken).expectError(t, apierr.SessionEnded)
+	}
+
+	// Signing in again starts a new session
+	api.request(http.MethodGet, "/me", api.signIn("alice@example.com").Token, nil).expect(t, http.StatusOK)
+}
+
+func TestPasswordReset(t *testing.T) {
+	api := newTestAPI(t)
+	clock := api.useClock()
+	token, _ := api.signUp("alice@example.com")
+	api.mail.take(t, "alice@example.com", "Verify")
+	otherDevice := api.signIn("alice@example.com")
+
+	forgot := func(email string) *testResponse {
+		return api.request(http.MethodPost, "/password/forgot", "", map[string]string{"email": email}).expect(t, http.StatusOK)
+	}
+	reset := func(token, password string) *testResponse {
+		return api.request(http.MethodPost, "/password/reset", "", map[string]string{"token": token, "password": password})
+	}
+
+	// Unknown emails get the same response as registered ones
+	unknown := forgot("nobody@example.com")
+	known := forgot("alice@example.com")
+	if !bytes.Equal(unknown.body, known.body) {
+		t.Fatalf("forgot password responses differ: %s and %s", unknown.body, known.body)
+	}
+	first := linkToken(t, api.mail.take(t, "alice@example.com", "Reset"))
+
+	// No other link is sent while a recent one is outstanding
+	forgot("alice@example.com")
+
+	// Once the cooldown is over, requesting another link invalidates the first
+	clock.advance(10 * time.Minute)
+	forgot("alice@example.com")
+	second := linkToken(t, api.mail.take(t, "alice@example.com", "Reset"))
+	reset(first, "new-password").expectError(t, apierr.ResetTokenInvalid)
+
+	// A link works once, and signs the account out everywhere
+	reset(second, "new-password").expect(t, http.StatusOK)
+	reset(second, "other-password").expectError(t, apierr.ResetTokenInvalid)
+	api.request(http.MethodGet, "/me", token, nil).expectError(t, apierr.SessionEnded)
+	api.request(http.MethodGet, "/me", otherDevice.Token, nil).expectError(t, apierr.SessionEnded)
+	api.refresh(otherDevice.RefreshToken).expectError(t, apierr.SessionEnded)
+
+	api.request(http.MethodPost, "/signin", "", map[string]string{"email": "alice@example.com", "password": "password123"}).
+		expectError(t, apierr.InvalidCredentials)
+	api.request(http.MethodPost, "/signin", "", map[string]string{"email": "alice@example.com", "password": "new-password"}).
+		expect(t, http.StatusOK)
+
+	// Links expire after an hour
+	forgot("alice@example.com")
+	expired := linkToken(t, api.mail.take(t, "alice@example.com", "Reset"))
+	clock.advance(time.Hour + time.Second)
+	reset(expired, "newer-password").expectError(t, apierr.ResetTokenInvalid)
+	reset("not-a-token", "newer-password").expectError(t, apierr.ResetTokenInvalid)
+
+	// Nothing was ever sent to the unknown address, nor during the cooldown
+	api.app.Workers.Shutdown(context.Background())
+	if n := api.mail.count("nobody@example.com"); n != 0 {
+		t.Fatalf("sent %d emails to an unregistered address", n)
+	}
+	if n := api.mail.count("alice@example.com"); n != 0 {
+		t.Fatalf("sent %d more reset emails than expected", n)
+	}
+}
+
+func TestPasswordResetRateLimit(t *testing.T) {
+	api := newTestAPI(t, func(cfg *config.Config) {
+		cfg.Auth.RateLimitIP = store.RateLimit{Requests: 4, Per: time.Minute}
+		cfg.Auth.RateLimitEmail = store.RateLimit{Requests: 2, Per: time.Minute}
+	})
+	api.signUp("alice@example.com")
+
+	forgot := func(email string) *testResponse {
+		return api.request(http.MethodPost, "/password/forgot", "", map[string]string{"email": email})
+	}
+	reset := func() *testResponse {
+		return api.request(http.MethodPost, "/password/reset", "", map[string]string{"token": "guess", "password": "new-password"})
+	}
+
+	// Each email can ask for a link twice a minute
+	forgot("alice@example.com").expect(t, http.StatusOK)
+	forgot("alice@example.com").expect(t, http.StatusOK)
+	forgot("alice@example.com").expectError(t, apierr.RateLimited)
+	forgot("bob@example.com").expect(t, http.StatusOK)
+
+	// Reset tokens can only be guessed a few times a minute from one address
+	for i := 0; i < 4; i++ {
+		reset().expectError(t, apierr.ResetTokenInvalid)
+	}
+	reset().expectError(t, apierr.RateLimited)
+}
+
+func TestEmailVerification(t *testing.T) {
+	api := newTestAPI(t)
+	clock := api.useClock()
+	token, userID := api.signUp("alice@example.com")
+	signupLink := linkToken(t, api.mail.take(t, "alice@example.com", "Verify"))
+
+	id, _ := primitive.ObjectIDFromHex(userID)
+
+	verify := func(token string) *testResponse {
+		return api.request(http.MethodGet, "/verify-email?token="+url.QueryEscape(token), "", nil)
+	}
+	verified := func() bool {
+		user, err := api.app.Stores.Users.GetByID(context.Background(), id)
+		if err != nil {
+			t.Fatalf("Failed to get user: %v", err)
+		}
+		return user.EmailVerified
+	}
+
+	// Resending replaces the link sent at signup
+	api.request(http.MethodPost, "/verify-email/resend", token, nil).expect(t, http.StatusOK)
+	resent := linkToken(t, api.mail.take(t, "alice@example.com", "Verify"))
+	verify(signupLink).expectError(t, apierr.VerificationInvalid)
+
+	// Links expire after a day
+	clock.advance(24*time.Hour + time.Second)
+	verify(resent).expectError(t, apierr.VerificationInvalid)
+	if verified() {
+		t.Fatalf("email verified by an expired link")
+	}
+
+	// A link only verifies the address it was sent to
+	now := api.app.Now()
+	stale := models.EmailVerification{
+		ID:        primitive.NewObjectID(),
+		UserID:    id,
+		Email:     "old-address@example.com",
+		TokenHash: utils.HashToken("stale-link"),
+		ExpiresAt: now.Add(time.Hour),
+		CreatedAt: now,
+	}
+	if err := api.app.Stores.Verifications.Create(context.Background(), &stale); err != nil {
+		t.Fatalf("Failed to create verification: %v", err)
+	}
+	verify("stale-link").expectError(t, apierr.VerificationInvalid)
+	if verified() {
+		t.Fatalf("email verified by a link sent to another address")
+	}
+
+	// A current link works once
+	token = api.signIn("alice@example.com").Token
+	api.request(http.MethodPost, "/verify-email/resend", token, nil).expect(t, http.StatusOK)
+	link := linkToken(t, api.mail.take(t, "alice@example.com", "Verify"))
+	verify(link).expect(t, http.StatusOK)
+	verify(link).expectError(t, apierr.VerificationInvalid)
+	if !verified() {
+		t.Fatalf("email not verified by its link")
+	}
+
+	// Verified users can't ask for another link
+	api.request(http.MethodPost, "/verify-email/resend", token, nil).expectError(t, apierr.EmailAlreadyVerified)
+	api.request(http.MethodGet, "/verify-email", "", nil).expectError(t, apierr.MissingParameter)
+}
+
+func TestEmailVerificationRateLimit(t *testing.T) {
+	api := newTestAPI(t, func(cfg *config.Config) {
+		cfg.Auth.RateLimitIP = store.RateLimit{Requests: 3, Per: time.Minute}
+		cfg.Auth.RateLimitResend = store.RateLimit{Requests: 2, Per: time.Hour}
+	})
+	clock := api.useClock()
+	alice, _ := api.signUp("alice@example.com")
+	bob, _ := api.signUp("bob@example.com")
+
+	// Each user can have their link resent twice an hour
+	api.request(http.MethodPost, "/verify-email/resend", alice, nil).expect(t, http.StatusOK)
+	api.request(http.MethodPost, "/verify-email/resend", alice, nil).expect(t, http.StatusOK)
+	api.request(http.MethodPost, "/verify-email/resend", alice, nil).expectError(t, apierr.RateLimited).
+		expectHeaders(t, "Retry-After", "1800")
+	api.request(http.MethodPost, "/verify-email/resend", bob, nil).expect(t, http.StatusOK)
+
+	clock.advance(30 * time.Minute)
+	alice = api.signIn("alice@example.com").Token
+	api.request(http.MethodPost, "/verify-email/resend", alice, nil).expect(t, http.StatusOK)
+
+	// Verification tokens can only be guessed a few times a minute from one address
+	for i := 0; i < 3; i++ {
+		api.request(http.MethodGet, "/verify-email?token=guess", "", nil).expectError(t, apierr.VerificationInvalid)
+	}
+	api.request(http.MethodGet, "/verify-email?token=guess", "", nil).expectError(t, apierr.RateLimited)
+}
+
+// testReporter records the errors reported to it
+type testReporter struct {
+	mu     sync.Mutex
+	errors []error
+	stacks [][]byte
+}
+
+func (rep *testReporter) Report(r *http.Request, err error, stack []byte) {
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+	rep.errors = append(rep.errors, err)
+	rep.stacks = append(rep.stacks, stack)
+}
+
+// panickingLists is a list store that panics when a user's lists are listed
+type panickingLists struct {
+	store.ListStore
+}
+
+func (panickingLists) ListForUser(ctx context.Context, userID primitive.ObjectID) ([]models.List, error) {
+	panic("list index corrupted")
+}
+
+func TestUnverifiedRestrictions(t *testing.T) {
+	api := newTestAPI(t, func(cfg *config.Config) {
+		cfg.Features.UnverifiedRestrictions = []string{config.FeatureSharing}
+	})
+	ownerToken, _ := api.signUp("owner@example.com")
+	guestToken, _ := api.signUp("guest@example.com")
+	ownerLink := linkToken(t, api.mail.take(t, "owner@example.com", "Verify"))
+	guestLink := linkToken(t, api.mail.take(t, "guest@example.com", "Verify"))
+
+	// Unverified users can still create lists but not share them
+	list := api.createList(ownerToken, "Groceries")
+	api.request(http.MethodPost, "/lists/"+list.ID+"/invites", ownerToken, map[string]string{}).
+		expectError(t, apierr.EmailNotVerified)
+
+	api.request(http.MethodGet, "/verify-email?token="+url.QueryEscape(ownerLink), "", nil).expect(t, http.StatusOK)
+	var invite models.InviteResponse
+	api.request(http.MethodPost, "/lists/"+list.ID+"/invites", ownerToken, map[string]string{}).
+		expect(t, http.StatusCreated).decode(t, &invite)
+
+	// Nor join lists shared with them
+	api.request(http.MethodPost, "/lists/share/"+invite.Token, guestToken, nil).expectError(t, apierr.EmailNotVerified)
+	api.request(http.MethodPost, "/lists/share/"+invite.Token, "", nil).expectError(t, apierr.AuthRequired)
+
+	api.request(http.MethodGet, "/verify-email?token="+url.QueryEscape(guestLink), "", nil).expect(t, http.StatusOK)
+	api.request(http.MethodPost, "/lists/share/"+invite.Token, guestToken, nil).expect(t, http.StatusOK)
+}
+
+func TestPanicRecovery(t *testing.T) {
+	reporter := &testReporter{}
+	a := newTestApp()
+	a.ErrorReporters = []app.ErrorReporter{reporter}
+	a.Stores.Lists = panickingLists{ListStore: a.Stores.Lists}
+	api := startTestAPI(t, a)
+	token, _ := api.signUp("alice@example.com")
+
+	resp := api.request(http.MethodGet, "/lists", token, nil).expectError(t, apierr.Internal).
+		expectHeaders(t, "Content-Type", "application/problem+json")
+	if bytes.Contains(resp.body, []byte("corrupted")) {
+		t.Fatalf("response leaked the panic: %s", resp.body)
+	}
+
+	reporter.mu.Lock()
+	defer reporter.mu.Unlock()
+	if len(reporter.errors) != 1 || !errors.Is(reporter.errors[0], middleware.ErrPanic) ||
+		!strings.Contains(reporter.errors[0].Error(), "list index corrupted") || len(reporter.stacks[0]) == 0 {
+		t.Fatalf("reported %v, want the panic with its stack", reporter.errors)
+	}
+
+	// The server keeps serving
+	api.request(http.MethodGet, "/me", token, nil).expect(t, http.StatusOK)
+}
+
+func TestCORSFallbacks(t *testing.T) {
+	api := newTestAPI(t, func(cfg *config.Config) {
+		cfg.CORS.AllowedOrigins = []string{"https://grocer.me"}
+	})
+	origin := "https://grocer.me"
+
+	// Matched routes and preflights for any path get CORS headers
+	api.request(http.MethodGet, "/health", "", nil, "Origin", origin).expect(t, http.StatusOK).
+		expectHeaders(t, "Access-Control-Allow-Origin", origin)
+	api.request(http.MethodOptions, "/nothing", "", nil, "Origin", origin, "Access-Control-Request-Method", "POST").
+		expect(t, http.StatusNoContent).expectHeaders(t, "Access-Control-Allow-Origin", origin)
+
+	// The router's own 404 and 405 responses don't
+	api.request(http.MethodGet, "/nothing", "", nil, "Origin", origin).expectError(t, apierr.RouteNotFound).
+		expectHeaders(t, "Access-Control-Allow-Origin", "", "Access-Control-Expose-Headers", "")
+	api.request(http.MethodDelete, "/health", "", nil, "Origin", origin).expectError(t, apierr.MethodNotAllowed).
+		expectHeaders(t, "Access-Control-Allow-Origin", "", "Allow", "GET, HEAD, OPTIONS")
+}
+
+func TestCSRF(t *testing.T) {
+	api := newTestAPI(t)
+	bearer, _ := api.signUp("alice@example.com")
+	signin := func() (cookie, csrfToken string) {
+		cookie = "jwt_token=" + api.request(http.MethodPost, "/signin", "", map[string]string{"email": "alice@example.com", "password": "password123"}).
+			expect(t, http.StatusOK).cookie(t, "jwt_token")
+		var csrf models.CSRFTokenResponse
+		api.request(http.MethodGet, "/csrf-token", "", nil, "Cookie", cookie).expect(t, http.StatusOK).decode(t, &csrf)
+		return cookie, csrf.CSRFToken
+	}
+	cookie, csrfToken := signin()
+	_, otherSessionToken := signin()
+	if csrfToken == "" || csrfToken == otherSessionToken {
+		t.Fatalf("sessions got CSRF tokens %q and %q, want distinct tokens", csrfToken, otherSessionToken)
+	}
+
+	list := api.createList(bearer, "Groceries")
+	var invite models.InviteResponse
+	api.request(http.MethodPost, "/lists/"+list.ID+"/invites", bearer, map[string]string{}).
+		expect(t, http.StatusCreated).decode(t, &invite)
+
+	unsafe := []struct {
+		method, path string
+		body         interface{}
+	}{
+		{http.MethodPost, "/lists", map[string]string{"name": "Forged"}},
+		{http.MethodPut, "/lists/" + list.ID, map[string]string{"name": "Forged"}},
+		{http.MethodPost, "/lists/" + list.ID + "/items", map[string]string{"name": "Forged"}},
+		{http.MethodDelete, "/lists/" + list.ID, nil},
+		{http.MethodPost, "/lists/share/" + invite.Token, nil},
+		{http.MethodPost, "/logout/all", nil},
+	}
+
+	// Cookie-authenticated state changes need the session's own CSRF token
+	for _, req := range unsafe {
+		api.request(req.method, req.path, "", req.body, "Cookie", cookie).expectError(t, apierr.CSRFTokenInvalid)
+		api.request(req.method, req.path, "", req.body, "Cookie", cookie, "X-CSRF-Token", "forged").
+			expectError(t, apierr.CSRFTokenInvalid)
+		api.request(req.method, req.path, "", req.body, "Cookie", cookie, "X-CSRF-Token", otherSessionToken).
+			expectError(t, apierr.CSRFTokenInvalid)
+	}
+
+	var current models.ListResponse
+	api.request(http.MethodGet, "/lists/"+list.ID, "", nil, "Cookie", cookie).expect(t, http.StatusOK).decode(t, &current)
+	if current.Name != "Groceries" || len(current.Items) != 0 || current.Version != 1 {
+		t.Fatalf("refused requests changed the list: %+v", current)
+	}
+
+	api.request(http.MethodPut, "/lists/"+list.ID, "", map[string]string{"name": "Weekly shop"}, "Cookie", cookie, "X-CSRF-Token", csrfToken).
+		expect(t, http.StatusOK)
+
+	// Bearer tokens can't be sent by other sites, so they need no CSRF token
+	api.request(http.MethodPost, "/lists/"+list.ID+"/items", bearer, map[string]string{"name": "Milk"}).expect(t, http.StatusOK)
+	api.request(http.MethodPost, "/lists", bearer, map[string]string{"name": "Other"}, "Cookie", cookie).expect(t, http.StatusCreated)
+
+	api.request(http.MethodPost, "/logout", "", nil, "Cookie", cookie, "X-CSRF-Token", csrfToken).expect(t, http.StatusOK)
+}
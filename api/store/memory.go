@@ -0,0 +1,796 @@
+package store
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"bryce-stabenow/grocer-me/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MemoryListStore is an in-process ListStore for tests and local demos
+type MemoryListStore struct {
+	mu    sync.RWMutex
+	lists map[primitive.ObjectID]*models.List
+}
+
+// NewMemoryListStore creates an empty in-memory ListStore
+func NewMemoryListStore() *MemoryListStore {
+	return &MemoryListStore{lists: make(map[primitive.ObjectID]*models.List)}
+}
+
+// Create inserts a new list
+func (s *MemoryListStore) Create(ctx context.Context, list *models.List) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.lists[list.ID]; exists {
+		return ErrDuplicate
+	}
+	s.lists[list.ID] = copyList(list)
+	return nil
+}
+
+// Get retrieves a list by ID
+func (s *MemoryListStore) Get(ctx context.Context, id primitive.ObjectID) (*models.List, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list, ok := s.lists[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return copyList(list), nil
+}
+
+// ListForUser finds lists where the user is owner or collaborator
+func (s *MemoryListStore) ListForUser(ctx context.Context, userID primitive.ObjectID) ([]models.List, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	lists := []models.List{}
+	for _, list := range s.lists {
+		if _, ok := list.RoleOf(userID); ok {
+			lists = append(lists, *copyList(list))
+		}
+	}
+
+	// Sort by created_at descending
+	sort.Slice(lists, func(i, j int) bool {
+		return lists[i].CreatedAt.After(lists[j].CreatedAt)
+	})
+	return lists, nil
+}
+
+// Update changes a list's name and/or description
+func (s *MemoryListStore) Update(ctx context.Context, id primitive.ObjectID, version int64, update ListUpdate, now time.Time) (*models.List, error) {
+	return s.mutate(id, version, now, func(list *models.List) error {
+		if update.Name != nil {
+			list.Name = *update.Name
+		}
+		if update.Description != nil {
+			list.Description = *update.Description
+		}
+		return nil
+	})
+}
+
+// Delete removes a list
+func (s *MemoryListStore) Delete(ctx context.Context, id primitive.ObjectID, version int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list, ok := s.lists[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if list.Version != version {
+		return ErrVersionConflict
+	}
+	delete(s.lists, id)
+	return nil
+}
+
+// AddItem appends an item to a list
+func (s *MemoryListStore) AddItem(ctx context.Context, id primitive.ObjectID, version int64, item models.ListItem, now time.Time) (*models.List, error) {
+	return s.mutate(id, version, now, func(list *models.List) error {
+		list.Items = append(list.Items, item)
+		return nil
+	})
+}
+
+// UpdateItem changes a single item in place
+func (s *MemoryListStore) UpdateItem(ctx context.Context, id primitive.ObjectID, version int64, itemID primitive.ObjectID, update ItemUpdate, now time.Time) (*models.List, error) {
+	return s.mutate(id, version, now, func(list *models.List) error {
+		for i := range list.Items {
+			if list.Items[i].ID != itemID {
+				continue
+			}
+			item := &list.Items[i]
+			if update.Name != nil {
+				item.Name = *update.Name
+			}
+			if update.Quantity != nil {
+				item.Quantity = *update.Quantity
+			}
+			if update.Details != nil {
+				item.Details = *update.Details
+			}
+			if update.Checked != nil {
+				item.Checked = *update.Checked
+			}
+			return nil
+		}
+		return ErrNotFound
+	})
+}
+
+// DeleteItem removes an item from a list
+func (s *MemoryListStore) DeleteItem(ctx context.Context, id primitive.ObjectID, version int64, itemID primitive.ObjectID, now time.Time) (*models.List, error) {
+	return s.mutate(id, version, now, func(list *models.List) error {
+		for i := range list.Items {
+			if list.Items[i].ID == itemID {
+				list.Items = append(list.Items[:i], list.Items[i+1:]...)
+				return nil
+			}
+		}
+		return ErrNotFound
+	})
+}
+
+// AddCollaborator adds a user to a list's shared_with array
+func (s *MemoryListStore) AddCollaborator(ctx context.Context, id primitive.ObjectID, version int64, collaborator models.Collaborator, now time.Time) (*models.List, error) {
+	return s.mutate(id, version, now, func(list *models.List) error {
+		list.SharedWith = append(list.SharedWith, collaborator)
+		return nil
+	})
+}
+
+// UpdateCollaboratorRole changes a collaborator's role in place
+func (s *MemoryListStore) UpdateCollaboratorRole(ctx context.Context, id primitive.ObjectID, version int64, userID primitive.ObjectID, role models.Role, now time.Time) (*models.List, error) {
+	return s.mutate(id, version, now, func(list *models.List) error {
+		for i := range list.SharedWith {
+			if list.SharedWith[i].UserID == userID {
+				list.SharedWith[i].Role = role
+				return nil
+			}
+		}
+		return ErrNotFound
+	})
+}
+
+// RemoveCollaborator removes a user from a list's shared_with array
+func (s *MemoryListStore) RemoveCollaborator(ctx context.Context, id primitive.ObjectID, version int64, userID primitive.ObjectID, now time.Time) (*models.List, error) {
+	return s.mutate(id, version, now, func(list *models.List) error {
+		for i := range list.SharedWith {
+			if list.SharedWith[i].UserID == userID {
+				list.SharedWith = append(list.SharedWith[:i], list.SharedWith[i+1:]...)
+				return nil
+			}
+		}
+		return ErrNotFound
+	})
+}
+
+// TransferOwnership swaps the owner with a collaborator, putting the former
+// owner in the new owner's shared_with slot
+func (s *MemoryListStore) TransferOwnership(ctx context.Context, id primitive.ObjectID, version int64, from, to primitive.ObjectID, now time.Time) (*models.List, error) {
+	return s.mutate(id, version, now, func(list *models.List) error {
+		if list.UserID != from {
+			return ErrNotFound
+		}
+		for i := range list.SharedWith {
+			if list.SharedWith[i].UserID == to {
+				list.UserID = to
+				list.SharedWith[i] = models.Collaborator{UserID: from, Role: models.RoleEditor}
+				return nil
+			}
+		}
+		return ErrNotFound
+	})
+}
+
+// mutate applies fn to a copy of the stored list and commits it with a bumped
+// version, mirroring the guarded writes of the Mongo store
+func (s *MemoryListStore) mutate(id primitive.ObjectID, version int64, now time.Time, fn func(list *models.List) error) (*models.List, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.lists[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if stored.Version != version {
+		return nil, ErrVersionConflict
+	}
+
+	list := copyList(stored)
+	if err := fn(list); err != nil {
+		return nil, err
+	}
+	list.Version++
+	list.UpdatedAt = now
+
+	s.lists[id] = list
+	return copyList(list), nil
+}
+
+// MemoryUserStore is an in-process UserStore for tests and local demos
+type MemoryUserStore struct {
+	mu    sync.RWMutex
+	users map[primitive.ObjectID]*models.User
+}
+
+// NewMemoryUserStore creates an empty in-memory UserStore
+func NewMemoryUserStore() *MemoryUserStore {
+	return &MemoryUserStore{users: make(map[primitive.ObjectID]*models.User)}
+}
+
+// Create inserts a new user
+func (s *MemoryUserStore) Create(ctx context.Context, user *models.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, existing := range s.users {
+		if existing.Email == user.Email {
+			return ErrDuplicate
+		}
+	}
+	if _, exists := s.users[user.ID]; exists {
+		return ErrDuplicate
+	}
+
+	s.users[user.ID] = copyUser(user)
+	return nil
+}
+
+// GetByID retrieves a user by ID
+func (s *MemoryUserStore) GetByID(ctx context.Context, id primitive.ObjectID) (*models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, ok := s.users[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return copyUser(user), nil
+}
+
+// GetByEmail retrieves a user by email
+func (s *MemoryUserStore) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, user := range s.users {
+		if user.Email == email {
+			return copyUser(user), nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// GetByIDs returns the users that exist among ids
+func (s *MemoryUserStore) GetByIDs(ctx context.Context, ids []primitive.ObjectID) ([]models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	users := []models.User{}
+	for _, id := range ids {
+		if user, ok := s.users[id]; ok {
+			users = append(users, *copyUser(user))
+		}
+	}
+	return users, nil
+}
+
+// UpdatePassword replaces a user's password hash
+func (s *MemoryUserStore) UpdatePassword(ctx context.Context, id primitive.ObjectID, passwordHash string, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[id]
+	if !ok {
+		return ErrNotFound
+	}
+	user.PasswordHash = passwordHash
+	user.UpdatedAt = now
+	return nil
+}
+
+// MarkEmailVerified flags a user's email as verified
+func (s *MemoryUserStore) MarkEmailVerified(ctx context.Context, id primitive.ObjectID, email string, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[id]
+	if !ok || user.Email != email {
+		return ErrNotFound
+	}
+	verifiedAt := now
+	user.EmailVerified = true
+	user.EmailVerifiedAt = &verifiedAt
+	user.UpdatedAt = now
+	return nil
+}
+
+// MemoryInviteStore is an in-process InviteStore for tests and local demos
+type MemoryInviteStore struct {
+	mu      sync.Mutex
+	invites map[primitive.ObjectID]*models.Invite
+}
+
+// NewMemoryInviteStore creates an empty in-memory InviteStore
+func NewMemoryInviteStore() *MemoryInviteStore {
+	return &MemoryInviteStore{invites: make(map[primitive.ObjectID]*models.Invite)}
+}
+
+// Create inserts a new invite
+func (s *MemoryInviteStore) Create(ctx context.Context, invite *models.Invite) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, existing := range s.invites {
+		if existing.TokenHash == invite.TokenHash {
+			return ErrDuplicate
+		}
+	}
+	if _, exists := s.invites[invite.ID]; exists {
+		return ErrDuplicate
+	}
+
+	stored := *invite
+	s.invites[invite.ID] = &stored
+	return nil
+}
+
+// GetByTokenHash retrieves an invite by the hash of its token
+func (s *MemoryInviteStore) GetByTokenHash(ctx context.Context, tokenHash string) (*models.Invite, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, invite := range s.invites {
+		if invite.TokenHash == tokenHash {
+			found := *invite
+			return &found, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// ListActive finds a list's invites that can still be redeemed
+func (s *MemoryInviteStore) ListActive(ctx context.Context, listID primitive.ObjectID, now time.Time) ([]models.Invite, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	invites := []models.Invite{}
+	for _, invite := range s.invites {
+		if invite.ListID == listID && invite.IsUsable(now) {
+			invites = append(invites, *invite)
+		}
+	}
+
+	// Sort by created_at descending
+	sort.Slice(invites, func(i, j int) bool {
+		return invites[i].CreatedAt.After(invites[j].CreatedAt)
+	})
+	return invites, nil
+}
+
+// Redeem increments an invite's use count if it is still usable
+func (s *MemoryInviteStore) Redeem(ctx context.Context, id primitive.ObjectID, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	invite, ok := s.invites[id]
+	if !ok || !invite.IsUsable(now) {
+		return ErrNotFound
+	}
+	invite.Uses++
+	return nil
+}
+
+// Release decrements an invite's use count
+func (s *MemoryInviteStore) Release(ctx context.Context, id primitive.ObjectID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	invite, ok := s.invites[id]
+	if !ok || invite.Uses == 0 {
+		return ErrNotFound
+	}
+	invite.Uses--
+	return nil
+}
+
+// Revoke marks an invite as revoked
+func (s *MemoryInviteStore) Revoke(ctx context.Context, listID, id primitive.ObjectID, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	invite, ok := s.invites[id]
+	if !ok || invite.ListID != listID || invite.RevokedAt != nil {
+		return ErrNotFound
+	}
+	revokedAt := now
+	invite.RevokedAt = &revokedAt
+	return nil
+}
+
+// DeleteForList removes all invites for a list
+func (s *MemoryInviteStore) DeleteForList(ctx context.Context, listID primitive.ObjectID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, invite := range s.invites {
+		if invite.ListID == listID {
+			delete(s.invites, id)
+		}
+	}
+	return nil
+}
+
+// MemorySessionStore is an in-process SessionStore for tests and local demos
+type MemorySessionStore struct {
+	mu       sync.Mutex
+	sessions map[primitive.ObjectID]*models.Session
+}
+
+// NewMemorySessionStore creates an empty in-memory SessionStore
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{sessions: make(map[primitive.ObjectID]*models.Session)}
+}
+
+// Create inserts a new session
+func (s *MemorySessionStore) Create(ctx context.Context, session *models.Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.sessions[session.ID]; exists {
+		return ErrDuplicate
+	}
+	stored := *session
+	s.sessions[session.ID] = &stored
+	return nil
+}
+
+// Get retrieves a session by ID
+func (s *MemorySessionStore) Get(ctx context.Context, id primitive.ObjectID) (*models.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	found := *session
+	return &found, nil
+}
+
+// GetByRefreshTokenHash retrieves a session by the hash of its current or any rotated refresh token
+func (s *MemorySessionStore) GetByRefreshTokenHash(ctx context.Context, tokenHash string) (*models.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, session := range s.sessions {
+		if session.RefreshTokenHash == tokenHash || slices.Contains(session.PreviousTokenHashes, tokenHash) {
+			found := *session
+			return &found, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// Rotate swaps in a new refresh token and extends the session
+func (s *MemorySessionStore) Rotate(ctx context.Context, id primitive.ObjectID, oldHash, newHash string, now, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[id]
+	if !ok || session.RefreshTokenHash != oldHash || !session.IsActive(now) {
+		return ErrNotFound
+	}
+	session.PreviousTokenHashes = append(session.PreviousTokenHashes, oldHash)
+	session.RefreshTokenHash = newHash
+	session.LastUsedAt = now
+	session.ExpiresAt = expiresAt
+	return nil
+}
+
+// Revoke marks a session as revoked
+func (s *MemorySessionStore) Revoke(ctx context.Context, id primitive.ObjectID, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[id]
+	if !ok || session.RevokedAt != nil {
+		return ErrNotFound
+	}
+	revokedAt := now
+	session.RevokedAt = &revokedAt
+	return nil
+}
+
+// RevokeAllForUser marks all of a user's sessions as revoked
+func (s *MemorySessionStore) RevokeAllForUser(ctx context.Context, userID primitive.ObjectID, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, session := range s.sessions {
+		if session.UserID == userID && session.RevokedAt == nil {
+			revokedAt := now
+			session.RevokedAt = &revokedAt
+		}
+	}
+	return nil
+}
+
+// MemoryPasswordResetStore is an in-process PasswordResetStore for tests and local demos
+type MemoryPasswordResetStore struct {
+	mu     sync.Mutex
+	resets map[primitive.ObjectID]*models.PasswordReset
+}
+
+// NewMemoryPasswordResetStore creates an empty in-memory PasswordResetStore
+func NewMemoryPasswordResetStore() *MemoryPasswordResetStore {
+	return &MemoryPasswordResetStore{resets: make(map[primitive.ObjectID]*models.PasswordReset)}
+}
+
+// Create inserts a new reset token
+func (s *MemoryPasswordResetStore) Create(ctx context.Context, reset *models.PasswordReset) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, existing := range s.resets {
+		if existing.TokenHash == reset.TokenHash {
+			return ErrDuplicate
+		}
+	}
+	stored := *reset
+	s.resets[reset.ID] = &stored
+	return nil
+}
+
+// Consume marks a usable reset token as used
+func (s *MemoryPasswordResetStore) Consume(ctx context.Context, tokenHash string, now time.Time) (*models.PasswordReset, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, reset := range s.resets {
+		if reset.TokenHash == tokenHash && reset.IsUsable(now) {
+			usedAt := now
+			reset.UsedAt = &usedAt
+			consumed := *reset
+			return &consumed, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// LatestUsable returns a user's newest usable reset token
+func (s *MemoryPasswordResetStore) LatestUsable(ctx context.Context, userID primitive.ObjectID, now time.Time) (*models.PasswordReset, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var latest *models.PasswordReset
+	for _, reset := range s.resets {
+		if reset.UserID == userID && reset.IsUsable(now) && (latest == nil || reset.CreatedAt.After(latest.CreatedAt)) {
+			latest = reset
+		}
+	}
+	if latest == nil {
+		return nil, ErrNotFound
+	}
+	found := *latest
+	return &found, nil
+}
+
+// InvalidateForUser marks all of a user's outstanding reset tokens as used
+func (s *MemoryPasswordResetStore) InvalidateForUser(ctx context.Context, userID primitive.ObjectID, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, reset := range s.resets {
+		if reset.UserID == userID && reset.UsedAt == nil {
+			usedAt := now
+			reset.UsedAt = &usedAt
+		}
+	}
+	return nil
+}
+
+// MemoryEmailVerificationStore is an in-process EmailVerificationStore for tests and local demos
+type MemoryEmailVerificationStore struct {
+	mu            sync.Mutex
+	verifications map[primitive.ObjectID]*models.EmailVerification
+}
+
+// NewMemoryEmailVerificationStore creates an empty in-memory EmailVerificationStore
+func NewMemoryEmailVerificationStore() *MemoryEmailVerificationStore {
+	return &MemoryEmailVerificationStore{verifications: make(map[primitive.ObjectID]*models.EmailVerification)}
+}
+
+// Create inserts a new verification token
+func (s *MemoryEmailVerificationStore) Create(ctx context.Context, verification *models.EmailVerification) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, existing := range s.verifications {
+		if existing.TokenHash == verification.TokenHash {
+			return ErrDuplicate
+		}
+	}
+	stored := *verification
+	s.verifications[verification.ID] = &stored
+	return nil
+}
+
+// Consume marks a usable verification token as used
+func (s *MemoryEmailVerificationStore) Consume(ctx context.Context, tokenHash string, now time.Time) (*models.EmailVerification, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, verification := range s.verifications {
+		if verification.TokenHash == tokenHash && verification.UsedAt == nil && now.Before(verification.ExpiresAt) {
+			usedAt := now
+			verification.UsedAt = &usedAt
+			consumed := *verification
+			return &consumed, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// InvalidateForUser marks all of a user's outstanding verification tokens as used
+func (s *MemoryEmailVerificationStore) InvalidateForUser(ctx context.Context, userID primitive.ObjectID, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, verification := range s.verifications {
+		if verification.UserID == userID && verification.UsedAt == nil {
+			usedAt := now
+			verification.UsedAt = &usedAt
+		}
+	}
+	return nil
+}
+
+// rateLimitSweepInterval is how often the memory rate limit store drops
+// entries that have expired
+const rateLimitSweepInterval = time.Minute
+
+// MemoryRateLimitStore is an in-process RateLimitStore. Limits are per
+// process, so each instance of a multi-instance deployment enforces its own.
+type MemoryRateLimitStore struct {
+	mu        sync.Mutex
+	buckets   map[string]memoryBucket
+	failures  map[string]memoryFailures
+	nextSweep time.Time
+}
+
+type memoryBucket struct {
+	tokens    float64
+	updatedAt time.Time
+	expiresAt time.Time // When the bucket is full again and can be forgotten
+}
+
+type memoryFailures struct {
+	count       int
+	lockedUntil time.Time
+	expiresAt   time.Time
+}
+
+// NewMemoryRateLimitStore creates an empty in-memory RateLimitStore
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{
+		buckets:  make(map[string]memoryBucket),
+		failures: make(map[string]memoryFailures),
+	}
+}
+
+// Take removes a token from key's bucket if one is available
+func (s *MemoryRateLimitStore) Take(ctx context.Context, key string, limit RateLimit, now time.Time) (bool, float64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sweep(now)
+
+	capacity := float64(limit.Requests)
+	tokens := capacity
+	if bucket, ok := s.buckets[key]; ok {
+		tokens = min(capacity, bucket.tokens+limit.refill(max(0, now.Sub(bucket.updatedAt))))
+	}
+
+	allowed := tokens >= 1
+	if allowed {
+		tokens--
+	}
+	s.buckets[key] = memoryBucket{tokens: tokens, updatedAt: now, expiresAt: now.Add(limit.Per)}
+	return allowed, tokens, nil
+}
+
+// RecordFailure counts a failed attempt and locks key out once the policy says so
+func (s *MemoryRateLimitStore) RecordFailure(ctx context.Context, key string, policy LockoutPolicy, now time.Time) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sweep(now)
+
+	failures := s.failures[key]
+	if !failures.expiresAt.After(now) {
+		failures = memoryFailures{}
+	}
+	failures.count++
+	if d := policy.Duration(failures.count); d > 0 {
+		failures.lockedUntil = now.Add(d)
+	}
+	failures.expiresAt = now.Add(policy.Window)
+	if failures.lockedUntil.After(failures.expiresAt) {
+		failures.expiresAt = failures.lockedUntil
+	}
+	s.failures[key] = failures
+	return failures.lockedUntil, nil
+}
+
+// LockedUntil returns when key's lockout ends
+func (s *MemoryRateLimitStore) LockedUntil(ctx context.Context, key string, now time.Time) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	failures, ok := s.failures[key]
+	if !ok || !failures.lockedUntil.After(now) {
+		return time.Time{}, nil
+	}
+	return failures.lockedUntil, nil
+}
+
+// ResetFailures forgets key's failed attempts
+func (s *MemoryRateLimitStore) ResetFailures(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.failures, key)
+	return nil
+}
+
+// sweep drops expired entries so the maps don't grow without bound. The
+// caller must hold s.mu.
+func (s *MemoryRateLimitStore) sweep(now time.Time) {
+	if now.Before(s.nextSweep) {
+		return
+	}
+	for key, bucket := range s.buckets {
+		if !bucket.expiresAt.After(now) {
+			delete(s.buckets, key)
+		}
+	}
+	for key, failures := range s.failures {
+		if !failures.expiresAt.After(now) {
+			delete(s.failures, key)
+		}
+	}
+	s.nextSweep = now.Add(rateLimitSweepInterval)
+}
+
+// copyList returns a deep copy so callers never share slices with the store
+func copyList(list *models.List) *models.List {
+	copied := *list
+	copied.Items = append([]models.ListItem{}, list.Items...)
+	copied.SharedWith = append([]models.Collaborator{}, list.SharedWith...)
+	return &copied
+}
+
+// copyUser returns a copy that does not share its pointers with the store
+func copyUser(user *models.User) *models.User {
+	copied := *user
+	if user.Profile != nil {
+		profile := *user.Profile
+		copied.Profile = &profile
+	}
+	if user.EmailVerifiedAt != nil {
+		verifiedAt := *user.EmailVerifiedAt
+		copied.EmailVerifiedAt = &verifiedAt
+	}
+	return &copied
+}
@@ -0,0 +1,760 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"bryce-stabenow/grocer-me/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// NewMongoStores creates stores backed by the given database
+func NewMongoStores(db *mongo.Database) Stores {
+	return Stores{
+		Lists:         NewMongoListStore(db),
+		Users:         NewMongoUserStore(db),
+		Invites:       NewMongoInviteStore(db),
+		Sessions:      NewMongoSessionStore(db),
+		Resets:        NewMongoPasswordResetStore(db),
+		Verifications: NewMongoEmailVerificationStore(db),
+		RateLimits:    NewMongoRateLimitStore(db),
+	}
+}
+
+// MongoListStore is a ListStore backed by the "lists" collection
+type MongoListStore struct {
+	collection *mongo.Collection
+}
+
+// NewMongoListStore creates a ListStore using the given database
+func NewMongoListStore(db *mongo.Database) *MongoListStore {
+	return &MongoListStore{collection: db.Collection("lists")}
+}
+
+// Create inserts a new list
+func (s *MongoListStore) Create(ctx context.Context, list *models.List) error {
+	_, err := s.collection.InsertOne(ctx, list)
+	return err
+}
+
+// Get retrieves a list by ID
+func (s *MongoListStore) Get(ctx context.Context, id primitive.ObjectID) (*models.List, error) {
+	var list models.List
+	err := s.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&list)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &list, nil
+}
+
+// ListForUser finds lists where the user is owner or in the shared_with array
+func (s *MongoListStore) ListForUser(ctx context.Context, userID primitive.ObjectID) ([]models.List, error) {
+	filter := bson.M{
+		"$or": []bson.M{
+			{"user_id": userID},
+			{"shared_with.user_id": userID},
+		},
+	}
+
+	// Sort by created_at descending
+	opts := options.Find().SetSort(bson.M{"created_at": -1})
+
+	cursor, err := s.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	lists := []models.List{}
+	if err := cursor.All(ctx, &lists); err != nil {
+		return nil, err
+	}
+	return lists, nil
+}
+
+// Update changes a list's name and/or description
+func (s *MongoListStore) Update(ctx context.Context, id primitive.ObjectID, version int64, update ListUpdate, now time.Time) (*models.List, error) {
+	set := bson.M{"updated_at": now}
+	if update.Name != nil {
+		set["name"] = *update.Name
+	}
+	if update.Description != nil {
+		set["description"] = *update.Description
+	}
+
+	return s.findOneAndUpdate(ctx, id, version, bson.M{"_id": id, "version": version}, bson.M{"$set": set})
+}
+
+// Delete removes a list
+func (s *MongoListStore) Delete(ctx context.Context, id primitive.ObjectID, version int64) error {
+	result, err := s.collection.DeleteOne(ctx, bson.M{"_id": id, "version": version})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return s.missOrConflict(ctx, id, version)
+	}
+	return nil
+}
+
+// AddItem appends an item to a list
+func (s *MongoListStore) AddItem(ctx context.Context, id primitive.ObjectID, version int64, item models.ListItem, now time.Time) (*models.List, error) {
+	update := bson.M{
+		"$push": bson.M{"items": item},
+		"$set":  bson.M{"updated_at": now},
+	}
+	return s.findOneAndUpdate(ctx, id, version, bson.M{"_id": id, "version": version}, update)
+}
+
+// UpdateItem changes a single item in place using the positional operator
+func (s *MongoListStore) UpdateItem(ctx context.Context, id primitive.ObjectID, version int64, itemID primitive.ObjectID, update ItemUpdate, now time.Time) (*models.List, error) {
+	set := bson.M{"updated_at": now}
+	if update.Name != nil {
+		set["items.$.name"] = *update.Name
+	}
+	if update.Quantity != nil {
+		set["items.$.quantity"] = *update.Quantity
+	}
+	if update.Details != nil {
+		set["items.$.details"] = *update.Details
+	}
+	if update.Checked != nil {
+		set["items.$.checked"] = *update.Checked
+	}
+
+	filter := bson.M{"_id": id, "version": version, "items._id": itemID}
+	return s.findOneAndUpdate(ctx, id, version, filter, bson.M{"$set": set})
+}
+
+// DeleteItem pulls an item out of a list's items array
+func (s *MongoListStore) DeleteItem(ctx context.Context, id primitive.ObjectID, version int64, itemID primitive.ObjectID, now time.Time) (*models.List, error) {
+	update := bson.M{
+		"$pull": bson.M{"items": bson.M{"_id": itemID}},
+		"$set":  bson.M{"updated_at": now},
+	}
+
+	filter := bson.M{"_id": id, "version": version, "items._id": itemID}
+	return s.findOneAndUpdate(ctx, id, version, filter, update)
+}
+
+// AddCollaborator adds a user to a list's shared_with array
+func (s *MongoListStore) AddCollaborator(ctx context.Context, id primitive.ObjectID, version int64, collaborator models.Collaborator, now time.Time) (*models.List, error) {
+	update := bson.M{
+		"$push": bson.M{"shared_with": collaborator},
+		"$set":  bson.M{"updated_at": now},
+	}
+
+	// The version guard ensures the user wasn't added since the caller checked
+	return s.findOneAndUpdate(ctx, id, version, bson.M{"_id": id, "version": version}, update)
+}
+
+// UpdateCollaboratorRole changes a collaborator's role in place
+func (s *MongoListStore) UpdateCollaboratorRole(ctx context.Context, id primitive.ObjectID, version int64, userID primitive.ObjectID, role models.Role, now time.Time) (*models.List, error) {
+	update := bson.M{
+		"$set": bson.M{
+			"shared_with.$.role": role,
+			"updated_at":         now,
+		},
+	}
+
+	filter := bson.M{"_id": id, "version": version, "shared_with.user_id": userID}
+	return s.findOneAndUpdate(ctx, id, version, filter, update)
+}
+
+// RemoveCollaborator pulls a user out of a list's shared_with array
+func (s *MongoListStore) RemoveCollaborator(ctx context.Context, id primitive.ObjectID, version int64, userID primitive.ObjectID, now time.Time) (*models.List, error) {
+	update := bson.M{
+		"$pull": bson.M{"shared_with": bson.M{"user_id": userID}},
+		"$set":  bson.M{"updated_at": now},
+	}
+
+	filter := bson.M{"_id": id, "version": version, "shared_with.user_id": userID}
+	return s.findOneAndUpdate(ctx, id, version, filter, update)
+}
+
+// TransferOwnership swaps the owner with a collaborator, putting the former
+// owner in the new owner's shared_with slot
+func (s *MongoListStore) TransferOwnership(ctx context.Context, id primitive.ObjectID, version int64, from, to primitive.ObjectID, now time.Time) (*models.List, error) {
+	update := bson.M{
+		"$set": bson.M{
+			"user_id":       to,
+			"shared_with.$": models.Collaborator{UserID: from, Role: models.RoleEditor},
+			"updated_at":    now,
+		},
+	}
+
+	filter := bson.M{"_id": id, "version": version, "user_id": from, "shared_with.user_id": to}
+	return s.findOneAndUpdate(ctx, id, version, filter, update)
+}
+
+// findOneAndUpdate applies update to the document matching filter, bumps its
+// version and returns the updated list
+func (s *MongoListStore) findOneAndUpdate(ctx context.Context, id primitive.ObjectID, version int64, filter, update bson.M) (*models.List, error) {
+	update["$inc"] = bson.M{"version": 1}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var list models.List
+	err := s.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&list)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, s.missOrConflict(ctx, id, version)
+		}
+		return nil, err
+	}
+	return &list, nil
+}
+
+// missOrConflict works out why a guarded write matched nothing
+func (s *MongoListStore) missOrConflict(ctx context.Context, id primitive.ObjectID, version int64) error {
+	list, err := s.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if list.Version != version {
+		return ErrVersionConflict
+	}
+	// The list is unchanged, so the targeted item or collaborator must not exist
+	return ErrNotFound
+}
+
+// MongoUserStore is a UserStore backed by the "users" collection
+type MongoUserStore struct {
+	collection *mongo.Collection
+}
+
+// NewMongoUserStore creates a UserStore using the given database
+func NewMongoUserStore(db *mongo.Database) *MongoUserStore {
+	return &MongoUserStore{collection: db.Collection("users")}
+}
+
+// Create inserts a new user
+func (s *MongoUserStore) Create(ctx context.Context, user *models.User) error {
+	_, err := s.collection.InsertOne(ctx, user)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicate
+	}
+	return err
+}
+
+// GetByID retrieves a user by ID
+func (s *MongoUserStore) GetByID(ctx context.Context, id primitive.ObjectID) (*models.User, error) {
+	return s.findOne(ctx, bson.M{"_id": id})
+}
+
+// GetByEmail retrieves a user by email
+func (s *MongoUserStore) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	return s.findOne(ctx, bson.M{"email": email})
+}
+
+// GetByIDs fetches all matching users in a single query
+func (s *MongoUserStore) GetByIDs(ctx context.Context, ids []primitive.ObjectID) ([]models.User, error) {
+	cursor, err := s.collection.Find(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	users := []models.User{}
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// UpdatePassword replaces a user's password hash
+func (s *MongoUserStore) UpdatePassword(ctx context.Context, id primitive.ObjectID, passwordHash string, now time.Time) error {
+	result, err := s.collection.UpdateOne(
+		ctx,
+		bson.M{"_id": id},
+		bson.M{"$set": bson.M{"password_hash": passwordHash, "updated_at": now}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// MarkEmailVerified flags a user's email as verified
+func (s *MongoUserStore) MarkEmailVerified(ctx context.Context, id primitive.ObjectID, email string, now time.Time) error {
+	result, err := s.collection.UpdateOne(
+		ctx,
+		bson.M{"_id": id, "email": email},
+		bson.M{"$set": bson.M{"email_verified": true, "email_verified_at": now, "updated_at": now}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *MongoUserStore) findOne(ctx context.Context, filter bson.M) (*models.User, error) {
+	var user models.User
+	err := s.collection.FindOne(ctx, filter).Decode(&user)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
+// MongoInviteStore is an InviteStore backed by the "invites" collection
+type MongoInviteStore struct {
+	collection *mongo.Collection
+}
+
+// NewMongoInviteStore creates an InviteStore using the given database
+func NewMongoInviteStore(db *mongo.Database) *MongoInviteStore {
+	return &MongoInviteStore{collection: db.Collection("invites")}
+}
+
+// Create inserts a new invite
+func (s *MongoInviteStore) Create(ctx context.Context, invite *models.Invite) error {
+	_, err := s.collection.InsertOne(ctx, invite)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicate
+	}
+	return err
+}
+
+// GetByTokenHash retrieves an invite by the hash of its token
+func (s *MongoInviteStore) GetByTokenHash(ctx context.Context, tokenHash string) (*models.Invite, error) {
+	var invite models.Invite
+	err := s.collection.FindOne(ctx, bson.M{"token_hash": tokenHash}).Decode(&invite)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &invite, nil
+}
+
+// ListActive finds a list's unrevoked, unexpired invites with uses remaining
+func (s *MongoInviteStore) ListActive(ctx context.Context, listID primitive.ObjectID, now time.Time) ([]models.Invite, error) {
+	filter := usableInviteFilter(now)
+	filter["list_id"] = listID
+
+	opts := options.Find().SetSort(bson.M{"created_at": -1})
+	cursor, err := s.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	invites := []models.Invite{}
+	if err := cursor.All(ctx, &invites); err != nil {
+		return nil, err
+	}
+	return invites, nil
+}
+
+// Redeem increments an invite's use count if it is still usable
+func (s *MongoInviteStore) Redeem(ctx context.Context, id primitive.ObjectID, now time.Time) error {
+	filter := usableInviteFilter(now)
+	filter["_id"] = id
+
+	result, err := s.collection.UpdateOne(ctx, filter, bson.M{"$inc": bson.M{"uses": 1}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Release decrements an invite's use count
+func (s *MongoInviteStore) Release(ctx context.Context, id primitive.ObjectID) error {
+	result, err := s.collection.UpdateOne(
+		ctx,
+		bson.M{"_id": id, "uses": bson.M{"$gt": 0}},
+		bson.M{"$inc": bson.M{"uses": -1}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Revoke marks an invite as revoked
+func (s *MongoInviteStore) Revoke(ctx context.Context, listID, id primitive.ObjectID, now time.Time) error {
+	result, err := s.collection.UpdateOne(
+		ctx,
+		bson.M{"_id": id, "list_id": listID, "revoked_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"revoked_at": now}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// DeleteForList removes all invites for a list
+func (s *MongoInviteStore) DeleteForList(ctx context.Context, listID primitive.ObjectID) error {
+	_, err := s.collection.DeleteMany(ctx, bson.M{"list_id": listID})
+	return err
+}
+
+// usableInviteFilter matches invites that can still be redeemed at now
+func usableInviteFilter(now time.Time) bson.M {
+	return bson.M{
+		"revoked_at": bson.M{"$exists": false},
+		"expires_at": bson.M{"$gt": now},
+		"$or": []bson.M{
+			{"max_uses": 0},
+			{"$expr": bson.M{"$lt": bson.A{"$uses", "$max_uses"}}},
+		},
+	}
+}
+
+// MongoSessionStore is a SessionStore backed by the "sessions" collection
+type MongoSessionStore struct {
+	collection *mongo.Collection
+}
+
+// NewMongoSessionStore creates a SessionStore using the given database
+func NewMongoSessionStore(db *mongo.Database) *MongoSessionStore {
+	return &MongoSessionStore{collection: db.Collection("sessions")}
+}
+
+// Create inserts a new session
+func (s *MongoSessionStore) Create(ctx context.Context, session *models.Session) error {
+	_, err := s.collection.InsertOne(ctx, session)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicate
+	}
+	return err
+}
+
+// Get retrieves a session by ID
+func (s *MongoSessionStore) Get(ctx context.Context, id primitive.ObjectID) (*models.Session, error) {
+	return s.findOne(ctx, bson.M{"_id": id})
+}
+
+// GetByRefreshTokenHash retrieves a session by the hash of its current or any rotated refresh token
+func (s *MongoSessionStore) GetByRefreshTokenHash(ctx context.Context, tokenHash string) (*models.Session, error) {
+	return s.findOne(ctx, bson.M{
+		"$or": []bson.M{
+			{"refresh_token_hash": tokenHash},
+			{"previous_token_hashes": tokenHash},
+		},
+	})
+}
+
+// Rotate swaps in a new refresh token and extends the session
+func (s *MongoSessionStore) Rotate(ctx context.Context, id primitive.ObjectID, oldHash, newHash string, now, expiresAt time.Time) error {
+	filter := bson.M{
+		"_id":                id,
+		"refresh_token_hash": oldHash,
+		"revoked_at":         bson.M{"$exists": false},
+		"expires_at":         bson.M{"$gt": now},
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"refresh_token_hash": newHash,
+			"last_used_at":       now,
+			"expires_at":         expiresAt,
+		},
+		"$push": bson.M{"previous_token_hashes": oldHash},
+	}
+
+	result, err := s.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Revoke marks a session as revoked
+func (s *MongoSessionStore) Revoke(ctx context.Context, id primitive.ObjectID, now time.Time) error {
+	result, err := s.collection.UpdateOne(
+		ctx,
+		bson.M{"_id": id, "revoked_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"revoked_at": now}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// RevokeAllForUser marks all of a user's sessions as revoked
+func (s *MongoSessionStore) RevokeAllForUser(ctx context.Context, userID primitive.ObjectID, now time.Time) error {
+	_, err := s.collection.UpdateMany(
+		ctx,
+		bson.M{"user_id": userID, "revoked_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"revoked_at": now}},
+	)
+	return err
+}
+
+func (s *MongoSessionStore) findOne(ctx context.Context, filter bson.M) (*models.Session, error) {
+	var session models.Session
+	err := s.collection.FindOne(ctx, filter).Decode(&session)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &session, nil
+}
+
+// MongoPasswordResetStore is a PasswordResetStore backed by the "password_resets" collection
+type MongoPasswordResetStore struct {
+	collection *mongo.Collection
+}
+
+// NewMongoPasswordResetStore creates a PasswordResetStore using the given database
+func NewMongoPasswordResetStore(db *mongo.Database) *MongoPasswordResetStore {
+	return &MongoPasswordResetStore{collection: db.Collection("password_resets")}
+}
+
+// Create inserts a new reset token
+func (s *MongoPasswordResetStore) Create(ctx context.Context, reset *models.PasswordReset) error {
+	_, err := s.collection.InsertOne(ctx, reset)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicate
+	}
+	return err
+}
+
+// Consume marks a usable reset token as used
+func (s *MongoPasswordResetStore) Consume(ctx context.Context, tokenHash string, now time.Time) (*models.PasswordReset, error) {
+	filter := bson.M{
+		"token_hash": tokenHash,
+		"used_at":    bson.M{"$exists": false},
+		"expires_at": bson.M{"$gt": now},
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var reset models.PasswordReset
+	err := s.collection.FindOneAndUpdate(ctx, filter, bson.M{"$set": bson.M{"used_at": now}}, opts).Decode(&reset)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &reset, nil
+}
+
+// LatestUsable returns a user's newest usable reset token
+func (s *MongoPasswordResetStore) LatestUsable(ctx context.Context, userID primitive.ObjectID, now time.Time) (*models.PasswordReset, error) {
+	filter := bson.M{
+		"user_id":    userID,
+		"used_at":    bson.M{"$exists": false},
+		"expires_at": bson.M{"$gt": now},
+	}
+	opts := options.FindOne().SetSort(bson.M{"created_at": -1})
+
+	var reset models.PasswordReset
+	err := s.collection.FindOne(ctx, filter, opts).Decode(&reset)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &reset, nil
+}
+
+// InvalidateForUser marks all of a user's outstanding reset tokens as used
+func (s *MongoPasswordResetStore) InvalidateForUser(ctx context.Context, userID primitive.ObjectID, now time.Time) error {
+	_, err := s.collection.UpdateMany(
+		ctx,
+		bson.M{"user_id": userID, "used_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"used_at": now}},
+	)
+	return err
+}
+
+// MongoEmailVerificationStore is an EmailVerificationStore backed by the "email_verifications" collection
+type MongoEmailVerificationStore struct {
+	collection *mongo.Collection
+}
+
+// NewMongoEmailVerificationStore creates an EmailVerificationStore using the given database
+func NewMongoEmailVerificationStore(db *mongo.Database) *MongoEmailVerificationStore {
+	return &MongoEmailVerificationStore{collection: db.Collection("email_verifications")}
+}
+
+// Create inserts a new verification token
+func (s *MongoEmailVerificationStore) Create(ctx context.Context, verification *models.EmailVerification) error {
+	_, err := s.collection.InsertOne(ctx, verification)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicate
+	}
+	return err
+}
+
+// Consume marks a usable verification token as used
+func (s *MongoEmailVerificationStore) Consume(ctx context.Context, tokenHash string, now time.Time) (*models.EmailVerification, error) {
+	filter := bson.M{
+		"token_hash": tokenHash,
+		"used_at":    bson.M{"$exists": false},
+		"expires_at": bson.M{"$gt": now},
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var verification models.EmailVerification
+	err := s.collection.FindOneAndUpdate(ctx, filter, bson.M{"$set": bson.M{"used_at": now}}, opts).Decode(&verification)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &verification, nil
+}
+
+// InvalidateForUser marks all of a user's outstanding verification tokens as used
+func (s *MongoEmailVerificationStore) InvalidateForUser(ctx context.Context, userID primitive.ObjectID, now time.Time) error {
+	_, err := s.collection.UpdateMany(
+		ctx,
+		bson.M{"user_id": userID, "used_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"used_at": now}},
+	)
+	return err
+}
+
+// MongoRateLimitStore is a RateLimitStore backed by the "rate_limit_buckets"
+// and "lockouts" collections, so limits hold across every instance sharing
+// the database. Both expire through TTL indexes on expires_at.
+type MongoRateLimitStore struct {
+	buckets  *mongo.Collection
+	lockouts *mongo.Collection
+}
+
+// NewMongoRateLimitStore creates a MongoRateLimitStore using the given database
+func NewMongoRateLimitStore(db *mongo.Database) *MongoRateLimitStore {
+	return &MongoRateLimitStore{
+		buckets:  db.Collection("rate_limit_buckets"),
+		lockouts: db.Collection("lockouts"),
+	}
+}
+
+// Take refills and takes from key's bucket in a single atomic update
+func (s *MongoRateLimitStore) Take(ctx context.Context, key string, limit RateLimit, now time.Time) (bool, float64, error) {
+	capacity := float64(limit.Requests)
+	elapsed := bson.D{{Key: "$max", Value: bson.A{0, bson.D{{Key: "$subtract", Value: bson.A{now, bson.D{{Key: "$ifNull", Value: bson.A{"$updated_at", now}}}}}}}}}
+	refilled := bson.D{{Key: "$add", Value: bson.A{
+		bson.D{{Key: "$ifNull", Value: bson.A{"$tokens", capacity}}},
+		bson.D{{Key: "$multiply", Value: bson.A{elapsed, limit.refill(time.Millisecond)}}},
+	}}}
+	pipeline := mongo.Pipeline{
+		{{Key: "$set", Value: bson.D{{Key: "tokens", Value: bson.D{{Key: "$min", Value: bson.A{capacity, refilled}}}}}}},
+		{{Key: "$set", Value: bson.D{{Key: "allowed", Value: bson.D{{Key: "$gte", Value: bson.A{"$tokens", 1}}}}}}},
+		{{Key: "$set", Value: bson.D{
+			{Key: "tokens", Value: bson.D{{Key: "$cond", Value: bson.A{"$allowed", bson.D{{Key: "$subtract", Value: bson.A{"$tokens", 1}}}, "$tokens"}}}},
+			{Key: "updated_at", Value: now},
+			{Key: "expires_at", Value: now.Add(limit.Per)},
+		}}},
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	var bucket struct {
+		Tokens  float64 `bson:"tokens"`
+		Allowed bool    `bson:"allowed"`
+	}
+	err := s.buckets.FindOneAndUpdate(ctx, bson.M{"_id": key}, pipeline, opts).Decode(&bucket)
+	if mongo.IsDuplicateKeyError(err) {
+		// Another request created the bucket first; update the one it made
+		err = s.buckets.FindOneAndUpdate(ctx, bson.M{"_id": key}, pipeline, opts).Decode(&bucket)
+	}
+	if err != nil {
+		return false, 0, err
+	}
+	return bucket.Allowed, bucket.Tokens, nil
+}
+
+// RecordFailure counts a failed attempt and locks key out once the policy says so
+func (s *MongoRateLimitStore) RecordFailure(ctx context.Context, key string, policy LockoutPolicy, now time.Time) (time.Time, error) {
+	// Failures older than the window start the count again
+	pipeline := mongo.Pipeline{
+		{{Key: "$set", Value: bson.D{
+			{Key: "failures", Value: bson.D{{Key: "$cond", Value: bson.A{
+				bson.D{{Key: "$gt", Value: bson.A{"$expires_at", now}}},
+				bson.D{{Key: "$add", Value: bson.A{"$failures", 1}}},
+				1,
+			}}}},
+			{Key: "expires_at", Value: bson.D{{Key: "$max", Value: bson.A{"$expires_at", now.Add(policy.Window)}}}},
+		}}},
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	var lockout struct {
+		Failures int `bson:"failures"`
+	}
+	err := s.lockouts.FindOneAndUpdate(ctx, bson.M{"_id": key}, pipeline, opts).Decode(&lockout)
+	if mongo.IsDuplicateKeyError(err) {
+		err = s.lockouts.FindOneAndUpdate(ctx, bson.M{"_id": key}, pipeline, opts).Decode(&lockout)
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	d := policy.Duration(lockout.Failures)
+	if d == 0 {
+		return time.Time{}, nil
+	}
+	lockedUntil := now.Add(d)
+	_, err = s.lockouts.UpdateOne(
+		ctx,
+		bson.M{"_id": key},
+		bson.M{"$set": bson.M{"locked_until": lockedUntil}, "$max": bson.M{"expires_at": lockedUntil}},
+	)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return lockedUntil, nil
+}
+
+// LockedUntil returns when key's lockout ends
+func (s *MongoRateLimitStore) LockedUntil(ctx context.Context, key string, now time.Time) (time.Time, error) {
+	var lockout struct {
+		LockedUntil time.Time `bson:"locked_until"`
+	}
+	err := s.lockouts.FindOne(ctx, bson.M{"_id": key, "locked_until": bson.M{"$gt": now}}).Decode(&lockout)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return time.Time{}, nil
+		}
+		return time.Time{}, err
+	}
+	return lockout.LockedUntil, nil
+}
+
+// ResetFailures forgets key's failed attempts
+func (s *MongoRateLimitStore) ResetFailures(ctx context.Context, key string) error {
+	_, err := s.lockouts.DeleteOne(ctx, bson.M{"_id": key})
+	return err
+}
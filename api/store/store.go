@@ -0,0 +1,226 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"bryce-stabenow/grocer-me/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	// ErrNotFound is returned when a requested document (or list item) does not exist
+	ErrNotFound = errors.New("not found")
+	// ErrVersionConflict is returned when a write's expected list version is stale
+	ErrVersionConflict = errors.New("version conflict")
+	// ErrDuplicate is returned when a write would violate a uniqueness constraint
+	ErrDuplicate = errors.New("duplicate")
+)
+
+// ListUpdate holds the list fields to change; nil fields are left untouched
+type ListUpdate struct {
+	Name        *string
+	Description *string
+}
+
+// ItemUpdate holds the item fields to change; nil fields are left untouched
+type ItemUpdate struct {
+	Name     *string
+	Quantity *int
+	Details  *string
+	Checked  *bool
+}
+
+// ListStore persists lists and their items.
+//
+// Every mutating method takes the list version the caller last read. The write
+// only succeeds if the stored version still matches, in which case the version
+// is incremented, updated_at is set to now and the updated list is returned.
+// Otherwise ErrVersionConflict is returned (or ErrNotFound if the list or item
+// no longer exists).
+type ListStore interface {
+	Create(ctx context.Context, list *models.List) error
+	Get(ctx context.Context, id primitive.ObjectID) (*models.List, error)
+	// ListForUser returns lists owned by or shared with the user, newest first
+	ListForUser(ctx context.Context, userID primitive.ObjectID) ([]models.List, error)
+	Update(ctx context.Context, id primitive.ObjectID, version int64, update ListUpdate, now time.Time) (*models.List, error)
+	Delete(ctx context.Context, id primitive.ObjectID, version int64) error
+
+	AddItem(ctx context.Context, id primitive.ObjectID, version int64, item models.ListItem, now time.Time) (*models.List, error)
+	UpdateItem(ctx context.Context, id primitive.ObjectID, version int64, itemID primitive.ObjectID, update ItemUpdate, now time.Time) (*models.List, error)
+	DeleteItem(ctx context.Context, id primitive.ObjectID, version int64, itemID primitive.ObjectID, now time.Time) (*models.List, error)
+
+	AddCollaborator(ctx context.Context, id primitive.ObjectID, version int64, collaborator models.Collaborator, now time.Time) (*models.List, error)
+	UpdateCollaboratorRole(ctx context.Context, id primitive.ObjectID, version int64, userID primitive.ObjectID, role models.Role, now time.Time) (*models.List, error)
+	RemoveCollaborator(ctx context.Context, id primitive.ObjectID, version int64, userID primitive.ObjectID, now time.Time) (*models.List, error)
+	// TransferOwnership makes a collaborator the new owner; the former owner
+	// takes their place in shared_with as an editor
+	TransferOwnership(ctx context.Context, id primitive.ObjectID, version int64, from, to primitive.ObjectID, now time.Time) (*models.List, error)
+}
+
+// UserStore persists user accounts
+type UserStore interface {
+	// Create inserts a new user, returning ErrDuplicate if the email is taken
+	Create(ctx context.Context, user *models.User) error
+	GetByID(ctx context.Context, id primitive.ObjectID) (*models.User, error)
+	GetByEmail(ctx context.Context, email string) (*models.User, error)
+	// GetByIDs returns the users that exist among ids, in no particular order
+	GetByIDs(ctx context.Context, ids []primitive.ObjectID) ([]models.User, error)
+	UpdatePassword(ctx context.Context, id primitive.ObjectID, passwordHash string, now time.Time) error
+	// MarkEmailVerified flags a user's email as verified if it is still the given address
+	MarkEmailVerified(ctx context.Context, id primitive.ObjectID, email string, now time.Time) error
+}
+
+// InviteStore persists list invites
+type InviteStore interface {
+	Create(ctx context.Context, invite *models.Invite) error
+	GetByTokenHash(ctx context.Context, tokenHash string) (*models.Invite, error)
+	// ListActive returns a list's invites that can still be redeemed, newest first
+	ListActive(ctx context.Context, listID primitive.ObjectID, now time.Time) ([]models.Invite, error)
+	// Redeem atomically consumes one use, returning ErrNotFound if the invite is no longer usable
+	Redeem(ctx context.Context, id primitive.ObjectID, now time.Time) error
+	// Release gives back a use consumed by Redeem, returning ErrNotFound if none was used
+	Release(ctx context.Context, id primitive.ObjectID) error
+	// Revoke marks one of a list's invites as revoked
+	Revoke(ctx context.Context, listID, id primitive.ObjectID, now time.Time) error
+	// DeleteForList removes all invites for a list
+	DeleteForList(ctx context.Context, listID primitive.ObjectID) error
+}
+
+// SessionStore persists signed-in sessions and their refresh tokens
+type SessionStore interface {
+	Create(ctx context.Context, session *models.Session) error
+	Get(ctx context.Context, id primitive.ObjectID) (*models.Session, error)
+	// GetByRefreshTokenHash finds the session whose current or any rotated refresh token has the given hash
+	GetByRefreshTokenHash(ctx context.Context, tokenHash string) (*models.Session, error)
+	// Rotate replaces the refresh token if oldHash is still current and the
+	// session is active, returning ErrNotFound otherwise
+	Rotate(ctx context.Context, id primitive.ObjectID, oldHash, newHash string, now, expiresAt time.Time) error
+	// Revoke ends a session, returning ErrNotFound if it is missing or already revoked
+	Revoke(ctx context.Context, id primitive.ObjectID, now time.Time) error
+	// RevokeAllForUser ends every active session belonging to a user
+	RevokeAllForUser(ctx context.Context, userID primitive.ObjectID, now time.Time) error
+}
+
+// PasswordResetStore persists password reset tokens
+type PasswordResetStore interface {
+	Create(ctx context.Context, reset *models.PasswordReset) error
+	// Consume atomically marks an unused, unexpired token as used and returns
+	// it, returning ErrNotFound if there is no such token
+	Consume(ctx context.Context, tokenHash string, now time.Time) (*models.PasswordReset, error)
+	// LatestUsable returns a user's most recently created token that is still
+	// unused and unexpired, returning ErrNotFound if there is none
+	LatestUsable(ctx context.Context, userID primitive.ObjectID, now time.Time) (*models.PasswordReset, error)
+	// InvalidateForUser marks all of a user's outstanding tokens as used
+	InvalidateForUser(ctx context.Context, userID primitive.ObjectID, now time.Time) error
+}
+
+// EmailVerificationStore persists email verification tokens
+type EmailVerificationStore interface {
+	Create(ctx context.Context, verification *models.EmailVerification) error
+	// Consume atomically marks an unused, unexpired token as used and returns
+	// it, returning ErrNotFound if there is no such token
+	Consume(ctx context.Context, tokenHash string, now time.Time) (*models.EmailVerification, error)
+	// InvalidateForUser marks all of a user's outstanding tokens as used
+	InvalidateForUser(ctx context.Context, userID primitive.ObjectID, now time.Time) error
+}
+
+// RateLimit is a token bucket that allows bursts of up to Requests and
+// refills at Requests per Per
+type RateLimit struct {
+	Requests int
+	Per      time.Duration
+}
+
+// refill returns the tokens regained over elapsed
+func (l RateLimit) refill(elapsed time.Duration) float64 {
+	return float64(l.Requests) * float64(elapsed) / float64(l.Per)
+}
+
+// UnmarshalText parses a limit such as "20/1m" (20 requests a minute)
+func (l *RateLimit) UnmarshalText(text []byte) error {
+	requests, per, ok := strings.Cut(string(text), "/")
+	n, err := strconv.Atoi(requests)
+	d, durErr := time.ParseDuration(per)
+	if !ok || err != nil || durErr != nil || n <= 0 || d <= 0 {
+		return fmt.Errorf("must be a rate limit such as \"20/1m\", got %q", text)
+	}
+	*l = RateLimit{Requests: n, Per: d}
+	return nil
+}
+
+// MarshalText formats the limit the way UnmarshalText parses it
+func (l RateLimit) MarshalText() ([]byte, error) {
+	return []byte(strconv.Itoa(l.Requests) + "/" + l.Per.String()), nil
+}
+
+// Wait returns how long the bucket takes to regain the given number of tokens
+func (l RateLimit) Wait(tokens float64) time.Duration {
+	return time.Duration(tokens * float64(l.Per) / float64(l.Requests))
+}
+
+// LockoutPolicy decides how long repeated failures lock a key out
+type LockoutPolicy struct {
+	Threshold int           // Failures allowed before the first lockout
+	Base      time.Duration // First lockout, doubled for each further failure
+	Max       time.Duration // Longest lockout
+	Window    time.Duration // Failures are forgotten this long after the last one
+}
+
+// Duration returns how long a key with the given number of consecutive
+// failures is locked out, or 0 if it isn't
+func (p LockoutPolicy) Duration(failures int) time.Duration {
+	if failures < p.Threshold {
+		return 0
+	}
+	d := p.Base
+	for i := p.Threshold; i < failures && d < p.Max; i++ {
+		d *= 2
+	}
+	return min(d, p.Max)
+}
+
+// RateLimitStore tracks token buckets and failed attempts. Keys are opaque
+// strings chosen by the caller, such as "signin:ip:203.0.113.7".
+type RateLimitStore interface {
+	// Take refills key's bucket for the time since it was last used and
+	// removes a token if one is available, returning whether it did and how
+	// many tokens are left
+	Take(ctx context.Context, key string, limit RateLimit, now time.Time) (allowed bool, remaining float64, err error)
+	// RecordFailure counts a failed attempt against key and returns when the
+	// resulting lockout ends, or the zero time if key isn't locked out
+	RecordFailure(ctx context.Context, key string, policy LockoutPolicy, now time.Time) (time.Time, error)
+	// LockedUntil returns when key's lockout ends, or the zero time if it isn't locked out
+	LockedUntil(ctx context.Context, key string, now time.Time) (time.Time, error)
+	// ResetFailures forgets key's failed attempts and lifts any lockout
+	ResetFailures(ctx context.Context, key string) error
+}
+
+// Stores groups the stores used by the API
+type Stores struct {
+	Lists         ListStore
+	Users         UserStore
+	Invites       InviteStore
+	Sessions      SessionStore
+	Resets        PasswordResetStore
+	Verifications EmailVerificationStore
+	RateLimits    RateLimitStore
+}
+
+// NewMemoryStores creates empty in-memory stores for tests and local demos
+func NewMemoryStores() Stores {
+	return Stores{
+		Lists:         NewMemoryListStore(),
+		Users:         NewMemoryUserStore(),
+		Invites:       NewMemoryInviteStore(),
+		Sessions:      NewMemorySessionStore(),
+		Resets:        NewMemoryPasswordResetStore(),
+		Verifications: NewMemoryEmailVerificationStore(),
+		RateLimits:    NewMemoryRateLimitStore(),
+	}
+}
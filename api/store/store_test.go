@@ -0,0 +1,510 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"bryce-stabenow/grocer-me/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestMemoryStores(t *testing.T) {
+	testStores(t, func(t *testing.T) Stores { return NewMemoryStores() })
+}
+
+// testStores checks the behaviour every Stores implementation must share, so
+// the memory stores handlers are tested against can't drift from Mongo's
+func testStores(t *testing.T, newStores func(t *testing.T) Stores) {
+	t.Run("ListVersions", func(t *testing.T) { testListVersions(t, newStores(t).Lists) })
+	t.Run("ListItems", func(t *testing.T) { testListItems(t, newStores(t).Lists) })
+	t.Run("ListCollaborators", func(t *testing.T) { testListCollaborators(t, newStores(t).Lists) })
+	t.Run("ListForUser", func(t *testing.T) { testListForUser(t, newStores(t).Lists) })
+	t.Run("InviteRedeem", func(t *testing.T) { testInviteRedeem(t, newStores(t).Invites) })
+	t.Run("SessionRotate", func(t *testing.T) { testSessionRotate(t, newStores(t).Sessions) })
+	t.Run("PasswordResetLatestUsable", func(t *testing.T) { testPasswordResetLatestUsable(t, newStores(t).Resets) })
+	t.Run("RateLimits", func(t *testing.T) { testRateLimits(t, newStores(t).RateLimits) })
+}
+
+// testNow is a fixed time, truncated to the millisecond Mongo stores
+var testNow = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func newTestList(t *testing.T, lists ListStore, owner primitive.ObjectID, createdAt time.Time) *models.List {
+	t.Helper()
+
+	list := &models.List{
+		ID:         primitive.NewObjectID(),
+		UserID:     owner,
+		Name:       "Groceries",
+		Items:      []models.ListItem{},
+		SharedWith: []models.Collaborator{},
+		Version:    1,
+		CreatedAt:  createdAt,
+		UpdatedAt:  createdAt,
+	}
+	if err := lists.Create(context.Background(), list); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	return list
+}
+
+func wantErr(t *testing.T, op string, err, want error) {
+	t.Helper()
+	if !errors.Is(err, want) {
+		t.Fatalf("%s: got error %v, want %v", op, err, want)
+	}
+}
+
+func testListVersions(t *testing.T, lists ListStore) {
+	ctx := context.Background()
+	list := newTestList(t, lists, primitive.NewObjectID(), testNow)
+
+	name := "Hardware"
+	later := testNow.Add(time.Hour)
+	updated, err := lists.Update(ctx, list.ID, 1, ListUpdate{Name: &name}, later)
+	if err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if updated.Version != 2 || updated.Name != "Hardware" || !updated.UpdatedAt.Equal(later) {
+		t.Fatalf("Update returned version %d name %q updated at %s, want 2 %q %s", updated.Version, updated.Name, updated.UpdatedAt, name, later)
+	}
+
+	got, err := lists.Get(ctx, list.ID)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if got.Version != 2 || got.Name != "Hardware" || !got.UpdatedAt.Equal(later) {
+		t.Fatalf("Get returned version %d name %q updated at %s, want 2 %q %s", got.Version, got.Name, got.UpdatedAt, name, later)
+	}
+
+	// Writes against the old version conflict and change nothing
+	_, err = lists.Update(ctx, list.ID, 1, ListUpdate{Name: &name}, testNow)
+	wantErr(t, "Update with stale version", err, ErrVersionConflict)
+	wantErr(t, "Delete with stale version", lists.Delete(ctx, list.ID, 1), ErrVersionConflict)
+	if got, _ := lists.Get(ctx, list.ID); got.Version != 2 {
+		t.Fatalf("stale writes changed the version to %d", got.Version)
+	}
+
+	// Missing lists are not found whatever the version
+	missing := primitive.NewObjectID()
+	_, err = lists.Get(ctx, missing)
+	wantErr(t, "Get missing list", err, ErrNotFound)
+	_, err = lists.Update(ctx, missing, 1, ListUpdate{Name: &name}, testNow)
+	wantErr(t, "Update missing list", err, ErrNotFound)
+
+	if err := lists.Delete(ctx, list.ID, 2); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	_, err = lists.Get(ctx, list.ID)
+	wantErr(t, "Get deleted list", err, ErrNotFound)
+	wantErr(t, "Delete deleted list", lists.Delete(ctx, list.ID, 2), ErrNotFound)
+}
+
+func testListItems(t *testing.T, lists ListStore) {
+	ctx := context.Background()
+	list := newTestList(t, lists, primitive.NewObjectID(), testNow)
+
+	item := models.ListItem{ID: primitive.NewObjectID(), Name: "Milk", Quantity: 1, AddedBy: list.UserID, AddedAt: testNow}
+	updated, err := lists.AddItem(ctx, list.ID, 1, item, testNow)
+	if err != nil {
+		t.Fatalf("AddItem: %v", err)
+	}
+	if updated.Version != 2 || len(updated.Items) != 1 || updated.Items[0].ID != item.ID {
+		t.Fatalf("AddItem returned version %d with %d items, want 2 with the new item", updated.Version, len(updated.Items))
+	}
+
+	checked, quantity := true, 3
+	updated, err = lists.UpdateItem(ctx, list.ID, 2, item.ID, ItemUpdate{Checked: &checked, Quantity: &quantity}, testNow)
+	if err != nil {
+		t.Fatalf("UpdateItem: %v", err)
+	}
+	if got := updated.Items[0]; updated.Version != 3 || !got.Checked || got.Quantity != 3 || got.Name != "Milk" {
+		t.Fatalf("UpdateItem returned version %d item %+v, want version 3 with only checked and quantity changed", updated.Version, got)
+	}
+
+	// A missing item is not found at the current version, but a stale
+	// version is reported as a conflict first
+	missing := primitive.NewObjectID()
+	_, err = lists.UpdateItem(ctx, list.ID, 3, missing, ItemUpdate{Checked: &checked}, testNow)
+	wantErr(t, "UpdateItem missing item", err, ErrNotFound)
+	_, err = lists.DeleteItem(ctx, list.ID, 3, missing, testNow)
+	wantErr(t, "DeleteItem missing item", err, ErrNotFound)
+	_, err = lists.UpdateItem(ctx, list.ID, 2, missing, ItemUpdate{Checked: &checked}, testNow)
+	wantErr(t, "UpdateItem with stale version", err, ErrVersionConflict)
+	if got, _ := lists.Get(ctx, list.ID); got.Version != 3 {
+		t.Fatalf("failed item writes changed the version to %d", got.Version)
+	}
+
+	updated, err = lists.DeleteItem(ctx, list.ID, 3, item.ID, testNow)
+	if err != nil {
+		t.Fatalf("DeleteItem: %v", err)
+	}
+	if updated.Version != 4 || len(updated.Items) != 0 {
+		t.Fatalf("DeleteItem returned version %d with %d items, want 4 with none", updated.Version, len(updated.Items))
+	}
+}
+
+func testListCollaborators(t *testing.T, lists ListStore) {
+	ctx := context.Background()
+	owner, editor, stranger := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	list := newTestList(t, lists, owner, testNow)
+
+	updated, err := lists.AddCollaborator(ctx, list.ID, 1, models.Collaborator{UserID: editor, Role: models.RoleViewer}, testNow)
+	if err != nil {
+		t.Fatalf("AddCollaborator: %v", err)
+	}
+	if role, ok := updated.RoleOf(editor); updated.Version != 2 || !ok || role != models.RoleViewer {
+		t.Fatalf("AddCollaborator returned version %d role %q, want 2 viewer", updated.Version, role)
+	}
+
+	updated, err = lists.UpdateCollaboratorRole(ctx, list.ID, 2, editor, models.RoleEditor, testNow)
+	if err != nil {
+		t.Fatalf("UpdateCollaboratorRole: %v", err)
+	}
+	if role, _ := updated.RoleOf(editor); updated.Version != 3 || role != models.RoleEditor {
+		t.Fatalf("UpdateCollaboratorRole returned version %d role %q, want 3 editor", updated.Version, role)
+	}
+
+	_, err = lists.UpdateCollaboratorRole(ctx, list.ID, 3, stranger, models.RoleEditor, testNow)
+	wantErr(t, "UpdateCollaboratorRole for a stranger", err, ErrNotFound)
+	_, err = lists.RemoveCollaborator(ctx, list.ID, 3, stranger, testNow)
+	wantErr(t, "RemoveCollaborator for a stranger", err, ErrNotFound)
+	_, err = lists.TransferOwnership(ctx, list.ID, 3, editor, owner, testNow)
+	wantErr(t, "TransferOwnership from a non-owner", err, ErrNotFound)
+	_, err = lists.TransferOwnership(ctx, list.ID, 3, owner, stranger, testNow)
+	wantErr(t, "TransferOwnership to a stranger", err, ErrNotFound)
+
+	updated, err = lists.TransferOwnership(ctx, list.ID, 3, owner, editor, testNow)
+	if err != nil {
+		t.Fatalf("TransferOwnership: %v", err)
+	}
+	if updated.Version != 4 || updated.UserID != editor {
+		t.Fatalf("TransferOwnership returned version %d owner %s, want 4 %s", updated.Version, updated.UserID.Hex(), editor.Hex())
+	}
+	if role, ok := updated.RoleOf(owner); !ok || role != models.RoleEditor || len(updated.SharedWith) != 1 {
+		t.Fatalf("former owner has role %q among %d collaborators, want the only editor", role, len(updated.SharedWith))
+	}
+
+	updated, err = lists.RemoveCollaborator(ctx, list.ID, 4, owner, testNow)
+	if err != nil {
+		t.Fatalf("RemoveCollaborator: %v", err)
+	}
+	if _, ok := updated.RoleOf(owner); updated.Version != 5 || ok {
+		t.Fatalf("RemoveCollaborator returned version %d, still sharing: %v", updated.Version, ok)
+	}
+}
+
+func testListForUser(t *testing.T, lists ListStore) {
+	ctx := context.Background()
+	owner, collaborator := primitive.NewObjectID(), primitive.NewObjectID()
+
+	older := newTestList(t, lists, owner, testNow)
+	newer := newTestList(t, lists, owner, testNow.Add(time.Hour))
+	if _, err := lists.AddCollaborator(ctx, older.ID, 1, models.Collaborator{UserID: collaborator, Role: models.RoleEditor}, testNow); err != nil {
+		t.Fatalf("AddCollaborator: %v", err)
+	}
+
+	owned, err := lists.ListForUser(ctx, owner)
+	if err != nil {
+		t.Fatalf("ListForUser: %v", err)
+	}
+	if len(owned) != 2 || owned[0].ID != newer.ID || owned[1].ID != older.ID {
+		t.Fatalf("ListForUser(owner) returned %d lists, want both newest first", len(owned))
+	}
+
+	shared, err := lists.ListForUser(ctx, collaborator)
+	if err != nil {
+		t.Fatalf("ListForUser: %v", err)
+	}
+	if len(shared) != 1 || shared[0].ID != older.ID {
+		t.Fatalf("ListForUser(collaborator) returned %d lists, want only the shared one", len(shared))
+	}
+
+	none, err := lists.ListForUser(ctx, primitive.NewObjectID())
+	if err != nil {
+		t.Fatalf("ListForUser: %v", err)
+	}
+	if none == nil || len(none) != 0 {
+		t.Fatalf("ListForUser(stranger) returned %v, want an empty slice", none)
+	}
+}
+
+func testInviteRedeem(t *testing.T, invites InviteStore) {
+	ctx := context.Background()
+	listID := primitive.NewObjectID()
+
+	newInvite := func(maxUses int, expiresAt time.Time) *models.Invite {
+		t.Helper()
+		invite := &models.Invite{
+			ID:        primitive.NewObjectID(),
+			ListID:    listID,
+			TokenHash: primitive.NewObjectID().Hex(),
+			Role:      models.RoleEditor,
+			MaxUses:   maxUses,
+			ExpiresAt: expiresAt,
+			CreatedAt: testNow,
+		}
+		if err := invites.Create(ctx, invite); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		return invite
+	}
+
+	// A limited invite can be redeemed until its uses run out
+	limited := newInvite(2, testNow.Add(time.Hour))
+	for i := 0; i < 2; i++ {
+		if err := invites.Redeem(ctx, limited.ID, testNow); err != nil {
+			t.Fatalf("Redeem %d: %v", i+1, err)
+		}
+	}
+	wantErr(t, "Redeem exhausted invite", invites.Redeem(ctx, limited.ID, testNow), ErrNotFound)
+	got, err := invites.GetByTokenHash(ctx, limited.TokenHash)
+	if err != nil {
+		t.Fatalf("GetByTokenHash: %v", err)
+	}
+	if got.Uses != 2 {
+		t.Fatalf("exhausted invite has %d uses, want 2", got.Uses)
+	}
+
+	// Releasing a use makes it redeemable again, but only uses taken can be given back
+	if err := invites.Release(ctx, limited.ID); err != nil {
+		t.Fatalf("Release: %v", err)
+	}
+	if err := invites.Redeem(ctx, limited.ID, testNow); err != nil {
+		t.Fatalf("Redeem released use: %v", err)
+	}
+	unused := newInvite(1, testNow.Add(time.Hour))
+	wantErr(t, "Release unused invite", invites.Release(ctx, unused.ID), ErrNotFound)
+	wantErr(t, "Release missing invite", invites.Release(ctx, primitive.NewObjectID()), ErrNotFound)
+
+	// An unlimited invite never runs out
+	unlimited := newInvite(0, testNow.Add(time.Hour))
+	for i := 0; i < 5; i++ {
+		if err := invites.Redeem(ctx, unlimited.ID, testNow); err != nil {
+			t.Fatalf("Redeem unlimited %d: %v", i+1, err)
+		}
+	}
+
+	expired := newInvite(0, testNow)
+	wantErr(t, "Redeem expired invite", invites.Redeem(ctx, expired.ID, testNow), ErrNotFound)
+
+	revoked := newInvite(0, testNow.Add(time.Hour))
+	if err := invites.Revoke(ctx, listID, revoked.ID, testNow); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+	wantErr(t, "Revoke twice", invites.Revoke(ctx, listID, revoked.ID, testNow), ErrNotFound)
+	wantErr(t, "Revoke on another list", invites.Revoke(ctx, primitive.NewObjectID(), unlimited.ID, testNow), ErrNotFound)
+	wantErr(t, "Redeem revoked invite", invites.Redeem(ctx, revoked.ID, testNow), ErrNotFound)
+	wantErr(t, "Redeem missing invite", invites.Redeem(ctx, primitive.NewObjectID(), testNow), ErrNotFound)
+
+	active, err := invites.ListActive(ctx, listID, testNow)
+	if err != nil {
+		t.Fatalf("ListActive: %v", err)
+	}
+	if len(active) != 2 || active[0].ID == active[1].ID ||
+		(active[0].ID != unused.ID && active[0].ID != unlimited.ID) ||
+		(active[1].ID != unused.ID && active[1].ID != unlimited.ID) {
+		t.Fatalf("ListActive returned %d invites, want the unused and unlimited ones", len(active))
+	}
+}
+
+func testSessionRotate(t *testing.T, sessions SessionStore) {
+	ctx := context.Background()
+	session := &models.Session{
+		ID:               primitive.NewObjectID(),
+		UserID:           primitive.NewObjectID(),
+		RefreshTokenHash: "first",
+		CreatedAt:        testNow,
+		LastUsedAt:       testNow,
+		ExpiresAt:        testNow.Add(time.Hour),
+	}
+	if err := sessions.Create(ctx, session); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	later := testNow.Add(time.Minute)
+	if err := sessions.Rotate(ctx, session.ID, "first", "second", later, later.Add(time.Hour)); err != nil {
+		t.Fatalf("Rotate: %v", err)
+	}
+	wantErr(t, "Rotate with a rotated token", sessions.Rotate(ctx, session.ID, "first", "third", later, later.Add(time.Hour)), ErrNotFound)
+
+	if err := sessions.Rotate(ctx, session.ID, "second", "third", later, later.Add(time.Hour)); err != nil {
+		t.Fatalf("Rotate again: %v", err)
+	}
+
+	// Every rotated token still finds the session, for reuse detection
+	for _, hash := range []string{"first", "second", "third"} {
+		got, err := sessions.GetByRefreshTokenHash(ctx, hash)
+		if err != nil {
+			t.Fatalf("GetByRefreshTokenHash(%q): %v", hash, err)
+		}
+		if got.RefreshTokenHash != "third" || !slices.Equal(got.PreviousTokenHashes, []string{"first", "second"}) || !got.LastUsedAt.Equal(later) {
+			t.Fatalf("rotated session has current %q previous %q last used %v", got.RefreshTokenHash, got.PreviousTokenHashes, got.LastUsedAt)
+		}
+	}
+
+	if err := sessions.Revoke(ctx, session.ID, later); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+	wantErr(t, "Revoke twice", sessions.Revoke(ctx, session.ID, later), ErrNotFound)
+	wantErr(t, "Rotate a revoked session", sessions.Rotate(ctx, session.ID, "third", "fourth", later, later.Add(time.Hour)), ErrNotFound)
+}
+
+func testPasswordResetLatestUsable(t *testing.T, resets PasswordResetStore) {
+	ctx := context.Background()
+	userID := primitive.NewObjectID()
+
+	_, err := resets.LatestUsable(ctx, userID, testNow)
+	wantErr(t, "LatestUsable with no tokens", err, ErrNotFound)
+
+	create := func(hash string, createdAt time.Time) {
+		t.Helper()
+		reset := &models.PasswordReset{
+			ID:        primitive.NewObjectID(),
+			UserID:    userID,
+			TokenHash: hash,
+			ExpiresAt: createdAt.Add(time.Hour),
+			CreatedAt: createdAt,
+		}
+		if err := resets.Create(ctx, reset); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+	create("older", testNow)
+	create("newer", testNow.Add(time.Minute))
+
+	got, err := resets.LatestUsable(ctx, userID, testNow.Add(2*time.Minute))
+	if err != nil || got.TokenHash != "newer" {
+		t.Fatalf("LatestUsable = %v, %v, want the newer token", got, err)
+	}
+
+	// Used and expired tokens don't count
+	if _, err := resets.Consume(ctx, "newer", testNow.Add(2*time.Minute)); err != nil {
+		t.Fatalf("Consume: %v", err)
+	}
+	got, err = resets.LatestUsable(ctx, userID, testNow.Add(2*time.Minute))
+	if err != nil || got.TokenHash != "older" {
+		t.Fatalf("LatestUsable after consuming = %v, %v, want the older token", got, err)
+	}
+	_, err = resets.LatestUsable(ctx, userID, testNow.Add(time.Hour))
+	wantErr(t, "LatestUsable once expired", err, ErrNotFound)
+}
+
+func testRateLimits(t *testing.T, limits RateLimitStore) {
+	ctx := context.Background()
+	limit := RateLimit{Requests: 2, Per: time.Minute}
+
+	for i, want := range []bool{true, true, false} {
+		allowed, _, err := limits.Take(ctx, "bucket", limit, testNow)
+		if err != nil {
+			t.Fatalf("Take: %v", err)
+		}
+		if allowed != want {
+			t.Fatalf("Take %d allowed = %v, want %v", i+1, allowed, want)
+		}
+	}
+
+	// Three quarters of the period refills one and a half tokens
+	allowed, remaining, err := limits.Take(ctx, "bucket", limit, testNow.Add(45*time.Second))
+	if err != nil {
+		t.Fatalf("Take: %v", err)
+	}
+	if !allowed || remaining < 0.49 || remaining > 0.51 {
+		t.Fatalf("Take after refill = %v with %v remaining, want allowed with 0.5", allowed, remaining)
+	}
+
+	policy := LockoutPolicy{Threshold: 2, Base: time.Minute, Max: time.Hour, Window: time.Hour}
+	lockedUntil, err := limits.RecordFailure(ctx, "account", policy, testNow)
+	if err != nil || !lockedUntil.IsZero() {
+		t.Fatalf("first RecordFailure = %v, %v, want no lockout", lockedUntil, err)
+	}
+	lockedUntil, err = limits.RecordFailure(ctx, "account", policy, testNow)
+	if err != nil || !lockedUntil.Equal(testNow.Add(time.Minute)) {
+		t.Fatalf("second RecordFailure = %v, %v, want a lockout until %v", lockedUntil, err, testNow.Add(time.Minute))
+	}
+	if got, err := limits.LockedUntil(ctx, "account", testNow); err != nil || !got.Equal(lockedUntil) {
+		t.Fatalf("LockedUntil = %v, %v, want %v", got, err, lockedUntil)
+	}
+	if got, err := limits.LockedUntil(ctx, "account", lockedUntil); err != nil || !got.IsZero() {
+		t.Fatalf("LockedUntil once expired = %v, %v, want no lockout", got, err)
+	}
+
+	if err := limits.ResetFailures(ctx, "account"); err != nil {
+		t.Fatalf("ResetFailures: %v", err)
+	}
+	if got, err := limits.LockedUntil(ctx, "account", testNow); err != nil || !got.IsZero() {
+		t.Fatalf("LockedUntil after reset = %v, %v, want no lockout", got, err)
+	}
+}
+
+func TestLockoutPolicyDuration(t *testing.T) {
+	policy := LockoutPolicy{Threshold: 3, Base: time.Minute, Max: 10 * time.Minute, Window: time.Hour}
+
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, 0},
+		{2, 0},
+		{3, time.Minute},
+		{4, 2 * time.Minute},
+		{5, 4 * time.Minute},
+		{6, 8 * time.Minute},
+		{7, 10 * time.Minute},
+		{100, 10 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := policy.Duration(tt.failures); got != tt.want {
+			t.Errorf("Duration(%d) = %s, want %s", tt.failures, got, tt.want)
+		}
+	}
+
+	// A base longer than the maximum is capped
+	capped := LockoutPolicy{Threshold: 1, Base: time.Hour, Max: time.Minute}
+	if got := capped.Duration(1); got != time.Minute {
+		t.Errorf("Duration with base over max = %s, want 1m", got)
+	}
+}
+
+func TestRateLimitUnmarshalText(t *testing.T) {
+	tests := []struct {
+		text string
+		want RateLimit
+		ok   bool
+	}{
+		{"20/1m", RateLimit{Requests: 20, Per: time.Minute}, true},
+		{"5/30s", RateLimit{Requests: 5, Per: 30 * time.Second}, true},
+		{"1/1h30m", RateLimit{Requests: 1, Per: 90 * time.Minute}, true},
+		{"20", RateLimit{}, false},
+		{"20/", RateLimit{}, false},
+		{"/1m", RateLimit{}, false},
+		{"0/1m", RateLimit{}, false},
+		{"-1/1m", RateLimit{}, false},
+		{"20/0s", RateLimit{}, false},
+		{"20/-1m", RateLimit{}, false},
+		{"20/minute", RateLimit{}, false},
+		{"twenty/1m", RateLimit{}, false},
+	}
+
+	for _, tt := range tests {
+		var got RateLimit
+		err := got.UnmarshalText([]byte(tt.text))
+		if (err == nil) != tt.ok {
+			t.Errorf("UnmarshalText(%q) error = %v, want ok %v", tt.text, err, tt.ok)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("UnmarshalText(%q) = %+v, want %+v", tt.text, got, tt.want)
+		}
+		if tt.ok {
+			text, _ := got.MarshalText()
+			var again RateLimit
+			if err := again.UnmarshalText(text); err != nil || again != got {
+				t.Errorf("MarshalText(%+v) = %q, which doesn't parse back", got, text)
+			}
+		}
+	}
+}
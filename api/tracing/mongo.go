@@ -0,0 +1,94 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/v2/event"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.43.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// MongoMonitor returns a driver command monitor that records a client span
+// for every command, parented to the span in the command's context. Command
+// bodies are left out of the spans since they contain user data.
+func MongoMonitor() *event.CommandMonitor {
+	var spans sync.Map // spanKey -> trace.Span
+
+	finish := func(e *event.CommandFinishedEvent, failure error) {
+		value, ok := spans.LoadAndDelete(spanKey{e.ConnectionID, e.RequestID})
+		if !ok {
+			return
+		}
+		span := value.(trace.Span)
+		if failure != nil {
+			span.RecordError(failure)
+			span.SetStatus(codes.Error, failure.Error())
+		}
+		span.End()
+	}
+
+	return &event.CommandMonitor{
+		Started: func(ctx context.Context, e *event.CommandStartedEvent) {
+			// Most commands name their collection in their first field, e.g. {find: "lists"}
+			name := e.CommandName
+			attrs := []trace.SpanStartOption{
+				trace.WithSpanKind(trace.SpanKindClient),
+				trace.WithAttributes(
+					semconv.DBSystemNameMongoDB,
+					semconv.DBNamespace(e.DatabaseName),
+					semconv.DBOperationName(e.CommandName),
+				),
+			}
+			if collection, ok := e.Command.Lookup(e.CommandName).StringValueOK(); ok {
+				name = fmt.Sprintf("%s %s", e.CommandName, collection)
+				attrs = append(attrs, trace.WithAttributes(semconv.DBCollectionName(collection)))
+			}
+
+			_, span := Start(ctx, name, attrs...)
+			spans.Store(spanKey{e.ConnectionID, e.RequestID}, span)
+		},
+		Succeeded: func(_ context.Context, e *event.CommandSucceededEvent) {
+			finish(&e.CommandFinishedEvent, nil)
+		},
+		Failed: func(_ context.Context, e *event.CommandFailedEvent) {
+			finish(&e.CommandFinishedEvent, e.Failure)
+		},
+	}
+}
+
+// spanKey identifies a command in flight; request IDs are only unique per connection
+type spanKey struct {
+	connectionID string
+	requestID    int64
+}
+
+// CombineMonitors returns a command monitor that forwards every event to each
+// of the given monitors in order, since the driver accepts only one
+func CombineMonitors(monitors ...*event.CommandMonitor) *event.CommandMonitor {
+	return &event.CommandMonitor{
+		Started: func(ctx context.Context, e *event.CommandStartedEvent) {
+			for _, monitor := range monitors {
+				if monitor.Started != nil {
+					monitor.Started(ctx, e)
+				}
+			}
+		},
+		Succeeded: func(ctx context.Context, e *event.CommandSucceededEvent) {
+			for _, monitor := range monitors {
+				if monitor.Succeeded != nil {
+					monitor.Succeeded(ctx, e)
+				}
+			}
+		},
+		Failed: func(ctx context.Context, e *event.CommandFailedEvent) {
+			for _, monitor := range monitors {
+				if monitor.Failed != nil {
+					monitor.Failed(ctx, e)
+				}
+			}
+		},
+	}
+}
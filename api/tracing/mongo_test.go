@@ -0,0 +1,92 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/event"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// recordSpans installs a tracer provider that keeps spans in memory for the
+// rest of the test
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	return recorder
+}
+
+// attributes maps a span's attributes by key
+func attributes(span sdktrace.ReadOnlySpan) map[attribute.Key]string {
+	attrs := make(map[attribute.Key]string)
+	for _, kv := range span.Attributes() {
+		attrs[kv.Key] = kv.Value.Emit()
+	}
+	return attrs
+}
+
+func TestMongoMonitor(t *testing.T) {
+	recorder := recordSpans(t)
+	monitor := MongoMonitor()
+
+	ctx, parent := Start(context.Background(), "GET /lists/:id")
+	command, err := bson.Marshal(bson.D{{Key: "find", Value: "lists"}, {Key: "filter", Value: bson.D{{Key: "name", Value: "secret"}}}})
+	if err != nil {
+		t.Fatalf("Failed to marshal command: %v", err)
+	}
+
+	// Commands are matched to their outcome by connection and request ID
+	monitor.Started(ctx, &event.CommandStartedEvent{Command: command, DatabaseName: "grocer-me", CommandName: "find", RequestID: 1, ConnectionID: "conn"})
+	monitor.Started(ctx, &event.CommandStartedEvent{Command: command, DatabaseName: "grocer-me", CommandName: "find", RequestID: 1, ConnectionID: "other"})
+	monitor.Failed(ctx, &event.CommandFailedEvent{
+		CommandFinishedEvent: event.CommandFinishedEvent{CommandName: "find", RequestID: 1, ConnectionID: "other"},
+		Failure:              errors.New("connection reset"),
+	})
+	monitor.Succeeded(ctx, &event.CommandSucceededEvent{
+		CommandFinishedEvent: event.CommandFinishedEvent{CommandName: "find", RequestID: 1, ConnectionID: "conn"},
+	})
+	parent.End()
+
+	spans := recorder.Ended()
+	if len(spans) != 3 {
+		t.Fatalf("recorded %d spans, want 2 commands and their parent", len(spans))
+	}
+	failed, succeeded := spans[0], spans[1]
+
+	for _, span := range []sdktrace.ReadOnlySpan{failed, succeeded} {
+		if span.Name() != "find lists" || span.SpanKind() != trace.SpanKindClient {
+			t.Fatalf("command span is %s %q, want a client span named \"find lists\"", span.SpanKind(), span.Name())
+		}
+		if span.Parent().SpanID() != parent.SpanContext().SpanID() || span.SpanContext().TraceID() != parent.SpanContext().TraceID() {
+			t.Fatalf("command span is not a child of the span in the command's context")
+		}
+		attrs := attributes(span)
+		if attrs["db.system.name"] != "mongodb" || attrs["db.namespace"] != "grocer-me" ||
+			attrs["db.operation.name"] != "find" || attrs["db.collection.name"] != "lists" {
+			t.Fatalf("command span has attributes %v", attrs)
+		}
+		for _, value := range attrs {
+			if value == "secret" {
+				t.Fatalf("command span recorded the command body")
+			}
+		}
+	}
+
+	if failed.Status().Code != codes.Error || failed.Status().Description != "connection reset" || len(failed.Events()) != 1 {
+		t.Fatalf("failed command span has status %v with %d events, want the error recorded", failed.Status(), len(failed.Events()))
+	}
+	if succeeded.Status().Code != codes.Unset {
+		t.Fatalf("successful command span has status %v", succeeded.Status())
+	}
+}
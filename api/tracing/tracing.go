@@ -0,0 +1,88 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	sdkresource "go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.43.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Exporters that can be selected with TRACE_EXPORTER
+const (
+	// ExporterNone disables tracing; spans are still created but never recorded
+	ExporterNone = "none"
+	// ExporterStdout writes finished spans to stdout as JSON, for local debugging
+	ExporterStdout = "stdout"
+	// ExporterOTLP sends spans to a collector over OTLP/HTTP, configured by the
+	// standard OTEL_EXPORTER_OTLP_* environment variables
+	ExporterOTLP = "otlp"
+)
+
+// serviceName identifies the API in traces unless OTEL_SERVICE_NAME is set
+const serviceName = "grocer-me-api"
+
+// tracerName is the instrumentation scope of spans created by the API
+const tracerName = "bryce-stabenow/grocer-me"
+
+// Init installs the global tracer provider for the selected exporter along
+// with W3C trace context propagation. The returned func flushes buffered
+// spans and must be called before the process exits.
+func Init(ctx context.Context, exporter string) (shutdown func(context.Context) error, err error) {
+	// Incoming traceparent headers are honored even when nothing is exported,
+	// so request logs can still be correlated with the caller's trace
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var spanExporter sdktrace.SpanExporter
+	switch exporter {
+	case ExporterNone:
+		return func(context.Context) error { return nil }, nil
+	case ExporterStdout:
+		spanExporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case ExporterOTLP:
+		spanExporter, err = otlptracehttp.New(ctx)
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q", exporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("create %s trace exporter: %w", exporter, err)
+	}
+
+	// OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES override the defaults
+	resource, err := sdkresource.Merge(
+		sdkresource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(serviceName)),
+		sdkresource.Environment(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("build trace resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(spanExporter),
+		sdktrace.WithResource(resource),
+	)
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+// Start starts a span as a child of any span in ctx
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, opts...)
+}
+
+// TraceID returns the ID of the trace ctx belongs to, or "" if there is none
+func TraceID(ctx context.Context) string {
+	spanContext := trace.SpanContextFromContext(ctx)
+	if !spanContext.HasTraceID() {
+		return ""
+	}
+	return spanContext.TraceID().String()
+}
@@ -1,29 +1,26 @@
 package utils
 
 import (
-	"context"
 	"net/http"
-	"time"
+	"strings"
 
-	"bryce-stabenow/grocer-me/config"
+	"bryce-stabenow/grocer-me/apierr"
 	"bryce-stabenow/grocer-me/models"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/v2/bson"
-	"go.mongodb.org/mongo-driver/v2/mongo"
 )
 
 // GetAuthenticatedUser retrieves the authenticated user ID from context and validates it
 func GetAuthenticatedUser(w http.ResponseWriter, r *http.Request) (primitive.ObjectID, bool) {
 	userIDStr, ok := GetUserID(r)
 	if !ok {
-		ErrorResponse(w, http.StatusUnauthorized, "User ID not found in context")
+		ErrorResponse(w, apierr.AuthRequired)
 		return primitive.ObjectID{}, false
 	}
 
 	userID, err := primitive.ObjectIDFromHex(userIDStr)
 	if err != nil {
-		ErrorResponse(w, http.StatusBadRequest, "Invalid user ID format")
+		ErrorResponse(w, apierr.InvalidID.WithMessage("Invalid user ID format"))
 		return primitive.ObjectID{}, false
 	}
 
@@ -34,61 +31,132 @@ func GetAuthenticatedUser(w http.ResponseWriter, r *http.Request) (primitive.Obj
 func GetAndValidateListID(w http.ResponseWriter, r *http.Request) (primitive.ObjectID, bool) {
 	listIDStr := GetPathParam(r, "id")
 	if listIDStr == "" {
-		ErrorResponse(w, http.StatusBadRequest, "List ID is required")
+		ErrorResponse(w, apierr.MissingParameter.WithMessage("List ID is required"))
 		return primitive.ObjectID{}, false
 	}
 
 	listID, err := primitive.ObjectIDFromHex(listIDStr)
 	if err != nil {
-		ErrorResponse(w, http.StatusBadRequest, "Invalid list ID format")
+		ErrorResponse(w, apierr.InvalidID.WithMessage("Invalid list ID format"))
 		return primitive.ObjectID{}, false
 	}
 
 	return listID, true
 }
 
-// FetchList retrieves a list by ID from the database
-func FetchList(w http.ResponseWriter, listID primitive.ObjectID) (*models.List, bool) {
-	collection := config.DB.Collection("lists")
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+// GetAndValidateItemID extracts and validates the item ID from path parameters
+func GetAndValidateItemID(w http.ResponseWriter, r *http.Request) (primitive.ObjectID, bool) {
+	itemIDStr := GetPathParam(r, "itemId")
+	if itemIDStr == "" {
+		ErrorResponse(w, apierr.MissingParameter.WithMessage("Item ID is required"))
+		return primitive.ObjectID{}, false
+	}
 
-	var list models.List
-	err := collection.FindOne(ctx, bson.M{"_id": listID}).Decode(&list)
+	itemID, err := primitive.ObjectIDFromHex(itemIDStr)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			ErrorResponse(w, http.StatusNotFound, "List not found")
-			return nil, false
-		}
-		ErrorResponse(w, http.StatusInternalServerError, "Failed to find list")
-		return nil, false
+		ErrorResponse(w, apierr.InvalidID.WithMessage("Invalid item ID format"))
+		return primitive.ObjectID{}, false
 	}
 
-	return &list, true
+	return itemID, true
 }
 
-// CheckListAccess verifies if a user has access to a list (owner or shared with)
-func CheckListAccess(w http.ResponseWriter, list *models.List, userID primitive.ObjectID) bool {
-	if list.UserID == userID {
+// GetAndValidateInviteID extracts and validates the invite ID from path parameters
+func GetAndValidateInviteID(w http.ResponseWriter, r *http.Request) (primitive.ObjectID, bool) {
+	inviteIDStr := GetPathParam(r, "inviteId")
+	if inviteIDStr == "" {
+		ErrorResponse(w, apierr.MissingParameter.WithMessage("Invite ID is required"))
+		return primitive.ObjectID{}, false
+	}
+
+	inviteID, err := primitive.ObjectIDFromHex(inviteIDStr)
+	if err != nil {
+		ErrorResponse(w, apierr.InvalidID.WithMessage("Invalid invite ID format"))
+		return primitive.ObjectID{}, false
+	}
+
+	return inviteID, true
+}
+
+// GetAndValidateUserID extracts and validates a user ID from path parameters
+func GetAndValidateUserID(w http.ResponseWriter, r *http.Request) (primitive.ObjectID, bool) {
+	userIDStr := GetPathParam(r, "userId")
+	if userIDStr == "" {
+		ErrorResponse(w, apierr.MissingParameter.WithMessage("User ID is required"))
+		return primitive.ObjectID{}, false
+	}
+
+	userID, err := primitive.ObjectIDFromHex(userIDStr)
+	if err != nil {
+		ErrorResponse(w, apierr.InvalidID.WithMessage("Invalid user ID format"))
+		return primitive.ObjectID{}, false
+	}
+
+	return userID, true
+}
+
+// CheckListPermission verifies that a user's role on a list grants the given permission
+func CheckListPermission(w http.ResponseWriter, list *models.List, userID primitive.ObjectID, permission models.Permission) bool {
+	if err := ListPermissionError(list, userID, permission); err != nil {
+		ErrorResponse(w, err)
+		return false
+	}
+	return true
+}
+
+// ListPermissionError returns the error for a user whose role on a list
+// doesn't grant the given permission, or nil if it does
+func ListPermissionError(list *models.List, userID primitive.ObjectID, permission models.Permission) *apierr.Error {
+	role, ok := list.RoleOf(userID)
+	if !ok {
+		return apierr.ListAccessDenied
+	}
+
+	if !role.Can(permission) {
+		return apierr.PermissionDenied
+	}
+
+	return nil
+}
+
+// CheckIfMatch verifies the If-Match header (if present) against the list's current version
+func CheckIfMatch(w http.ResponseWriter, r *http.Request, list *models.List) bool {
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch == "" {
 		return true
 	}
 
-	for _, sharedUserID := range list.SharedWith {
-		if sharedUserID == userID {
+	current := ETag(list.Version)
+	for _, tag := range strings.Split(ifMatch, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || tag == current {
 			return true
 		}
 	}
 
-	ErrorResponse(w, http.StatusForbidden, "You do not have access to this list")
+	ErrorResponse(w, apierr.ListVersionConflict)
 	return false
 }
 
-// CheckListOwnership verifies if a user is the owner of a list
-func CheckListOwnership(w http.ResponseWriter, list *models.List, userID primitive.ObjectID) bool {
-	if list.UserID != userID {
-		ErrorResponse(w, http.StatusForbidden, "You do not have permission to perform this action")
-		return false
+// HasVersionPrecondition reports whether the request's If-Match header names
+// a version, so its write must fail rather than apply to a newer one
+func HasVersionPrecondition(r *http.Request) bool {
+	for _, tag := range strings.Split(r.Header.Get("If-Match"), ",") {
+		if tag = strings.TrimSpace(tag); tag != "" && tag != "*" {
+			return true
+		}
 	}
-	return true
+	return false
 }
 
+// FindListItem looks up an item in a list by ID
+func FindListItem(w http.ResponseWriter, list *models.List, itemID primitive.ObjectID) (*models.ListItem, bool) {
+	for i := range list.Items {
+		if list.Items[i].ID == itemID {
+			return &list.Items[i], true
+		}
+	}
+
+	ErrorResponse(w, apierr.ItemNotFound)
+	return nil, false
+}
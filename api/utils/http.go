@@ -3,7 +3,18 @@ package utils
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
 	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"bryce-stabenow/grocer-me/apierr"
 )
 
 // ContextKey is a custom type for context keys to avoid collisions
@@ -12,10 +23,30 @@ type ContextKey string
 const (
 	// UserIDKey is the context key for storing user ID
 	UserIDKey ContextKey = "user_id"
+	// SessionIDKey is the context key for storing the session ID
+	SessionIDKey ContextKey = "session_id"
 	// PathParamsKey is the context key for storing path parameters
 	PathParamsKey ContextKey = "path_params"
+	// RoutePatternKey is the context key for storing the matched route pattern
+	RoutePatternKey ContextKey = "route_pattern"
+	// RequestIDKey is the context key for storing the request ID
+	RequestIDKey ContextKey = "request_id"
+	// LoggerKey is the context key for storing the request-scoped logger
+	LoggerKey ContextKey = "logger"
+	// RequestInfoKey is the context key for storing the request's RequestInfo
+	RequestInfoKey ContextKey = "request_info"
 )
 
+// RequestInfo collects details learned while a request passes through the
+// middleware chain, so outer middleware such as the request logger can report
+// what inner layers discovered
+type RequestInfo struct {
+	UserID string
+}
+
+// RequestIDHeader is the header carrying the ID that ties a response to its request
+const RequestIDHeader = "X-Request-ID"
+
 // JSONResponse sends a JSON response with the given status code
 func JSONResponse(w http.ResponseWriter, statusCode int, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
@@ -25,14 +56,137 @@ func JSONResponse(w http.ResponseWriter, statusCode int, data interface{}) {
 	}
 }
 
-// ErrorResponse sends a JSON error response
-func ErrorResponse(w http.ResponseWriter, statusCode int, message string) {
-	JSONResponse(w, statusCode, map[string]string{"error": message})
+// ErrorRecorder is implemented by response writers that keep the cause of a
+// server error response, such as the request logger's, so it can be logged
+type ErrorRecorder interface {
+	RecordError(err error)
+}
+
+// ErrorResponse sends an error as an RFC 7807 problem details document,
+// tagged with the request ID if one has been assigned. The cause of a server
+// error is passed to each ErrorRecorder wrapping w rather than sent.
+func ErrorResponse(w http.ResponseWriter, err *apierr.Error) {
+	if cause := errors.Unwrap(err); cause != nil && err.Status >= http.StatusInternalServerError {
+		recordError(w, cause)
+	}
+
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(err.Status)
+	json.NewEncoder(w).Encode(err.Problem(w.Header().Get(RequestIDHeader)))
+}
+
+// recordError passes err to every ErrorRecorder in w's chain of wrapped writers
+func recordError(w http.ResponseWriter, err error) {
+	for w != nil {
+		if recorder, ok := w.(ErrorRecorder); ok {
+			recorder.RecordError(err)
+		}
+		unwrapper, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			return
+		}
+		w = unwrapper.Unwrap()
+	}
+}
+
+// SetETag sets a strong ETag header for the given resource version
+func SetETag(w http.ResponseWriter, version int64) {
+	w.Header().Set("ETag", ETag(version))
+}
+
+// ETag formats a resource version as a strong entity tag
+func ETag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
 }
 
-// DecodeJSON decodes JSON from request body
+// SetRetryAfter tells the client how long to wait before trying again,
+// rounded up to whole seconds
+func SetRetryAfter(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", Seconds(wait))
+}
+
+// Seconds formats a duration as whole seconds, rounding up, for headers
+func Seconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
+
+// DecodeJSON decodes a JSON request body into v and validates it against its
+// binding tags. Unknown fields, mistyped values and failed rules are reported
+// as a *ValidationError; any other error means the body isn't valid JSON.
 func DecodeJSON(r *http.Request, v interface{}) error {
-	return json.NewDecoder(r.Body).Decode(v)
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+
+	// An empty body is validated like an empty object so missing required
+	// fields are reported individually
+	err := decoder.Decode(v)
+	if err != nil && !errors.Is(err, io.EOF) {
+		var typeErr *json.UnmarshalTypeError
+		switch {
+		case errors.As(err, &typeErr):
+			return &ValidationError{Fields: []FieldError{{
+				Field:   typeErr.Field,
+				Rule:    "type",
+				Message: fmt.Sprintf("%s must be %s", fieldLabel(typeErr.Field), jsonTypeName(typeErr.Type)),
+			}}}
+		case strings.HasPrefix(err.Error(), "json: unknown field "):
+			field, _ := strconv.Unquote(strings.TrimPrefix(err.Error(), "json: unknown field "))
+			return &ValidationError{Fields: []FieldError{{
+				Field:   field,
+				Rule:    "unknown",
+				Message: fmt.Sprintf("%s is not a recognized field", field),
+			}}}
+		default:
+			return ErrInvalidJSON
+		}
+	}
+
+	// Only a single JSON value is accepted
+	if decoder.More() {
+		return ErrInvalidJSON
+	}
+
+	return Validate(v)
+}
+
+// ErrInvalidJSON is returned by DecodeJSON when the body isn't a single JSON value
+var ErrInvalidJSON = errors.New("request body must be a single valid JSON object")
+
+// DecodeErrorResponse sends the response for an error returned by DecodeJSON:
+// 422 with per-field errors for validation failures, 400 for malformed JSON
+// and 500 for a request model with malformed binding tags
+func DecodeErrorResponse(w http.ResponseWriter, err error) {
+	if errors.Is(err, ErrInvalidJSON) {
+		ErrorResponse(w, apierr.InvalidJSON)
+		return
+	}
+	validationErr, ok := IsValidationError(err)
+	if !ok {
+		ErrorResponse(w, apierr.Unexpected(err, "Failed to validate request"))
+		return
+	}
+
+	// The detail repeats the first field's message for clients that only display one
+	ErrorResponse(w, apierr.ValidationFailed.WithMessage(validationErr.Fields[0].Message).WithDetails(validationErr.Fields))
+}
+
+// jsonTypeName describes a Go type by the JSON value expected for it
+func jsonTypeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	default:
+		return "an object"
+	}
 }
 
 // GetUserID retrieves user ID from request context
@@ -41,9 +195,26 @@ func GetUserID(r *http.Request) (string, bool) {
 	return userID, ok
 }
 
-// SetUserID sets user ID in context
+// SetUserID sets user ID in context, tagging the request's logger and
+// RequestInfo with it
 func SetUserID(r *http.Request, userID string) *http.Request {
+	if info := GetRequestInfo(r); info != nil {
+		info.UserID = userID
+	}
 	ctx := context.WithValue(r.Context(), UserIDKey, userID)
+	ctx = context.WithValue(ctx, LoggerKey, GetLogger(r).With("user_id", userID))
+	return r.WithContext(ctx)
+}
+
+// GetSessionID retrieves the session ID from request context
+func GetSessionID(r *http.Request) (string, bool) {
+	sessionID, ok := r.Context().Value(SessionIDKey).(string)
+	return sessionID, ok
+}
+
+// SetSessionID sets the session ID in context
+func SetSessionID(r *http.Request, sessionID string) *http.Request {
+	ctx := context.WithValue(r.Context(), SessionIDKey, sessionID)
 	return r.WithContext(ctx)
 }
 
@@ -62,8 +233,60 @@ func SetPathParams(r *http.Request, params map[string]string) *http.Request {
 	return r.WithContext(ctx)
 }
 
-// SetCookie sets an HTTP cookie
-func SetCookie(w http.ResponseWriter, name, value string, maxAge int, path, domain string, secure, httpOnly bool) {
+// GetRoutePattern retrieves the pattern of the matched route, e.g. "/lists/:id"
+func GetRoutePattern(r *http.Request) string {
+	pattern, _ := r.Context().Value(RoutePatternKey).(string)
+	return pattern
+}
+
+// SetRoutePattern sets the matched route pattern in context
+func SetRoutePattern(r *http.Request, pattern string) *http.Request {
+	ctx := context.WithValue(r.Context(), RoutePatternKey, pattern)
+	return r.WithContext(ctx)
+}
+
+// GetRequestID retrieves the request ID from context
+func GetRequestID(r *http.Request) string {
+	requestID, _ := r.Context().Value(RequestIDKey).(string)
+	return requestID
+}
+
+// SetRequestID sets the request ID in context
+func SetRequestID(r *http.Request, requestID string) *http.Request {
+	ctx := context.WithValue(r.Context(), RequestIDKey, requestID)
+	return r.WithContext(ctx)
+}
+
+// GetLogger retrieves the request-scoped logger, falling back to the default
+// logger outside of a request
+func GetLogger(r *http.Request) *slog.Logger {
+	if logger, ok := r.Context().Value(LoggerKey).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// SetLogger sets the request-scoped logger in context
+func SetLogger(r *http.Request, logger *slog.Logger) *http.Request {
+	ctx := context.WithValue(r.Context(), LoggerKey, logger)
+	return r.WithContext(ctx)
+}
+
+// GetRequestInfo retrieves the request's RequestInfo, or nil if there is none
+func GetRequestInfo(r *http.Request) *RequestInfo {
+	info, _ := r.Context().Value(RequestInfoKey).(*RequestInfo)
+	return info
+}
+
+// SetRequestInfo sets the request's RequestInfo in context
+func SetRequestInfo(r *http.Request, info *RequestInfo) *http.Request {
+	ctx := context.WithValue(r.Context(), RequestInfoKey, info)
+	return r.WithContext(ctx)
+}
+
+// SetCookie sets an HTTP cookie. sameSite controls whether browsers send it
+// on cross-site requests; http.SameSiteNoneMode requires secure.
+func SetCookie(w http.ResponseWriter, name, value string, maxAge int, path, domain string, secure, httpOnly bool, sameSite http.SameSite) {
 	cookie := &http.Cookie{
 		Name:     name,
 		Value:    value,
@@ -72,7 +295,7 @@ func SetCookie(w http.ResponseWriter, name, value string, maxAge int, path, doma
 		Domain:   domain,
 		Secure:   secure,
 		HttpOnly: httpOnly,
+		SameSite: sameSite,
 	}
 	http.SetCookie(w, cookie)
 }
-
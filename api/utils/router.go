@@ -1,137 +1,365 @@
 package utils
 
 import (
+	"fmt"
 	"net/http"
+	"reflect"
+	"regexp"
+	"runtime"
+	"sort"
 	"strings"
+	"sync"
+
+	"bryce-stabenow/grocer-me/apierr"
 )
 
+// Middleware wraps a handler with additional behavior
+type Middleware func(http.HandlerFunc) http.HandlerFunc
+
 // Route represents a single route with its handler
 type Route struct {
 	Method  string
 	Pattern string
-	Handler http.HandlerFunc
+	Handler http.HandlerFunc // Wrapped in the route's full middleware chain
+	// Middleware names the route's effective chain, outermost first
+	Middleware []string
 }
 
-// Router handles HTTP routing
+// Router handles HTTP routing. Routes are stored in a tree keyed by path
+// segment, so matching costs one step per segment regardless of how many
+// routes are registered. Patterns support named parameters ("/lists/:id")
+// and a trailing catch-all ("/files/*path").
+//
+// Middleware is composed once when a route is registered. A route's chain is
+// the router's middleware, then each enclosing group's, then the route's own,
+// each in the order added. Router middleware also wraps the router's own 404,
+// 405 and OPTIONS responses so those are logged and measured too; they have no
+// route pattern (see GetRoutePattern), which middleware can check to skip them.
+//
+// Each request is traced with a server span named after its route, continuing
+// the caller's trace if it sent a W3C traceparent header, and each middleware
+// records a child span.
 type Router struct {
-	routes      []Route
-	middlewares []func(http.HandlerFunc) http.HandlerFunc
+	*RouteGroup
+	root   *node
+	routes []Route
+
+	// Fallback responses, composed with the router's middleware on first use
+	composeOnce      sync.Once
+	notFound         http.HandlerFunc
+	methodNotAllowed http.HandlerFunc
+	options          http.HandlerFunc
 }
 
 // NewRouter creates a new router
 func NewRouter() *Router {
-	return &Router{
-		routes:      []Route{},
-		middlewares: []func(http.HandlerFunc) http.HandlerFunc{},
+	router := &Router{
+		root:   &node{},
+		routes: []Route{},
 	}
+	router.RouteGroup = &RouteGroup{router: router}
+	return router
 }
 
-// Use adds middleware to the router
-func (router *Router) Use(middleware func(http.HandlerFunc) http.HandlerFunc) {
-	router.middlewares = append(router.middlewares, middleware)
+// Routes returns every registered route in registration order
+func (router *Router) Routes() []Route {
+	return append([]Route(nil), router.routes...)
 }
 
-// AddRoute adds a route to the router
-func (router *Router) AddRoute(method, pattern string, handler http.HandlerFunc) {
-	router.routes = append(router.routes, Route{
-		Method:  method,
-		Pattern: pattern,
-		Handler: handler,
+// composeFallbacks wraps the router's own responses in its middleware
+func (router *Router) composeFallbacks() {
+	router.RouteGroup.sealed = true
+
+	router.notFound = router.chain(nil, func(w http.ResponseWriter, r *http.Request) {
+		ErrorResponse(w, apierr.RouteNotFound)
+	})
+	router.methodNotAllowed = router.chain(nil, func(w http.ResponseWriter, r *http.Request) {
+		ErrorResponse(w, apierr.MethodNotAllowed)
+	})
+	router.options = router.chain(nil, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
 	})
 }
 
-// GET adds a GET route
-func (router *Router) GET(pattern string, handler http.HandlerFunc) {
-	router.AddRoute("GET", pattern, handler)
+// addRoute inserts a route into the tree, panicking on patterns that conflict
+// with existing routes since that is always a programming error
+func (router *Router) addRoute(method, pattern string, handler http.HandlerFunc, middleware []string) {
+	current := router.root
+	segments := splitPath(pattern)
+	for i, segment := range segments {
+		switch {
+		case strings.HasPrefix(segment, ":"):
+			if current.param == nil {
+				current.param = &node{name: segment[1:]}
+			} else if current.param.name != segment[1:] {
+				panic(fmt.Sprintf("router: %s conflicts with parameter :%s", pattern, current.param.name))
+			}
+			current = current.param
+		case strings.HasPrefix(segment, "*"):
+			if i != len(segments)-1 {
+				panic(fmt.Sprintf("router: catch-all must be the last segment in %s", pattern))
+			}
+			if current.catchAll == nil {
+				current.catchAll = &node{name: segment[1:]}
+			} else if current.catchAll.name != segment[1:] {
+				panic(fmt.Sprintf("router: %s conflicts with catch-all *%s", pattern, current.catchAll.name))
+			}
+			current = current.catchAll
+		default:
+			if current.children == nil {
+				current.children = make(map[string]*node)
+			}
+			child, ok := current.children[segment]
+			if !ok {
+				child = &node{}
+				current.children[segment] = child
+			}
+			current = child
+		}
+	}
+
+	if current.routes == nil {
+		current.routes = make(map[string]*Route)
+	}
+	if _, exists := current.routes[method]; exists {
+		panic(fmt.Sprintf("router: %s %s is already registered", method, pattern))
+	}
+
+	route := Route{
+		Method:     method,
+		Pattern:    pattern,
+		Handler:    handler,
+		Middleware: middleware,
+	}
+	current.routes[method] = &route
+	router.routes = append(router.routes, route)
+}
+
+// ServeHTTP implements the http.Handler interface
+func (router *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	router.composeOnce.Do(router.composeFallbacks)
+
+	// Every request, matched or not, gets a server span
+	recorder, r := startServerSpan(w, r)
+	defer recorder.end()
+	w = recorder
+
+	segments := splitPath(r.URL.Path)
+	params := make(map[string]string)
+
+	// Handlers already carry their middleware, so matching is all that's left
+	if matched := router.root.lookup(segments, params, func(n *node) bool { return n.routeFor(r.Method) != nil }); matched != nil {
+		route := matched.routeFor(r.Method)
+
+		// Apply path parameters and the matched pattern to request context
+		if len(params) > 0 {
+			r = SetPathParams(r, params)
+		}
+		r = SetRoutePattern(r, route.Pattern)
+		nameServerSpan(r, route.Pattern)
+		route.Handler(w, r)
+		return
+	}
+
+	// The path exists but not for this method
+	if matched := router.root.lookup(segments, params, func(n *node) bool { return len(n.routes) > 0 }); matched != nil {
+		w.Header().Set("Allow", matched.allowedMethods())
+		if r.Method == http.MethodOptions {
+			router.options(w, r)
+			return
+		}
+		router.methodNotAllowed(w, r)
+		return
+	}
+
+	// If no route found, use 404 handler
+	router.notFound(w, r)
+}
+
+// RouteGroup registers routes under a shared path prefix, wrapping each of
+// them in the group's middleware. The router itself is the root group.
+type RouteGroup struct {
+	router      *Router
+	prefix      string
+	middlewares []Middleware
+	// sealed is set once routes or subgroups have captured the middleware,
+	// after which Use would leave them with inconsistent chains
+	sealed bool
+}
+
+// Use appends middleware to the group. It must be called before the group
+// has any routes or subgroups so every route in it gets the same chain.
+func (group *RouteGroup) Use(middlewares ...Middleware) {
+	if group.sealed {
+		panic(fmt.Sprintf("router: Use called on %q after routes or subgroups were added", group.prefix))
+	}
+	group.middlewares = append(group.middlewares, middlewares...)
+}
+
+// Group creates a group of routes under a path prefix. Its middleware runs
+// in the order given, after the middleware of the enclosing group.
+func (group *RouteGroup) Group(prefix string, middlewares ...Middleware) *RouteGroup {
+	group.sealed = true
+
+	combined := make([]Middleware, 0, len(group.middlewares)+len(middlewares))
+	combined = append(combined, group.middlewares...)
+	combined = append(combined, middlewares...)
+
+	return &RouteGroup{
+		router:      group.router,
+		prefix:      group.prefix + prefix,
+		middlewares: combined,
+	}
+}
+
+// AddRoute adds a route to the router. Route middleware runs in the order
+// given, after the group's.
+func (group *RouteGroup) AddRoute(method, pattern string, handler http.HandlerFunc, middlewares ...Middleware) {
+	group.sealed = true
+
+	pattern = group.prefix + pattern
+	if pattern == "" {
+		pattern = "/"
+	}
+
+	chain := make([]string, 0, len(group.middlewares)+len(middlewares))
+	for _, middleware := range group.middlewares {
+		chain = append(chain, middlewareName(middleware))
+	}
+	for _, middleware := range middlewares {
+		chain = append(chain, middlewareName(middleware))
+	}
+
+	group.router.addRoute(method, pattern, group.chain(middlewares, handler), chain)
+}
+
+// chain wraps a handler in the group's middleware followed by extra
+// middleware, so the group's first middleware runs outermost. Each middleware
+// records a span named after it.
+func (group *RouteGroup) chain(extra []Middleware, handler http.HandlerFunc) http.HandlerFunc {
+	for i := len(extra) - 1; i >= 0; i-- {
+		handler = traceMiddleware(middlewareName(extra[i]), extra[i])(handler)
+	}
+	for i := len(group.middlewares) - 1; i >= 0; i-- {
+		handler = traceMiddleware(middlewareName(group.middlewares[i]), group.middlewares[i])(handler)
+	}
+	return handler
+}
+
+// GET adds a GET route; HEAD requests are answered by it automatically
+func (group *RouteGroup) GET(pattern string, handler http.HandlerFunc, middlewares ...Middleware) {
+	group.AddRoute(http.MethodGet, pattern, handler, middlewares...)
+}
+
+// HEAD adds a HEAD route, overriding the automatic one derived from GET
+func (group *RouteGroup) HEAD(pattern string, handler http.HandlerFunc, middlewares ...Middleware) {
+	group.AddRoute(http.MethodHead, pattern, handler, middlewares...)
 }
 
 // POST adds a POST route
-func (router *Router) POST(pattern string, handler http.HandlerFunc) {
-	router.AddRoute("POST", pattern, handler)
+func (group *RouteGroup) POST(pattern string, handler http.HandlerFunc, middlewares ...Middleware) {
+	group.AddRoute(http.MethodPost, pattern, handler, middlewares...)
 }
 
 // PUT adds a PUT route
-func (router *Router) PUT(pattern string, handler http.HandlerFunc) {
-	router.AddRoute("PUT", pattern, handler)
+func (group *RouteGroup) PUT(pattern string, handler http.HandlerFunc, middlewares ...Middleware) {
+	group.AddRoute(http.MethodPut, pattern, handler, middlewares...)
+}
+
+// PATCH adds a PATCH route
+func (group *RouteGroup) PATCH(pattern string, handler http.HandlerFunc, middlewares ...Middleware) {
+	group.AddRoute(http.MethodPatch, pattern, handler, middlewares...)
 }
 
 // DELETE adds a DELETE route
-func (router *Router) DELETE(pattern string, handler http.HandlerFunc) {
-	router.AddRoute("DELETE", pattern, handler)
+func (group *RouteGroup) DELETE(pattern string, handler http.HandlerFunc, middlewares ...Middleware) {
+	group.AddRoute(http.MethodDelete, pattern, handler, middlewares...)
 }
 
-// ServeHTTP implements the http.Handler interface
-func (router *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	// Create a handler that will process the request
-	var finalHandler http.HandlerFunc
-	
-	// Find matching route
-	routeFound := false
-	for _, route := range router.routes {
-		if route.Method != r.Method {
-			continue
-		}
+// closureSuffix matches the suffix Go gives anonymous functions, e.g. ".func1"
+var closureSuffix = regexp.MustCompile(`\.func\d+(\.\d+)*$`)
 
-		params, matches := matchPattern(route.Pattern, r.URL.Path)
-		if matches {
-			routeFound = true
-			
-			// Apply path parameters to request context
-			if len(params) > 0 {
-				r = SetPathParams(r, params)
-			}
+// middlewareName identifies a middleware by the function that built it, e.g.
+// "middleware.JWTAuth", for listing route chains
+func middlewareName(middleware Middleware) string {
+	name := runtime.FuncForPC(reflect.ValueOf(middleware).Pointer()).Name()
+	name = name[strings.LastIndex(name, "/")+1:]
+	return closureSuffix.ReplaceAllString(name, "")
+}
+
+// node is one path segment in the routing tree
+type node struct {
+	name     string            // Parameter name for param and catch-all nodes
+	children map[string]*node  // Static segments
+	param    *node             // ":name" segment
+	catchAll *node             // "*name" segment matching the rest of the path
+	routes   map[string]*Route // Routes by method ending at this node
+}
 
-			finalHandler = route.Handler
-			break
+// lookup finds the node matching the path segments that satisfies accept,
+// preferring static segments over parameters over catch-alls. Parameters are
+// only recorded along the path that matched.
+func (n *node) lookup(segments []string, params map[string]string, accept func(*node) bool) *node {
+	if len(segments) == 0 {
+		if accept(n) {
+			return n
 		}
+		return nil
 	}
 
-	// If no route found, use 404 handler
-	if !routeFound {
-		finalHandler = http.NotFound
+	segment := segments[0]
+	if child, ok := n.children[segment]; ok {
+		if matched := child.lookup(segments[1:], params, accept); matched != nil {
+			return matched
+		}
 	}
 
-	// Apply global middlewares to the handler
-	for i := len(router.middlewares) - 1; i >= 0; i-- {
-		finalHandler = router.middlewares[i](finalHandler)
+	if n.param != nil && segment != "" {
+		if matched := n.param.lookup(segments[1:], params, accept); matched != nil {
+			params[n.param.name] = segment
+			return matched
+		}
 	}
 
-	// Execute the final handler
-	finalHandler(w, r)
-}
+	if n.catchAll != nil && accept(n.catchAll) {
+		params[n.catchAll.name] = strings.Join(segments, "/")
+		return n.catchAll
+	}
 
-// matchPattern matches a URL pattern against a path and extracts parameters
-// Pattern format: "/lists/:id" matches "/lists/123" with params["id"] = "123"
-func matchPattern(pattern, path string) (map[string]string, bool) {
-	params := make(map[string]string)
-	
-	patternParts := strings.Split(strings.Trim(pattern, "/"), "/")
-	pathParts := strings.Split(strings.Trim(path, "/"), "/")
+	return nil
+}
 
-	// Handle root path
-	if pattern == "/" && path == "/" {
-		return params, true
+// routeFor returns the route for a method, answering HEAD with GET
+func (n *node) routeFor(method string) *Route {
+	if route, ok := n.routes[method]; ok {
+		return route
 	}
-
-	// Different number of parts means no match
-	if len(patternParts) != len(pathParts) {
-		return nil, false
+	if method == http.MethodHead {
+		return n.routes[http.MethodGet]
 	}
+	return nil
+}
 
-	for i := 0; i < len(patternParts); i++ {
-		patternPart := patternParts[i]
-		pathPart := pathParts[i]
-
-		if strings.HasPrefix(patternPart, ":") {
-			// This is a parameter
-			paramName := strings.TrimPrefix(patternPart, ":")
-			params[paramName] = pathPart
-		} else if patternPart != pathPart {
-			// Not a parameter and doesn't match
-			return nil, false
+// allowedMethods lists the methods the node answers, for the Allow header
+func (n *node) allowedMethods() string {
+	methods := []string{http.MethodOptions}
+	for method := range n.routes {
+		methods = append(methods, method)
+	}
+	if _, ok := n.routes[http.MethodGet]; ok {
+		if _, ok := n.routes[http.MethodHead]; !ok {
+			methods = append(methods, http.MethodHead)
 		}
 	}
-
-	return params, true
+	sort.Strings(methods)
+	return strings.Join(methods, ", ")
 }
 
+// splitPath splits a path into segments, ignoring leading and trailing slashes
+func splitPath(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
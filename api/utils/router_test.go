@@ -0,0 +1,268 @@
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// testRouter registers routes whose handlers record the request they served
+type testRouter struct {
+	*Router
+	served *http.Request
+}
+
+func newTestRouter() *testRouter {
+	return &testRouter{Router: NewRouter()}
+}
+
+func (router *testRouter) handler(w http.ResponseWriter, r *http.Request) {
+	router.served = r
+	w.WriteHeader(http.StatusOK)
+}
+
+func (router *testRouter) serve(method, path string) *httptest.ResponseRecorder {
+	router.served = nil
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+	return rec
+}
+
+func TestRouterMatching(t *testing.T) {
+	router := newTestRouter()
+	router.GET("/lists", router.handler)
+	router.GET("/lists/:id", router.handler)
+	router.PUT("/lists/:id", router.handler)
+	router.DELETE("/lists/:id", router.handler)
+	router.GET("/lists/:id/items", router.handler)
+	router.POST("/lists/:id/items", router.handler)
+	router.POST("/lists/share/:token", router.handler)
+	router.GET("/lists/:id/items/:itemId", router.handler)
+	router.GET("/files/*path", router.handler)
+	router.GET("/files/readme", router.handler)
+
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		status  int
+		pattern string
+		params  map[string]string
+	}{
+		{name: "static", method: "GET", path: "/lists", status: 200, pattern: "/lists"},
+		{name: "trailing slash", method: "GET", path: "/lists/", status: 200, pattern: "/lists"},
+		{name: "param", method: "GET", path: "/lists/abc", status: 200, pattern: "/lists/:id", params: map[string]string{"id": "abc"}},
+		{name: "nested params", method: "GET", path: "/lists/abc/items/def", status: 200, pattern: "/lists/:id/items/:itemId",
+			params: map[string]string{"id": "abc", "itemId": "def"}},
+		{name: "static beats param", method: "POST", path: "/lists/share/abc", status: 200, pattern: "/lists/share/:token",
+			params: map[string]string{"token": "abc"}},
+		{name: "static segment taken as param", method: "POST", path: "/lists/share/items", status: 200, pattern: "/lists/share/:token",
+			params: map[string]string{"token": "items"}},
+		{name: "backtracks from static to param", method: "GET", path: "/lists/share/items", status: 200, pattern: "/lists/:id/items",
+			params: map[string]string{"id": "share"}},
+		{name: "backtracks for method", method: "POST", path: "/lists/share", status: 405},
+		{name: "empty segment never matches a param", method: "GET", path: "/lists//items", status: 404},
+		{name: "empty last segment", method: "GET", path: "/lists/abc/items/", status: 200, pattern: "/lists/:id/items",
+			params: map[string]string{"id": "abc"}},
+		{name: "catch-all joins the rest", method: "GET", path: "/files/a/b/c.txt", status: 200, pattern: "/files/*path",
+			params: map[string]string{"path": "a/b/c.txt"}},
+		{name: "static beats catch-all", method: "GET", path: "/files/readme", status: 200, pattern: "/files/readme"},
+		{name: "catch-all below static", method: "GET", path: "/files/readme/more", status: 200, pattern: "/files/*path",
+			params: map[string]string{"path": "readme/more"}},
+		{name: "HEAD answered by GET", method: "HEAD", path: "/lists/abc", status: 200, pattern: "/lists/:id", params: map[string]string{"id": "abc"}},
+		{name: "unknown path", method: "GET", path: "/nothing", status: 404},
+		{name: "too deep", method: "GET", path: "/lists/abc/items/def/ghi", status: 404},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := router.serve(tt.method, tt.path)
+			if rec.Code != tt.status {
+				t.Fatalf("%s %s returned %d, want %d", tt.method, tt.path, rec.Code, tt.status)
+			}
+			if tt.pattern == "" {
+				if router.served != nil {
+					t.Fatalf("%s %s reached %s, want no handler", tt.method, tt.path, GetRoutePattern(router.served))
+				}
+				return
+			}
+
+			if got := GetRoutePattern(router.served); got != tt.pattern {
+				t.Fatalf("%s %s matched %s, want %s", tt.method, tt.path, got, tt.pattern)
+			}
+			for name, want := range tt.params {
+				if got := GetPathParam(router.served, name); got != want {
+					t.Fatalf("%s %s param %s = %q, want %q", tt.method, tt.path, name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRouterAllow(t *testing.T) {
+	router := newTestRouter()
+	router.GET("/lists/:id", router.handler)
+	router.PUT("/lists/:id", router.handler)
+	router.DELETE("/lists/:id", router.handler)
+	router.POST("/lists", router.handler)
+	router.GET("/health", router.handler)
+	router.HEAD("/health", router.handler)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		status int
+		allow  string
+	}{
+		{name: "method not allowed", method: "POST", path: "/lists/abc", status: 405, allow: "DELETE, GET, HEAD, OPTIONS, PUT"},
+		{name: "automatic OPTIONS", method: "OPTIONS", path: "/lists/abc", status: 204, allow: "DELETE, GET, HEAD, OPTIONS, PUT"},
+		{name: "no HEAD without GET", method: "OPTIONS", path: "/lists", status: 204, allow: "OPTIONS, POST"},
+		{name: "explicit HEAD listed once", method: "OPTIONS", path: "/health", status: 204, allow: "GET, HEAD, OPTIONS"},
+		{name: "HEAD on a POST-only route", method: "HEAD", path: "/lists", status: 405, allow: "OPTIONS, POST"},
+		{name: "unknown path has no Allow", method: "OPTIONS", path: "/nothing", status: 404},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := router.serve(tt.method, tt.path)
+			if rec.Code != tt.status {
+				t.Fatalf("%s %s returned %d, want %d", tt.method, tt.path, rec.Code, tt.status)
+			}
+			if got := rec.Header().Get("Allow"); got != tt.allow {
+				t.Fatalf("%s %s Allow = %q, want %q", tt.method, tt.path, got, tt.allow)
+			}
+			if router.served != nil {
+				t.Fatalf("%s %s reached a route handler", tt.method, tt.path)
+			}
+		})
+	}
+}
+
+func TestRouterConflicts(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {}
+
+	tests := []struct {
+		name     string
+		existing string
+		pattern  string
+		method   string
+		panic    string
+	}{
+		{name: "param name conflict", existing: "/lists/:id", pattern: "/lists/:listId/items",
+			panic: "/lists/:listId/items conflicts with parameter :id"},
+		{name: "catch-all not last", pattern: "/files/*path/raw", panic: "catch-all must be the last segment in /files/*path/raw"},
+		{name: "catch-all name conflict", existing: "/files/*path", pattern: "/files/*rest",
+			panic: "/files/*rest conflicts with catch-all *path"},
+		{name: "duplicate method", existing: "/lists/:id", pattern: "/lists/:id",
+			panic: "GET /lists/:id is already registered"},
+		{name: "different method is fine", existing: "/lists/:id", pattern: "/lists/:id", method: http.MethodPut},
+		{name: "same param name is fine", existing: "/lists/:id", pattern: "/lists/:id/items"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := NewRouter()
+			if tt.existing != "" {
+				router.GET(tt.existing, handler)
+			}
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+
+			defer func() {
+				got := recover()
+				if tt.panic == "" {
+					if got != nil {
+						t.Fatalf("AddRoute panicked: %v", got)
+					}
+					return
+				}
+				if msg, _ := got.(string); !strings.Contains(msg, tt.panic) {
+					t.Fatalf("AddRoute panicked with %v, want %q", got, tt.panic)
+				}
+			}()
+			router.AddRoute(method, tt.pattern, handler)
+		})
+	}
+}
+
+// recordMiddleware returns middleware that appends name to order when it runs
+func recordMiddleware(order *[]string, name string) Middleware {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			*order = append(*order, name)
+			next(w, r)
+		}
+	}
+}
+
+func TestRouterMiddlewareOrder(t *testing.T) {
+	var order []string
+	router := NewRouter()
+	router.Use(recordMiddleware(&order, "router1"), recordMiddleware(&order, "router2"))
+	api := router.Group("/api", recordMiddleware(&order, "group"))
+	lists := api.Group("/lists", recordMiddleware(&order, "subgroup"))
+	lists.GET("/:id", func(w http.ResponseWriter, r *http.Request) {
+		order = append(order, "handler")
+	}, recordMiddleware(&order, "route1"), recordMiddleware(&order, "route2"))
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/lists/abc", nil))
+	if got, want := strings.Join(order, " "), "router1 router2 group subgroup route1 route2 handler"; got != want {
+		t.Fatalf("middleware ran in order %q, want %q", got, want)
+	}
+
+	// Router middleware also wraps the router's own responses
+	order = nil
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/nothing", nil))
+	if got, want := strings.Join(order, " "), "router1 router2"; got != want {
+		t.Fatalf("middleware for a 404 ran in order %q, want %q", got, want)
+	}
+
+	routes := router.Routes()
+	if len(routes) != 1 || len(routes[0].Middleware) != 6 {
+		t.Fatalf("Routes() = %+v, want one route with 6 middleware", routes)
+	}
+}
+
+func TestRouterUseAfterRoutes(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {}
+	middleware := func(next http.HandlerFunc) http.HandlerFunc { return next }
+
+	tests := []struct {
+		name  string
+		setup func(router *Router) *RouteGroup
+	}{
+		{name: "after a route", setup: func(router *Router) *RouteGroup {
+			router.GET("/lists", handler)
+			return router.RouteGroup
+		}},
+		{name: "after a subgroup", setup: func(router *Router) *RouteGroup {
+			router.Group("/api")
+			return router.RouteGroup
+		}},
+		{name: "on a group after its route", setup: func(router *Router) *RouteGroup {
+			group := router.Group("/api")
+			group.GET("/lists", handler)
+			return group
+		}},
+		{name: "after serving", setup: func(router *Router) *RouteGroup {
+			router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+			return router.RouteGroup
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			group := tt.setup(NewRouter())
+			defer func() {
+				if recover() == nil {
+					t.Fatalf("Use did not panic")
+				}
+			}()
+			group.Use(middleware)
+		})
+	}
+}
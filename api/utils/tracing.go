@@ -0,0 +1,112 @@
+package utils
+
+import (
+	"context"
+	"net/http"
+
+	"bryce-stabenow/grocer-me/tracing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.43.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// middlewareSpanKey is the context key for the span of the middleware
+// currently running, so it can be ended when the middleware calls next
+const middlewareSpanKey ContextKey = "middleware_span"
+
+// middlewareSpan pairs a middleware's span with the span it interrupted
+type middlewareSpan struct {
+	span   trace.Span
+	parent trace.Span
+}
+
+// startServerSpan continues the caller's trace from its W3C traceparent
+// header, or starts a new one, with a server span covering the request. The
+// span is named after the method until the router matches a route.
+func startServerSpan(w http.ResponseWriter, r *http.Request) (*spanRecorder, *http.Request) {
+	ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	ctx, span := tracing.Start(ctx, r.Method,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			semconv.HTTPRequestMethodKey.String(r.Method),
+			semconv.URLPath(r.URL.Path),
+		),
+	)
+	return &spanRecorder{ResponseWriter: w, span: span, status: http.StatusOK}, r.WithContext(ctx)
+}
+
+// nameServerSpan renames the request's span after the route it matched
+func nameServerSpan(r *http.Request, pattern string) {
+	span := trace.SpanFromContext(r.Context())
+	span.SetName(r.Method + " " + pattern)
+	span.SetAttributes(semconv.HTTPRoute(pattern))
+}
+
+// traceMiddleware records a span for the time a middleware spends before
+// handing off to the rest of the chain, or until it responds itself
+func traceMiddleware(name string, middleware Middleware) Middleware {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		// The rest of the chain runs under the span that was current before
+		inner := middleware(func(w http.ResponseWriter, r *http.Request) {
+			if current, ok := r.Context().Value(middlewareSpanKey).(middlewareSpan); ok {
+				current.span.End()
+				r = r.WithContext(trace.ContextWithSpan(r.Context(), current.parent))
+			}
+			next(w, r)
+		})
+
+		return func(w http.ResponseWriter, r *http.Request) {
+			parent := trace.SpanFromContext(r.Context())
+			ctx, span := tracing.Start(r.Context(), name)
+			defer span.End()
+
+			r = r.WithContext(context.WithValue(ctx, middlewareSpanKey, middlewareSpan{span: span, parent: parent}))
+			inner(w, r)
+		}
+	}
+}
+
+// spanRecorder records the response status on the request's server span
+type spanRecorder struct {
+	http.ResponseWriter
+	span        trace.Span
+	status      int
+	wroteHeader bool
+}
+
+func (rec *spanRecorder) WriteHeader(status int) {
+	if !rec.wroteHeader {
+		rec.status = status
+		rec.wroteHeader = true
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *spanRecorder) Write(b []byte) (int, error) {
+	rec.wroteHeader = true
+	return rec.ResponseWriter.Write(b)
+}
+
+// Flush keeps streaming responses such as server-sent events working
+func (rec *spanRecorder) Flush() {
+	if flusher, ok := rec.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (rec *spanRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// end records the status and ends the span; only server errors mark it failed
+func (rec *spanRecorder) end() {
+	rec.span.SetAttributes(semconv.HTTPResponseStatusCode(rec.status))
+	if rec.status >= http.StatusInternalServerError {
+		rec.span.SetStatus(codes.Error, http.StatusText(rec.status))
+	}
+	rec.span.End()
+}
@@ -0,0 +1,114 @@
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"bryce-stabenow/grocer-me/tracing"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/event"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// recordSpans installs a tracer provider that keeps spans in memory, and W3C
+// trace context propagation, for the rest of the test
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+
+	recorder := tracetest.NewSpanRecorder()
+	previous, propagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previous)
+		otel.SetTextMapPropagator(propagator)
+	})
+	return recorder
+}
+
+// authenticate is a middleware that hands off to the rest of the chain
+func authenticate(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		next(w, r)
+	}
+}
+
+func TestRouterTracing(t *testing.T) {
+	recorder := recordSpans(t)
+
+	// The handler runs a Mongo command under the request's context
+	monitor := tracing.MongoMonitor()
+	command, err := bson.Marshal(bson.D{{Key: "find", Value: "lists"}})
+	if err != nil {
+		t.Fatalf("Failed to marshal command: %v", err)
+	}
+	router := NewRouter()
+	router.Use(authenticate)
+	router.GET("/lists/:id", func(w http.ResponseWriter, r *http.Request) {
+		monitor.Started(r.Context(), &event.CommandStartedEvent{Command: command, DatabaseName: "test", CommandName: "find", RequestID: 1, ConnectionID: "conn"})
+		monitor.Succeeded(r.Context(), &event.CommandSucceededEvent{
+			CommandFinishedEvent: event.CommandFinishedEvent{CommandName: "find", RequestID: 1, ConnectionID: "conn"},
+		})
+		w.WriteHeader(http.StatusOK)
+	})
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	const callerSpanID = "00f067aa0ba902b7"
+	req := httptest.NewRequest(http.MethodGet, "/lists/abc", nil)
+	req.Header.Set("traceparent", "00-"+traceID+"-"+callerSpanID+"-01")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := make(map[string]sdktrace.ReadOnlySpan)
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+	if len(spans) != 3 {
+		t.Fatalf("recorded spans %v, want the request, its middleware and the command", names(recorder.Ended()))
+	}
+
+	// The server span continues the caller's trace and is named after the route
+	server, ok := spans["GET /lists/:id"]
+	if !ok {
+		t.Fatalf("no span named after the route among %v", names(recorder.Ended()))
+	}
+	if server.SpanKind() != trace.SpanKindServer || server.SpanContext().TraceID().String() != traceID ||
+		server.Parent().SpanID().String() != callerSpanID || !server.Parent().IsRemote() {
+		t.Fatalf("server span is %s in trace %s under %s, want a server span continuing the caller's trace",
+			server.SpanKind(), server.SpanContext().TraceID(), server.Parent().SpanID())
+	}
+	route := ""
+	for _, kv := range server.Attributes() {
+		if kv.Key == "http.route" {
+			route = kv.Value.AsString()
+		}
+	}
+	if route != "/lists/:id" {
+		t.Fatalf("server span has http.route %q, want /lists/:id", route)
+	}
+
+	// Middleware and the command are recorded beneath it
+	for _, name := range []string{"utils.authenticate", "find lists"} {
+		child, ok := spans[name]
+		if !ok {
+			t.Fatalf("no %q span among %v", name, names(recorder.Ended()))
+		}
+		if child.Parent().SpanID() != server.SpanContext().SpanID() || child.SpanContext().TraceID() != server.SpanContext().TraceID() {
+			t.Fatalf("%q span is not a child of the server span", name)
+		}
+	}
+}
+
+// names lists the names of spans
+func names(spans []sdktrace.ReadOnlySpan) []string {
+	names := make([]string, len(spans))
+	for i, span := range spans {
+		names[i] = span.Name()
+	}
+	return names
+}
@@ -0,0 +1,323 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// FieldError describes a single field that failed validation
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// ValidationError is returned when a request body fails validation
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Fields))
+	for i, field := range e.Fields {
+		messages[i] = field.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Validate checks a struct against the rules in its binding tags. Supported
+// rules are required, email, min, max, oneof and omitempty; fields are
+// reported by their JSON names. It returns a *ValidationError if any fail.
+// A malformed tag anywhere in v's type is returned as a plain error before
+// any value is checked; use CheckBindings at startup to catch those early.
+func Validate(v interface{}) error {
+	if err := checkBindings(reflect.TypeOf(v)); err != nil {
+		return err
+	}
+
+	var fields []FieldError
+	validateValue(reflect.ValueOf(v), "", &fields)
+	if len(fields) > 0 {
+		return &ValidationError{Fields: fields}
+	}
+	return nil
+}
+
+// IsValidationError reports whether err is a *ValidationError, returning it
+func IsValidationError(err error) (*ValidationError, bool) {
+	var validationErr *ValidationError
+	ok := errors.As(err, &validationErr)
+	return validationErr, ok
+}
+
+// CheckBindings verifies the binding tags of each value's type name known
+// rules with usable parameters, so a typo is found when the server starts
+// rather than when a request is validated
+func CheckBindings(values ...interface{}) error {
+	for _, v := range values {
+		if err := checkBindings(reflect.TypeOf(v)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkedTypes caches the result of checking each type's binding tags
+var checkedTypes sync.Map // reflect.Type -> error
+
+// checkBindings verifies every binding tag reachable from t names a known
+// rule with a usable parameter for its field's type
+func checkBindings(t reflect.Type) error {
+	if t == nil {
+		return nil
+	}
+	if err, ok := checkedTypes.Load(t); ok {
+		if err == nil {
+			return nil
+		}
+		return err.(error)
+	}
+
+	err := checkTypeBindings(t, make(map[reflect.Type]bool))
+	checkedTypes.Store(t, err)
+	return err
+}
+
+// checkTypeBindings walks t like validateValue, checking tags instead of values
+func checkTypeBindings(t reflect.Type, seen map[reflect.Type]bool) error {
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Array:
+		return checkTypeBindings(t.Elem(), seen)
+	case reflect.Struct:
+		if seen[t] {
+			return nil
+		}
+		seen[t] = true
+
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			if tag, ok := field.Tag.Lookup("binding"); ok {
+				if err := checkTag(field.Type, tag); err != nil {
+					return fmt.Errorf("utils: %s.%s: %w", t.Name(), field.Name, err)
+				}
+			}
+			if err := checkTypeBindings(field.Type, seen); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checkTag verifies each rule in a binding tag applies to a field of type t
+func checkTag(t reflect.Type, tag string) error {
+	// Rules apply to the value a pointer refers to
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	for _, rule := range strings.Split(tag, ",") {
+		rule, param, _ := strings.Cut(rule, "=")
+		switch rule {
+		case "omitempty", "required":
+			if param != "" {
+				return fmt.Errorf("%s rule takes no parameter", rule)
+			}
+		case "email":
+			if t.Kind() != reflect.String {
+				return fmt.Errorf("email rule does not apply to %s", t.Kind())
+			}
+		case "min", "max":
+			if _, err := strconv.ParseFloat(param, 64); err != nil {
+				return fmt.Errorf("invalid %s parameter %q", rule, param)
+			}
+			switch t.Kind() {
+			case reflect.String, reflect.Slice, reflect.Array, reflect.Map,
+				reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+				reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+				reflect.Float32, reflect.Float64:
+			default:
+				return fmt.Errorf("%s rule does not apply to %s", rule, t.Kind())
+			}
+		case "oneof":
+			if len(strings.Fields(param)) == 0 {
+				return errors.New("oneof rule needs at least one option")
+			}
+		default:
+			return fmt.Errorf("unknown binding rule %q", rule)
+		}
+	}
+	return nil
+}
+
+// validateValue walks structs, pointers and slices, checking each field's rules
+func validateValue(v reflect.Value, path string, fields *[]FieldError) {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !v.IsNil() {
+			validateValue(v.Elem(), path, fields)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			validateValue(v.Index(i), fmt.Sprintf("%s[%d]", path, i), fields)
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+
+			name := jsonFieldName(field)
+			if name == "-" {
+				continue
+			}
+			if path != "" {
+				name = path + "." + name
+			}
+
+			value := v.Field(i)
+			if tag, ok := field.Tag.Lookup("binding"); ok {
+				if fieldErr := checkRules(value, name, tag); fieldErr != nil {
+					*fields = append(*fields, *fieldErr)
+					continue
+				}
+			}
+			validateValue(value, name, fields)
+		}
+	}
+}
+
+// checkRules applies a field's binding rules in order, returning the first failure
+func checkRules(v reflect.Value, name, tag string) *FieldError {
+	rules := strings.Split(tag, ",")
+
+	// omitempty skips the remaining rules when the field wasn't supplied
+	if isEmpty(v) {
+		for _, rule := range rules {
+			switch rule {
+			case "omitempty":
+				return nil
+			case "required":
+				return &FieldError{Field: name, Rule: "required", Message: fmt.Sprintf("%s is required", fieldLabel(name))}
+			}
+		}
+	}
+
+	// Remaining rules apply to the value a pointer refers to
+	for v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+
+	for _, rule := range rules {
+		rule, param, _ := strings.Cut(rule, "=")
+		switch rule {
+		case "omitempty", "required":
+			// Handled above
+		case "email":
+			if !isEmail(v.String()) {
+				return &FieldError{Field: name, Rule: rule, Message: fmt.Sprintf("%s must be a valid email address", fieldLabel(name))}
+			}
+		case "min", "max":
+			if msg, ok := checkBound(v, rule, param); !ok {
+				return &FieldError{Field: name, Rule: rule, Message: fmt.Sprintf("%s must %s", fieldLabel(name), msg)}
+			}
+		case "oneof":
+			options := strings.Fields(param)
+			if !containsString(options, fmt.Sprint(v.Interface())) {
+				return &FieldError{Field: name, Rule: rule, Message: fmt.Sprintf("%s must be one of: %s", fieldLabel(name), strings.Join(options, ", "))}
+			}
+		default:
+			panic(fmt.Sprintf("utils: unknown binding rule %q on field %s", rule, name))
+		}
+	}
+
+	return nil
+}
+
+// checkBound applies a min or max rule, returning a description of the bound on failure.
+// Strings are measured in characters, slices and maps in elements, numbers by value.
+func checkBound(v reflect.Value, rule, param string) (string, bool) {
+	limit, err := strconv.ParseFloat(param, 64)
+	if err != nil {
+		panic(fmt.Sprintf("utils: invalid %s parameter %q", rule, param))
+	}
+
+	var size float64
+	var unit string
+	switch v.Kind() {
+	case reflect.String:
+		size, unit = float64(len([]rune(v.String()))), " characters"
+	case reflect.Slice, reflect.Array, reflect.Map:
+		size, unit = float64(v.Len()), " items"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		size = float64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		size = float64(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		size = v.Float()
+	default:
+		panic(fmt.Sprintf("utils: %s rule does not apply to %s", rule, v.Kind()))
+	}
+
+	if rule == "min" && size < limit {
+		return "be at least " + param + unit, false
+	}
+	if rule == "max" && size > limit {
+		return "be at most " + param + unit, false
+	}
+	return "", true
+}
+
+// isEmpty reports whether a field was left unset; whitespace-only strings count as empty
+func isEmpty(v reflect.Value) bool {
+	if v.Kind() == reflect.String {
+		return strings.TrimSpace(v.String()) == ""
+	}
+	return v.IsZero()
+}
+
+// isEmail reports whether s is a bare email address such as user@example.com
+func isEmail(s string) bool {
+	addr, err := mail.ParseAddress(s)
+	return err == nil && addr.Address == s && strings.Contains(s[strings.LastIndex(s, "@"):], ".")
+}
+
+// jsonFieldName returns the name a struct field is encoded as in JSON
+func jsonFieldName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
+
+// fieldLabel turns a JSON field path such as "first_name" into "First name"
+func fieldLabel(name string) string {
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		name = name[i+1:]
+	}
+	label := strings.ReplaceAll(name, "_", " ")
+	if label == "" {
+		return label
+	}
+	return strings.ToUpper(label[:1]) + label[1:]
+}
+
+func containsString(values []string, s string) bool {
+	for _, value := range values {
+		if value == s {
+			return true
+		}
+	}
+	return false
+}
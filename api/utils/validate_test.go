@@ -0,0 +1,173 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+
+	"bryce-stabenow/grocer-me/models"
+)
+
+type ruleTestRequest struct {
+	Email    string   `json:"email,omitempty" binding:"omitempty,email"`
+	Name     string   `json:"name,omitempty" binding:"omitempty,min=2,max=4"`
+	Count    int      `json:"count,omitempty" binding:"omitempty,min=2,max=4"`
+	Tags     []string `json:"tags,omitempty" binding:"omitempty,max=2"`
+	Color    string   `json:"color,omitempty" binding:"omitempty,oneof=red green"`
+	Limit    *int     `json:"limit,omitempty" binding:"omitempty,min=0"`
+	Note     *string  `json:"note,omitempty" binding:"omitempty,max=3"`
+	Required string   `json:"required_field" binding:"required"`
+}
+
+func intPtr(n int) *int          { return &n }
+func stringPtr(s string) *string { return &s }
+
+func TestValidateRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		req     ruleTestRequest
+		field   string
+		rule    string
+		message string
+	}{
+		{name: "valid", req: ruleTestRequest{Email: "a@example.com", Name: "Ann", Count: 3, Color: "red"}},
+		{name: "required missing", req: ruleTestRequest{Required: ""}, field: "required_field", rule: "required", message: "Required field is required"},
+		{name: "required whitespace", req: ruleTestRequest{Required: "  "}, field: "required_field", rule: "required"},
+		{name: "email invalid", req: ruleTestRequest{Email: "not-an-email"}, field: "email", rule: "email", message: "Email must be a valid email address"},
+		{name: "email without domain dot", req: ruleTestRequest{Email: "a@localhost"}, field: "email", rule: "email"},
+		{name: "email with display name", req: ruleTestRequest{Email: "Ann <a@example.com>"}, field: "email", rule: "email"},
+		{name: "string min counts characters", req: ruleTestRequest{Name: "é"}, field: "name", rule: "min", message: "Name must be at least 2 characters"},
+		{name: "string max counts characters", req: ruleTestRequest{Name: "éééé"}},
+		{name: "string max", req: ruleTestRequest{Name: "Annie"}, field: "name", rule: "max", message: "Name must be at most 4 characters"},
+		{name: "int min", req: ruleTestRequest{Count: 1}, field: "count", rule: "min", message: "Count must be at least 2"},
+		{name: "int max", req: ruleTestRequest{Count: 5}, field: "count", rule: "max", message: "Count must be at most 4"},
+		{name: "int zero is omitted", req: ruleTestRequest{Count: 0}},
+		{name: "slice max", req: ruleTestRequest{Tags: []string{"a", "b", "c"}}, field: "tags", rule: "max", message: "Tags must be at most 2 items"},
+		{name: "oneof", req: ruleTestRequest{Color: "blue"}, field: "color", rule: "oneof", message: "Color must be one of: red, green"},
+		{name: "nil pointer is omitted", req: ruleTestRequest{Limit: nil, Note: nil}},
+		{name: "pointer to zero is checked", req: ruleTestRequest{Limit: intPtr(0)}},
+		{name: "pointer min", req: ruleTestRequest{Limit: intPtr(-1)}, field: "limit", rule: "min"},
+		{name: "pointer to empty string is checked", req: ruleTestRequest{Note: stringPtr("")}},
+		{name: "pointer max", req: ruleTestRequest{Note: stringPtr("long")}, field: "note", rule: "max"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.req.Required == "" && tt.field != "required_field" {
+				tt.req.Required = "set"
+			}
+
+			err := Validate(&tt.req)
+			if tt.field == "" {
+				if err != nil {
+					t.Fatalf("Validate() = %v, want nil", err)
+				}
+				return
+			}
+
+			validationErr, ok := IsValidationError(err)
+			if !ok || len(validationErr.Fields) != 1 {
+				t.Fatalf("Validate() = %v, want one failure on %s", err, tt.field)
+			}
+			got := validationErr.Fields[0]
+			if got.Field != tt.field || got.Rule != tt.rule {
+				t.Fatalf("Validate() failed %s on %s, want %s on %s", got.Rule, got.Field, tt.rule, tt.field)
+			}
+			if tt.message != "" && got.Message != tt.message {
+				t.Fatalf("Validate() message = %q, want %q", got.Message, tt.message)
+			}
+		})
+	}
+}
+
+func TestValidateNested(t *testing.T) {
+	type item struct {
+		Name string `json:"name" binding:"required"`
+	}
+	type request struct {
+		Items []item `json:"items"`
+		Owner *item  `json:"owner"`
+	}
+
+	err := Validate(&request{Items: []item{{Name: "a"}, {}}, Owner: &item{}})
+	validationErr, ok := IsValidationError(err)
+	if !ok {
+		t.Fatalf("Validate() = %v, want a validation error", err)
+	}
+	var fields []string
+	for _, field := range validationErr.Fields {
+		fields = append(fields, field.Field)
+	}
+	if got := strings.Join(fields, " "); got != "items[1].name owner.name" {
+		t.Fatalf("Validate() failed fields %q, want items[1].name owner.name", got)
+	}
+}
+
+func TestCheckBindings(t *testing.T) {
+	tests := []struct {
+		name string
+		v    interface{}
+		err  string
+	}{
+		{name: "unknown rule", v: struct {
+			Name string `binding:"requried"`
+		}{}, err: `unknown binding rule "requried"`},
+		{name: "unknown rule behind omitempty", v: struct {
+			Name string `binding:"omitempty,emial"`
+		}{}, err: `unknown binding rule "emial"`},
+		{name: "bad min parameter", v: struct {
+			Count int `binding:"min=two"`
+		}{}, err: `invalid min parameter "two"`},
+		{name: "max on a bool", v: struct {
+			On bool `binding:"max=1"`
+		}{}, err: "max rule does not apply to bool"},
+		{name: "email on an int", v: struct {
+			Email int `binding:"email"`
+		}{}, err: "email rule does not apply to int"},
+		{name: "empty oneof", v: struct {
+			Color string `binding:"oneof="`
+		}{}, err: "oneof rule needs at least one option"},
+		{name: "nested field", v: struct {
+			Items []struct {
+				Name string `binding:"requird"`
+			}
+		}{}, err: `unknown binding rule "requird"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckBindings(tt.v)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("CheckBindings() = %v, want %q", err, tt.err)
+			}
+
+			// Validate reports the bad tag before any rule is reached, not as a failed field
+			err = Validate(tt.v)
+			if _, ok := IsValidationError(err); ok || err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("Validate() = %v, want the tag error %q", err, tt.err)
+			}
+		})
+	}
+}
+
+// TestRequestModelBindings checks the binding tags on every request model,
+// so a malformed rule fails here before the server refuses to start
+func TestRequestModelBindings(t *testing.T) {
+	requests := []interface{}{
+		models.SignupRequest{},
+		models.SigninRequest{},
+		models.RefreshTokenRequest{},
+		models.CreateListRequest{},
+		models.UpdateListRequest{},
+		models.AddListItemRequest{},
+		models.UpdateListItemRequest{},
+		models.UpdateListItemCheckedRequest{},
+		models.UpdateCollaboratorRequest{},
+		models.TransferOwnershipRequest{},
+		models.CreateInviteRequest{},
+		models.ForgotPasswordRequest{},
+		models.ResetPasswordRequest{},
+	}
+	if err := CheckBindings(requests...); err != nil {
+		t.Fatal(err)
+	}
+}
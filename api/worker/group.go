@@ -0,0 +1,68 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrClosed is returned by Go once shutdown has started
+var ErrClosed = errors.New("worker group is shutting down")
+
+// Group runs background tasks, such as sending email, that outlive the
+// request that started them, so shutdown can wait for them to finish
+type Group struct {
+	mu     sync.Mutex
+	wg     sync.WaitGroup
+	closed bool
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewGroup creates an empty group
+func NewGroup() *Group {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Group{ctx: ctx, cancel: cancel}
+}
+
+// Go runs task in the background. Its context is cancelled if shutdown gives
+// up waiting. Once shutdown has started, task is not run and ErrClosed is
+// returned.
+func (g *Group) Go(task func(ctx context.Context)) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.closed {
+		return ErrClosed
+	}
+
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		task(g.ctx)
+	}()
+	return nil
+}
+
+// Shutdown stops accepting tasks and waits for running ones to finish. If
+// ctx ends first, running tasks are cancelled and ctx's error is returned.
+func (g *Group) Shutdown(ctx context.Context) error {
+	g.mu.Lock()
+	g.closed = true
+	g.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		g.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		g.cancel()
+		return nil
+	case <-ctx.Done():
+		g.cancel()
+		return ctx.Err()
+	}
+}
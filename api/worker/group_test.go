@@ -0,0 +1,85 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestShutdownWaitsForTasks(t *testing.T) {
+	group := NewGroup()
+	release := make(chan struct{})
+	finished := make(chan error, 1)
+	err := group.Go(func(ctx context.Context) {
+		<-release
+		finished <- ctx.Err()
+	})
+	if err != nil {
+		t.Fatalf("Go: %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- group.Shutdown(context.Background()) }()
+
+	select {
+	case err := <-done:
+		t.Fatalf("Shutdown returned %v while a task was running", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// Tasks run to completion with a live context
+	close(release)
+	if err := <-finished; err != nil {
+		t.Fatalf("task's context ended early: %v", err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Shutdown: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Shutdown didn't return once the task finished")
+	}
+}
+
+func TestShutdownDeadline(t *testing.T) {
+	group := NewGroup()
+	cancelled := make(chan struct{})
+	err := group.Go(func(ctx context.Context) {
+		<-ctx.Done()
+		close(cancelled)
+	})
+	if err != nil {
+		t.Fatalf("Go: %v", err)
+	}
+
+	// Giving up on a task cancels it and reports why
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := group.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Shutdown = %v, want %v", err, context.DeadlineExceeded)
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatalf("task not cancelled when shutdown gave up")
+	}
+}
+
+func TestGoAfterShutdown(t *testing.T) {
+	group := NewGroup()
+	if err := group.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+
+	ran := make(chan struct{}, 1)
+	if err := group.Go(func(ctx context.Context) { ran <- struct{}{} }); !errors.Is(err, ErrClosed) {
+		t.Fatalf("Go after Shutdown = %v, want %v", err, ErrClosed)
+	}
+	select {
+	case <-ran:
+		t.Fatalf("task ran after Shutdown")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -1,7 +1,38 @@
+import { appendResponseHeader } from "h3";
+
+/**
+ * Apply Set-Cookie headers to a Cookie request header, so server-side requests
+ * made later in the same render use freshly issued tokens
+ */
+const mergeCookies = (cookieHeader: string, setCookies: string[]): string => {
+  const cookies = new Map<string, string>();
+  for (const part of cookieHeader.split(";")) {
+    const [name, ...value] = part.trim().split("=");
+    if (name) cookies.set(name, value.join("="));
+  }
+  for (const setCookie of setCookies) {
+    const [pair] = setCookie.split(";");
+    const [name, ...value] = pair.trim().split("=");
+    if (!name) continue;
+    if (value.join("=") === "") {
+      cookies.delete(name);
+    } else {
+      cookies.set(name, value.join("="));
+    }
+  }
+  return [...cookies].map(([name, value]) => `${name}=${value}`).join("; ");
+};
+
 export const useAuth = () => {
   const config = useRuntimeConfig();
   const apiUrl = config.public.apiUrl;
 
+  // Captured up front since composables can't be called after an await
+  const event = process.server ? useRequestEvent() : undefined;
+  const requestCookie = process.server
+    ? useRequestHeaders(["cookie"]).cookie
+    : undefined;
+
   // Reactive state
   const isAuthenticated = useState<boolean>(
     "auth.isAuthenticated",
@@ -9,6 +40,7 @@ export const useAuth = () => {
   );
   const user = useState<any>("auth.user", () => null);
   const isLoading = useState<boolean>("auth.isLoading", () => false);
+  const csrfToken = useState<string>("auth.csrfToken", () => "");
 
   // Cache timestamp to avoid repeated calls
   const lastCheck = useState<number>("auth.lastCheck", () => 0);
@@ -18,6 +50,105 @@ export const useAuth = () => {
    * Check if user is authenticated by calling the /me endpoint
    * Uses cache if available and not expired
    */
+  /**
+   * Get headers with cookie forwarding for server-side requests, preferring
+   * tokens refreshed earlier in this request
+   */
+  const getHeaders = (): Record<string, string> => {
+    const headers: Record<string, string> = {};
+    if (process.server) {
+      const cookie = event?.context.authCookie ?? requestCookie;
+      if (cookie) {
+        headers.cookie = cookie;
+      }
+    }
+    return headers;
+  };
+
+  /**
+   * Exchange the refresh token cookie for a new access token. On the server
+   * the new cookies are passed on to the browser.
+   */
+  const refreshSession = async (): Promise<boolean> => {
+    try {
+      const response = await $fetch.raw(`${apiUrl}/token/refresh`, {
+        method: "POST",
+        credentials: "include",
+        headers: getHeaders(),
+        retry: false,
+      });
+
+      if (process.server && event) {
+        const setCookies = response.headers.getSetCookie();
+        for (const setCookie of setCookies) {
+          appendResponseHeader(event, "set-cookie", setCookie);
+        }
+        event.context.authCookie = mergeCookies(
+          getHeaders().cookie ?? "",
+          setCookies
+        );
+      }
+      return true;
+    } catch (error) {
+      return false;
+    }
+  };
+
+  /**
+   * Fetch the CSRF token for the current session, which state-changing
+   * requests must echo back since they are authenticated by cookie
+   */
+  const fetchCsrfToken = async (): Promise<string> => {
+    const response = await $fetch<{ csrf_token: string }>(
+      `${apiUrl}/csrf-token`,
+      { credentials: "include", headers: getHeaders(), retry: false }
+    );
+    csrfToken.value = response.csrf_token;
+    return response.csrf_token;
+  };
+
+  /**
+   * Make an API request, refreshing the session and retrying once if the
+   * access token has expired, and attaching the CSRF token to requests that
+   * change state
+   */
+  const apiFetch = async <T>(url: string, options: any = {}): Promise<T> => {
+    const method = (options.method ?? "GET").toUpperCase();
+    const needsCsrf = !["GET", "HEAD", "OPTIONS"].includes(method);
+
+    const request = async () => {
+      const headers: Record<string, string> = {
+        ...getHeaders(),
+        ...options.headers,
+      };
+      if (needsCsrf) {
+        headers["X-CSRF-Token"] = csrfToken.value || (await fetchCsrfToken());
+      }
+      return await $fetch<T>(url, {
+        credentials: "include",
+        ...options,
+        headers,
+      });
+    };
+
+    try {
+      return await request();
+    } catch (error: any) {
+      // The token belongs to a session, so a new sign-in needs a new one
+      if (
+        error?.statusCode === 403 &&
+        error?.data?.code === "CSRF_TOKEN_INVALID"
+      ) {
+        csrfToken.value = "";
+        return await request();
+      }
+      if (error?.statusCode !== 401 || !(await refreshSession())) {
+        throw error;
+      }
+      return await request();
+    }
+  };
+
   const checkAuth = async (force = false): Promise<boolean> => {
     // On server side, don't use cache - always check for security
     // On client side, use cache to avoid repeated calls
@@ -35,19 +166,9 @@ export const useAuth = () => {
     isLoading.value = true;
 
     try {
-      // On server side, we need to forward cookies from the request
-      const headers: Record<string, string> = {};
-      if (process.server) {
-        const requestHeaders = useRequestHeaders(["cookie"]);
-        if (requestHeaders.cookie) {
-          headers.cookie = requestHeaders.cookie;
-        }
-      }
-
-      const userData = await $fetch(`${apiUrl}/me`, {
+      // Expired access tokens are refreshed transparently
+      const userData = await apiFetch(`${apiUrl}/me`, {
         method: "GET",
-        credentials: "include",
-        headers,
         retry: false,
       });
 
@@ -74,6 +195,7 @@ export const useAuth = () => {
     isAuthenticated.value = false;
     user.value = null;
     lastCheck.value = 0;
+    csrfToken.value = "";
   };
 
   /**
@@ -83,19 +205,23 @@ export const useAuth = () => {
     isLoading.value = true;
 
     try {
-      // On server side, we need to forward cookies from the request
-      const headers: Record<string, string> = {};
-      if (process.server) {
-        const requestHeaders = useRequestHeaders(["cookie"]);
-        if (requestHeaders.cookie) {
-          headers.cookie = requestHeaders.cookie;
-        }
-      }
+      await apiFetch(`${apiUrl}/logout`, { method: "POST", retry: false });
+    } catch (error) {
+    } finally {
+      clearAuth();
+      isLoading.value = false;
+    }
+  };
 
-      await $fetch(`${apiUrl}/logout`, {
+  /**
+   * Sign out of every device by revoking all of the user's sessions
+   */
+  const logoutAll = async (): Promise<void> => {
+    isLoading.value = true;
+
+    try {
+      await apiFetch(`${apiUrl}/logout/all`, {
         method: "POST",
-        credentials: "include",
-        headers,
         retry: false,
       });
     } catch (error) {
@@ -105,6 +231,13 @@ export const useAuth = () => {
     }
   };
 
+  /**
+   * Email a fresh verification link to the current user
+   */
+  const resendVerification = async (): Promise<void> => {
+    await apiFetch(`${apiUrl}/verify-email/resend`, { method: "POST" });
+  };
+
   /**
    * Refresh authentication state (force check)
    */
@@ -119,6 +252,10 @@ export const useAuth = () => {
     checkAuth,
     clearAuth,
     refreshAuth,
+    refreshSession,
+    apiFetch,
     logout,
+    logoutAll,
+    resendVerification,
   };
 };
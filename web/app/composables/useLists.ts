@@ -2,7 +2,11 @@ export const useLists = () => {
   const config = useRuntimeConfig();
   const apiUrl = config.public.apiUrl;
 
+  // Requests forward cookies during SSR and refresh expired sessions
+  const { apiFetch, refreshSession } = useAuth();
+
   interface ListItem {
+    id: string;
     name: string;
     quantity: number;
     checked: boolean;
@@ -11,17 +15,43 @@ export const useLists = () => {
     added_at: string;
   }
 
+  type Role = "owner" | "editor" | "viewer";
+
+  interface SharedUser {
+    id: string;
+    email: string;
+    role: Role;
+  }
+
   interface List {
     id: string;
     user_id: string;
     name: string;
     description?: string;
     items: ListItem[];
-    shared_with: string[];
+    shared_with: SharedUser[];
+    version: number;
     created_at: string;
     updated_at: string;
   }
 
+  interface Invite {
+    id: string;
+    list_id: string;
+    token?: string;
+    role: Role;
+    max_uses: number;
+    uses: number;
+    expires_at: string;
+    created_at: string;
+  }
+
+  interface CreateInviteRequest {
+    role?: "editor" | "viewer";
+    max_uses?: number;
+    expires_in_hours?: number;
+  }
+
   interface CreateListRequest {
     name: string;
     description?: string;
@@ -39,35 +69,15 @@ export const useLists = () => {
   }
 
   interface UpdateListItemCheckedRequest {
-    index: number;
     checked: boolean;
   }
 
   interface UpdateListItemRequest {
-    index: number;
     name?: string;
     quantity?: number;
     details?: string;
   }
 
-  interface DeleteListItemRequest {
-    index: number;
-  }
-
-  /**
-   * Get headers with cookie forwarding for server-side requests
-   */
-  const getHeaders = (): Record<string, string> => {
-    const headers: Record<string, string> = {};
-    if (process.server) {
-      const requestHeaders = useRequestHeaders(["cookie"]);
-      if (requestHeaders.cookie) {
-        headers.cookie = requestHeaders.cookie;
-      }
-    }
-    return headers;
-  };
-
   /**
    * Create a new list
    */
@@ -80,10 +90,9 @@ export const useLists = () => {
       body.description = description;
     }
 
-    return await $fetch<List>(`${apiUrl}/lists`, {
+    return await apiFetch<List>(`${apiUrl}/lists`, {
       method: "POST",
       credentials: "include",
-      headers: getHeaders(),
       body,
     });
   };
@@ -92,10 +101,9 @@ export const useLists = () => {
    * Get all lists for the authenticated user
    */
   const getLists = async (): Promise<List[]> => {
-    return await $fetch<List[]>(`${apiUrl}/lists`, {
+    return await apiFetch<List[]>(`${apiUrl}/lists`, {
       method: "GET",
       credentials: "include",
-      headers: getHeaders(),
     });
   };
 
@@ -103,10 +111,9 @@ export const useLists = () => {
    * Get a single list by ID
    */
   const getList = async (id: string): Promise<List> => {
-    return await $fetch<List>(`${apiUrl}/lists/${id}`, {
+    return await apiFetch<List>(`${apiUrl}/lists/${id}`, {
       method: "GET",
       credentials: "include",
-      headers: getHeaders(),
     });
   };
 
@@ -117,10 +124,9 @@ export const useLists = () => {
     id: string,
     updates: UpdateListRequest
   ): Promise<List> => {
-    return await $fetch<List>(`${apiUrl}/lists/${id}`, {
+    return await apiFetch<List>(`${apiUrl}/lists/${id}`, {
       method: "PUT",
       credentials: "include",
-      headers: getHeaders(),
       body: updates,
     });
   };
@@ -132,10 +138,9 @@ export const useLists = () => {
     listId: string,
     item: AddListItemRequest
   ): Promise<List> => {
-    return await $fetch<List>(`${apiUrl}/lists/${listId}/items`, {
+    return await apiFetch<List>(`${apiUrl}/lists/${listId}/items`, {
       method: "POST",
       credentials: "include",
-      headers: getHeaders(),
       body: item,
     });
   };
@@ -145,18 +150,19 @@ export const useLists = () => {
    */
   const updateListItemChecked = async (
     listId: string,
-    itemIndex: number,
+    itemId: string,
     checked: boolean
   ): Promise<List> => {
-    return await $fetch<List>(`${apiUrl}/lists/${listId}/items/checked`, {
-      method: "PUT",
-      credentials: "include",
-      headers: getHeaders(),
-      body: {
-        index: itemIndex,
-        checked,
-      } as UpdateListItemCheckedRequest,
-    });
+    return await apiFetch<List>(
+      `${apiUrl}/lists/${listId}/items/${itemId}/checked`,
+      {
+        method: "PUT",
+        credentials: "include",
+        body: {
+          checked,
+        } as UpdateListItemCheckedRequest,
+      }
+    );
   };
 
   /**
@@ -164,17 +170,13 @@ export const useLists = () => {
    */
   const updateListItem = async (
     listId: string,
-    itemIndex: number,
-    updates: { name?: string; quantity?: number; details?: string }
+    itemId: string,
+    updates: UpdateListItemRequest
   ): Promise<List> => {
-    return await $fetch<List>(`${apiUrl}/lists/${listId}/items`, {
+    return await apiFetch<List>(`${apiUrl}/lists/${listId}/items/${itemId}`, {
       method: "PUT",
       credentials: "include",
-      headers: getHeaders(),
-      body: {
-        index: itemIndex,
-        ...updates,
-      } as UpdateListItemRequest,
+      body: updates,
     });
   };
 
@@ -183,15 +185,11 @@ export const useLists = () => {
    */
   const deleteListItem = async (
     listId: string,
-    itemIndex: number
+    itemId: string
   ): Promise<List> => {
-    return await $fetch<List>(`${apiUrl}/lists/${listId}/items`, {
+    return await apiFetch<List>(`${apiUrl}/lists/${listId}/items/${itemId}`, {
       method: "DELETE",
       credentials: "include",
-      headers: getHeaders(),
-      body: {
-        index: itemIndex,
-      } as DeleteListItemRequest,
     });
   };
 
@@ -199,24 +197,169 @@ export const useLists = () => {
    * Delete a list
    */
   const deleteList = async (listId: string): Promise<void> => {
-    return await $fetch<void>(`${apiUrl}/lists/${listId}`, {
+    return await apiFetch<void>(`${apiUrl}/lists/${listId}`, {
       method: "DELETE",
       credentials: "include",
-      headers: getHeaders(),
     });
   };
 
   /**
-   * Share a list - adds the current user to the list's shared_with array
+   * Create an invite token for a list (owner only)
    */
-  const shareList = async (listId: string): Promise<List> => {
-    return await $fetch<List>(`${apiUrl}/lists/share/${listId}`, {
+  const createInvite = async (
+    listId: string,
+    options: CreateInviteRequest = {}
+  ): Promise<Invite> => {
+    return await apiFetch<Invite>(`${apiUrl}/lists/${listId}/invites`, {
       method: "POST",
       credentials: "include",
-      headers: getHeaders(),
+      body: options,
+    });
+  };
+
+  /**
+   * Get a list's outstanding invites (owner only)
+   */
+  const getInvites = async (listId: string): Promise<Invite[]> => {
+    return await apiFetch<Invite[]>(`${apiUrl}/lists/${listId}/invites`, {
+      method: "GET",
+      credentials: "include",
     });
   };
 
+  /**
+   * Revoke an outstanding invite (owner only)
+   */
+  const revokeInvite = async (
+    listId: string,
+    inviteId: string
+  ): Promise<void> => {
+    return await apiFetch<void>(
+      `${apiUrl}/lists/${listId}/invites/${inviteId}`,
+      {
+        method: "DELETE",
+        credentials: "include",
+      }
+    );
+  };
+
+  /**
+   * Change a collaborator's role on a list (owner only)
+   */
+  const updateCollaboratorRole = async (
+    listId: string,
+    userId: string,
+    role: "editor" | "viewer"
+  ): Promise<List> => {
+    return await apiFetch<List>(
+      `${apiUrl}/lists/${listId}/collaborators/${userId}`,
+      {
+        method: "PUT",
+        credentials: "include",
+        body: { role },
+      }
+    );
+  };
+
+  /**
+   * Remove a collaborator from a list (owner only)
+   */
+  const removeCollaborator = async (
+    listId: string,
+    userId: string
+  ): Promise<List> => {
+    return await apiFetch<List>(
+      `${apiUrl}/lists/${listId}/collaborators/${userId}`,
+      {
+        method: "DELETE",
+        credentials: "include",
+      }
+    );
+  };
+
+  /**
+   * Leave a list that has been shared with the current user
+   */
+  const leaveList = async (listId: string): Promise<void> => {
+    return await apiFetch<void>(`${apiUrl}/lists/${listId}/leave`, {
+      method: "POST",
+      credentials: "include",
+    });
+  };
+
+  /**
+   * Hand ownership of a list to an existing collaborator (owner only)
+   */
+  const transferOwnership = async (
+    listId: string,
+    userId: string
+  ): Promise<List> => {
+    return await apiFetch<List>(`${apiUrl}/lists/${listId}/transfer`, {
+      method: "POST",
+      credentials: "include",
+      body: { user_id: userId },
+    });
+  };
+
+  /**
+   * Join a list using an invite token - adds the current user to the list's shared_with array
+   */
+  const shareList = async (token: string): Promise<List> => {
+    return await apiFetch<List>(`${apiUrl}/lists/share/${token}`, {
+      method: "POST",
+      credentials: "include",
+    });
+  };
+
+  /**
+   * Subscribe to real-time changes to a list. Returns a function that closes the stream.
+   */
+  const subscribeToList = (
+    listId: string,
+    onChange: (event: MessageEvent) => void
+  ): (() => void) => {
+    let source: EventSource;
+    let closed = false;
+    let refreshed = false;
+
+    const connect = () => {
+      source = new EventSource(`${apiUrl}/lists/${listId}/events`, {
+        withCredentials: true,
+      });
+      [
+        "item-added",
+        "item-updated",
+        "item-checked",
+        "item-deleted",
+        "list-renamed",
+        "members-changed",
+        "resync",
+      ].forEach((type) => source.addEventListener(type, onChange));
+
+      source.onopen = () => {
+        refreshed = false;
+      };
+
+      // EventSource gives up when the access token expires; refresh and
+      // reconnect, but only once so a revoked list doesn't loop forever
+      source.onerror = async () => {
+        if (source.readyState !== EventSource.CLOSED || closed || refreshed) {
+          return;
+        }
+        refreshed = true;
+        if (await refreshSession()) {
+          connect();
+        }
+      };
+    };
+    connect();
+
+    return () => {
+      closed = true;
+      source.close();
+    };
+  };
+
   return {
     createList,
     getLists,
@@ -228,5 +371,13 @@ export const useLists = () => {
     deleteListItem,
     deleteList,
     shareList,
+    createInvite,
+    getInvites,
+    revokeInvite,
+    updateCollaboratorRole,
+    removeCollaborator,
+    leaveList,
+    transferOwnership,
+    subscribeToList,
   };
 };